@@ -0,0 +1,106 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/nextwavedevs/drop/business/data/studio"
+	"github.com/nextwavedevs/drop/business/data/user"
+	"github.com/nextwavedevs/drop/foundation/export"
+	"github.com/nextwavedevs/drop/foundation/logger"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Export writes every user or studio, as picked by the first argument, to
+// stdout or the --out file in CSV, NDJSON or JSON.
+func Export(log *logger.Logger, db *mongo.Client, args []string) error {
+	if len(args) == 0 || (args[0] != "studios" && args[0] != "users") {
+		fmt.Println("help: export studios|users [--format csv|ndjson|json] [--fields a,b] [--out file]")
+		return ErrHelp
+	}
+	kind := args[0]
+
+	fs := flag.NewFlagSet("export "+kind, flag.ContinueOnError)
+	format := fs.String("format", export.FormatJSON, "csv, ndjson or json")
+	fields := fs.String("fields", "", "comma separated fields to write, all when empty")
+	out := fs.String("out", "", "file to write to, stdout when empty")
+	deleted := fs.Bool("include-deleted", false, "include soft deleted records")
+	tags := fs.String("tags", "", "comma separated tags studios must have")
+	matchAll := fs.Bool("match-all", false, "studios must have every tag rather than any")
+	city := fs.String("city", "", "city studios must be in")
+	if err := fs.Parse(args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return ErrHelp
+		}
+		return errors.Wrap(err, "parsing flags")
+	}
+
+	allowed := user.ExportFields
+	if kind == "studios" {
+		allowed = studio.ExportFields
+	}
+	enc, err := export.NewEncoder(*format, split(*fields), allowed)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return errors.Wrap(err, "creating file")
+		}
+		defer f.Close()
+		w = f
+	}
+	bw := bufio.NewWriter(w)
+	ew := enc.NewWriter(bw)
+
+	ctx := context.Background()
+	const traceID = "drop-admin-export"
+
+	switch kind {
+	case "studios":
+		qf := studio.QueryFilter{
+			Tags:           split(*tags),
+			MatchAll:       *matchAll,
+			Locality:       *city,
+			IncludeDeleted: *deleted,
+		}
+		write := func(std studio.Info) error {
+			return ew.Write(std)
+		}
+		if err := studio.New(log, db).Export(ctx, traceID, qf, write); err != nil {
+			return errors.Wrap(err, "exporting studios")
+		}
+	case "users":
+		write := func(usr user.Info) error {
+			return ew.Write(usr)
+		}
+		if err := user.New(log, db).Export(ctx, traceID, *deleted, write); err != nil {
+			return errors.Wrap(err, "exporting users")
+		}
+	}
+
+	if err := ew.Close(); err != nil {
+		return errors.Wrap(err, "closing export")
+	}
+	return bw.Flush()
+}
+
+// split breaks a comma separated flag into its trimmed, non-empty parts.
+func split(s string) []string {
+	var parts []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
@@ -0,0 +1,64 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nextwavedevs/drop/business/data/studio"
+	"github.com/nextwavedevs/drop/foundation/geocode"
+	"github.com/nextwavedevs/drop/foundation/logger"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ImportStudios creates or updates studios from the rows of a CSV or NDJSON
+// file, picked by its extension, and prints the report of every row. Studios
+// are located with the bundled gazetteer.
+func ImportStudios(log *logger.Logger, db *mongo.Client, path string) error {
+	if path == "" {
+		fmt.Println("help: import studios <file.csv|file.ndjson>")
+		return ErrHelp
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "opening file")
+	}
+	defer f.Close()
+
+	var rows studio.RowReader
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		if rows, err = studio.CSVRows(f); err != nil {
+			return errors.Wrap(err, "reading csv")
+		}
+	case ".ndjson", ".jsonl":
+		rows = studio.NDJSONRows(f)
+	default:
+		return errors.Errorf("unsupported file type %q, expected .csv or .ndjson", filepath.Ext(path))
+	}
+
+	gaz, err := geocode.Bundled()
+	if err != nil {
+		return errors.Wrap(err, "loading gazetteer")
+	}
+
+	report, err := studio.New(log, db, studio.WithGeocoder(gaz)).Import(context.Background(), "drop-admin-import", rows, time.Now())
+	if err != nil {
+		return errors.Wrap(err, "importing studios")
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return errors.Wrap(err, "writing report")
+	}
+
+	fmt.Printf("created %d, updated %d, unchanged %d, failed %d\n", report.Created, report.Updated, report.Unchanged, report.Failed)
+	return nil
+}
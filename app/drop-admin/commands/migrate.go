@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nextwavedevs/drop/business/data/studio"
+	"github.com/nextwavedevs/drop/business/data/user"
+	"github.com/nextwavedevs/drop/foundation/logger"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MigrateAddresses moves studios saved with a city, state and country onto
+// structured addresses and prints the studios that need fixing by hand.
+func MigrateAddresses(log *logger.Logger, db *mongo.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	report, err := studio.New(log, db).MigrateAddresses(ctx, "drop-admin-migrate", time.Now())
+	if err != nil {
+		return errors.Wrap(err, "migrating addresses")
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return errors.Wrap(err, "writing report")
+	}
+
+	fmt.Printf("migrated %d studios, %d need their address checked\n", report.Migrated, len(report.Unresolved))
+	return nil
+}
+
+// MigratePasswords removes plaintext passwords from stored users.
+func MigratePasswords(log *logger.Logger, db *mongo.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	n, err := user.New(log, db).ScrubPasswords(ctx, "drop-admin-migrate", time.Now())
+	if err != nil {
+		return errors.Wrap(err, "scrubbing passwords")
+	}
+
+	fmt.Printf("removed plaintext passwords from %d users\n", n)
+	return nil
+}
@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/nextwavedevs/drop/business/data/studio"
+	"github.com/nextwavedevs/drop/business/data/user"
+	"github.com/nextwavedevs/drop/foundation/logger"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Purge permanently removes the users and studios that were soft deleted
+// longer ago than the --older-than duration.
+func Purge(log *logger.Logger, db *mongo.Client, args []string) error {
+	fs := flag.NewFlagSet("purge", flag.ContinueOnError)
+	olderThan := fs.Duration("older-than", 30*24*time.Hour, "how long a record must have been deleted for")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return ErrHelp
+		}
+		return errors.Wrap(err, "parsing flags")
+	}
+	if *olderThan < 0 {
+		return errors.New("older-than must not be negative")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	const traceID = "drop-admin-purge"
+	now := time.Now()
+	before := now.Add(-*olderThan)
+
+	users, err := user.New(log, db).Purge(ctx, traceID, before, now)
+	if err != nil {
+		return errors.Wrap(err, "purging users")
+	}
+
+	studios, err := studio.New(log, db).Purge(ctx, traceID, before, now)
+	if err != nil {
+		return errors.Wrap(err, "purging studios")
+	}
+
+	fmt.Printf("purged %d users and %d studios deleted before %s\n", users, studios, before.UTC().Format(time.RFC3339))
+	return nil
+}
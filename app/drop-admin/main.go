@@ -2,11 +2,12 @@ package main
 
 import (
 	"fmt"
-	"log"
 	"os"
 
 	"github.com/ardanlabs/conf"
 	"github.com/nextwavedevs/drop/app/drop-admin/commands"
+	"github.com/nextwavedevs/drop/foundation/database"
+	"github.com/nextwavedevs/drop/foundation/logger"
 	"github.com/pkg/errors"
 )
 
@@ -14,17 +15,17 @@ import (
 var build = "develop"
 
 func main() {
-	log := log.New(os.Stdout, "ADMIN : ", log.LstdFlags|log.Lmicroseconds|log.Lshortfile)
+	log := logger.New(os.Stdout, "drop-admin", logger.InfoLevel)
 
 	if err := run(log); err != nil {
 		if errors.Cause(err) != commands.ErrHelp {
-			log.Printf("error: %s", err)
+			log.Error("main: error", "error", err)
 		}
 		os.Exit(1)
 	}
 }
 
-func run(log *log.Logger) error {
+func run(log *logger.Logger) error {
 
 	// =========================================================================
 	// Configuration
@@ -61,7 +62,7 @@ func run(log *log.Logger) error {
 	if err != nil {
 		return errors.Wrap(err, "generating config for output")
 	}
-	log.Printf("main: Config :\n%v\n", out)
+	log.Info("main: Config", "config", out)
 
 	// ========================================================
 	// Commands
@@ -74,6 +75,42 @@ func run(log *log.Logger) error {
 
 		fmt.Println("genkey: generate a set of private/public key files")
 		return commands.ErrHelp
+
+	case "purge":
+		if err := commands.Purge(log, database.Client, cfg.Args[1:]); err != nil {
+			return errors.Wrap(err, "purging deleted records")
+		}
+
+	case "import":
+		switch cfg.Args.Num(1) {
+		case "studios":
+			if err := commands.ImportStudios(log, database.Client, cfg.Args.Num(2)); err != nil {
+				return errors.Wrap(err, "importing studios")
+			}
+		default:
+			fmt.Println("help: import studios <file>")
+			return commands.ErrHelp
+		}
+
+	case "migrate":
+		switch cfg.Args.Num(1) {
+		case "addresses":
+			if err := commands.MigrateAddresses(log, database.Client); err != nil {
+				return errors.Wrap(err, "migrating addresses")
+			}
+		case "passwords":
+			if err := commands.MigratePasswords(log, database.Client); err != nil {
+				return errors.Wrap(err, "migrating passwords")
+			}
+		default:
+			fmt.Println("help: migrate addresses|passwords")
+			return commands.ErrHelp
+		}
+
+	case "export":
+		if err := commands.Export(log, database.Client, cfg.Args[1:]); err != nil {
+			return errors.Wrap(err, "exporting records")
+		}
 	}
 
 	return nil
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/nextwavedevs/drop/business/data/audit"
+	"github.com/nextwavedevs/drop/foundation/web"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type auditGroup struct {
+	audit audit.Audit
+}
+
+// auditQuery holds the filters and pagination of the audit trail.
+type auditQuery struct {
+	paging
+	Entity   string    `query:"entity"`
+	EntityID string    `query:"entity_id"`
+	ActorID  string    `query:"actor_id"`
+	Action   string    `query:"action"`
+	From     time.Time `query:"from"`
+	To       time.Time `query:"to"`
+}
+
+// query lists the audit trail, most recent first. It can be narrowed with
+// ?entity=, ?entity_id=, ?actor_id=, ?action= and a ?from= / ?to= range.
+func (ag auditGroup) query(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.auditGroup.query")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	var aq auditQuery
+	if err := web.DecodeQuery(r, &aq); err != nil {
+		return err
+	}
+
+	qf := audit.QueryFilter{
+		Entity:   aq.Entity,
+		EntityID: aq.EntityID,
+		ActorID:  aq.ActorID,
+		Action:   aq.Action,
+		From:     aq.From,
+		To:       aq.To,
+	}
+
+	events, err := ag.audit.Query(ctx, v.TraceID, qf, aq.Page, aq.Rows)
+	if err != nil {
+		return errors.Wrap(err, "unable to query for audit events")
+	}
+
+	return web.Respond(ctx, w, events, http.StatusOK)
+}
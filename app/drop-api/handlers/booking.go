@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/nextwavedevs/drop/business/auth"
+	"github.com/nextwavedevs/drop/business/data/booking"
+	"github.com/nextwavedevs/drop/business/validate"
+	"github.com/nextwavedevs/drop/foundation/web"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type bookingGroup struct {
+	booking booking.Booking
+}
+
+// slotQuery holds the filters of a studio's slots.
+type slotQuery struct {
+	ResourceID string    `query:"resource"`
+	From       time.Time `query:"from"`
+	To         time.Time `query:"to"`
+}
+
+// bookingQuery holds the filters and pagination of a studio's bookings.
+type bookingQuery struct {
+	paging
+	Status string `query:"status"`
+}
+
+func (bg bookingGroup) queryResources(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.bookingGroup.queryResources")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	params := web.Params(r)
+	resources, err := bg.booking.QueryResources(ctx, v.TraceID, params["id"])
+	if err != nil {
+		return bookingError(err, "ID: %s", params["id"])
+	}
+
+	return web.Respond(ctx, w, resources, http.StatusOK)
+}
+
+func (bg bookingGroup) createResource(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.bookingGroup.createResource")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var nr booking.NewResource
+	if err := web.Decode(r, &nr); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	params := web.Params(r)
+	res, err := bg.booking.CreateResource(ctx, v.TraceID, claims, params["id"], nr, v.Now)
+	if err != nil {
+		return bookingError(err, "ID: %s Resource: %+v", params["id"], &nr)
+	}
+
+	return web.Respond(ctx, w, res, http.StatusCreated)
+}
+
+func (bg bookingGroup) createSlot(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.bookingGroup.createSlot")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var ns booking.NewSlot
+	if err := web.Decode(r, &ns); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	params := web.Params(r)
+	slot, err := bg.booking.CreateSlot(ctx, v.TraceID, claims, params["id"], params["resourceID"], ns, v.Now)
+	if err != nil {
+		return bookingError(err, "ID: %s Resource: %s Slot: %+v", params["id"], params["resourceID"], &ns)
+	}
+
+	return web.Respond(ctx, w, slot, http.StatusCreated)
+}
+
+// querySlots lists a studio's slots so clients can show availability. The
+// range defaults to the coming week and can be set with ?from= and ?to= as
+// RFC 3339 times or dates.
+func (bg bookingGroup) querySlots(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.bookingGroup.querySlots")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	var sq slotQuery
+	if err := web.DecodeQuery(r, &sq); err != nil {
+		return err
+	}
+
+	sf := booking.SlotFilter{
+		ResourceID: sq.ResourceID,
+		From:       sq.From,
+		To:         sq.To,
+	}
+	if sf.From.IsZero() {
+		sf.From = v.Now
+	}
+	if sf.To.IsZero() {
+		sf.To = sf.From.AddDate(0, 0, 7)
+	}
+
+	params := web.Params(r)
+	slots, err := bg.booking.QuerySlots(ctx, v.TraceID, params["id"], sf)
+	if err != nil {
+		return bookingError(err, "ID: %s", params["id"])
+	}
+
+	return web.Respond(ctx, w, slots, http.StatusOK)
+}
+
+func (bg bookingGroup) queryByStudio(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.bookingGroup.queryByStudio")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var bq bookingQuery
+	if err := web.DecodeQuery(r, &bq); err != nil {
+		return err
+	}
+
+	params := web.Params(r)
+	bookings, err := bg.booking.QueryByStudio(ctx, v.TraceID, claims, params["id"], bq.Status, bq.Page, bq.Rows)
+	if err != nil {
+		return bookingError(err, "ID: %s", params["id"])
+	}
+
+	return web.Respond(ctx, w, bookings, http.StatusOK)
+}
+
+func (bg bookingGroup) queryByUser(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.bookingGroup.queryByUser")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	pageNumber, rowsPerPage, err := pageQuery(r)
+	if err != nil {
+		return err
+	}
+
+	params := web.Params(r)
+	bookings, err := bg.booking.QueryByUser(ctx, v.TraceID, claims, params["id"], pageNumber, rowsPerPage)
+	if err != nil {
+		return bookingError(err, "ID: %s", params["id"])
+	}
+
+	return web.Respond(ctx, w, bookings, http.StatusOK)
+}
+
+func (bg bookingGroup) queryByID(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.bookingGroup.queryByID")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	params := web.Params(r)
+	bk, err := bg.booking.QueryByID(ctx, v.TraceID, claims, params["id"])
+	if err != nil {
+		return bookingError(err, "ID: %s", params["id"])
+	}
+
+	return web.Respond(ctx, w, bk, http.StatusOK)
+}
+
+func (bg bookingGroup) create(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.bookingGroup.create")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var nb booking.NewBooking
+	if err := web.Decode(r, &nb); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	bk, err := bg.booking.Create(ctx, v.TraceID, claims, nb, v.Now)
+	if err != nil {
+		return bookingError(err, "Booking: %+v", &nb)
+	}
+
+	return web.Respond(ctx, w, bk, http.StatusCreated)
+}
+
+func (bg bookingGroup) updateStatus(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.bookingGroup.updateStatus")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var us booking.UpdateStatus
+	if err := web.Decode(r, &us); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	params := web.Params(r)
+	bk, err := bg.booking.UpdateStatus(ctx, v.TraceID, claims, params["id"], us, v.Now)
+	if err != nil {
+		return bookingError(err, "ID: %s Status: %s", params["id"], us.Status)
+	}
+
+	return web.Respond(ctx, w, bk, http.StatusOK)
+}
+
+// bookingError maps the errors of the booking package onto request errors.
+func bookingError(err error, format string, args ...interface{}) error {
+	switch errors.Cause(err) {
+	case booking.ErrInvalidID:
+		return validate.NewRequestError(err, http.StatusBadRequest)
+	case booking.ErrNotFound:
+		return validate.NewRequestError(err, http.StatusNotFound)
+	case booking.ErrForbidden:
+		return validate.NewRequestError(err, http.StatusForbidden)
+	case booking.ErrSlotFull, booking.ErrSlotClosed, booking.ErrSlotOverlap,
+		booking.ErrAlreadyBooked, booking.ErrInvalidTransition, booking.ErrCancelWindow,
+		booking.ErrResourceBusy:
+		return validate.NewRequestError(err, http.StatusConflict)
+	default:
+		return errors.Wrapf(err, format, args...)
+	}
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nextwavedevs/drop/business/auth"
+	"github.com/nextwavedevs/drop/business/data/brand"
+	"github.com/nextwavedevs/drop/business/data/studio"
+	"github.com/nextwavedevs/drop/business/validate"
+	"github.com/nextwavedevs/drop/foundation/web"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// brandGroup serves brands and the studios grouped under them.
+type brandGroup struct {
+	brand  brand.Brand
+	studio studio.Studio
+}
+
+// adminSet is the set of users allowed to manage a brand.
+type adminSet struct {
+	Admins []string `json:"admins"`
+}
+
+func (bg brandGroup) query(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.brandGroup.query")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	pageNumber, rowsPerPage, err := pageQuery(r)
+	if err != nil {
+		return err
+	}
+
+	brands, err := bg.brand.Query(ctx, v.TraceID, pageNumber, rowsPerPage)
+	if err != nil {
+		return errors.Wrap(err, "unable to query for brands")
+	}
+
+	return web.Respond(ctx, w, brands, http.StatusOK)
+}
+
+func (bg brandGroup) queryByID(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.brandGroup.queryByID")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	params := web.Params(r)
+	brd, err := bg.brand.QueryByID(ctx, v.TraceID, params["id"])
+	if err != nil {
+		return brandError(err, "ID: %s", params["id"])
+	}
+
+	lastModified(w, brd.Updated_at)
+	return web.Respond(ctx, w, brd, http.StatusOK)
+}
+
+// queryStudios lists the locations of a brand a page at a time, filled in
+// with the details they inherit from it.
+func (bg brandGroup) queryStudios(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.brandGroup.queryStudios")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	pageNumber, rowsPerPage, err := pageQuery(r)
+	if err != nil {
+		return err
+	}
+
+	params := web.Params(r)
+	if _, err := bg.brand.QueryByID(ctx, v.TraceID, params["id"]); err != nil {
+		return brandError(err, "ID: %s", params["id"])
+	}
+
+	studios, err := bg.studio.QueryByBrand(ctx, v.TraceID, params["id"], pageNumber, rowsPerPage)
+	if err != nil {
+		return errors.Wrapf(err, "unable to query studios of brand %s", params["id"])
+	}
+
+	list := make([]*studio.Info, len(studios))
+	for i := range studios {
+		list[i] = &studios[i]
+	}
+	if err := bg.studio.Inherit(ctx, v.TraceID, list...); err != nil {
+		return errors.Wrap(err, "unable to inherit brand details")
+	}
+
+	return web.Respond(ctx, w, studios, http.StatusOK)
+}
+
+func (bg brandGroup) create(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.brandGroup.create")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	var nb brand.NewBrand
+	if err := web.Decode(r, &nb); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	brd, err := bg.brand.Create(ctx, v.TraceID, nb, v.Now)
+	if err != nil {
+		return brandError(err, "Brand: %+v", &nb)
+	}
+
+	return web.Respond(ctx, w, brd, http.StatusCreated)
+}
+
+// update changes the details of a brand. Site admins and the admins of the
+// brand may update it.
+func (bg brandGroup) update(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.brandGroup.update")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var ub brand.UpdateBrand
+	if err := web.Decode(r, &ub); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	params := web.Params(r)
+	brd, err := bg.brand.Update(ctx, v.TraceID, claims, params["id"], ub, v.Now)
+	if err != nil {
+		return brandError(err, "ID: %s Brand: %+v", params["id"], &ub)
+	}
+
+	return web.Respond(ctx, w, brd, http.StatusOK)
+}
+
+// delete removes a brand and takes its studios out of it.
+func (bg brandGroup) delete(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.brandGroup.delete")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	params := web.Params(r)
+	if err := bg.brand.Delete(ctx, v.TraceID, params["id"], v.Now); err != nil {
+		return brandError(err, "ID: %s", params["id"])
+	}
+
+	if _, err := bg.studio.DetachBrand(ctx, v.TraceID, params["id"], v.Now); err != nil {
+		return errors.Wrapf(err, "detaching studios of brand %s", params["id"])
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// setAdmins replaces the users who may manage a brand and all its studios.
+func (bg brandGroup) setAdmins(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.brandGroup.setAdmins")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	var req adminSet
+	if err := web.Decode(r, &req); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	params := web.Params(r)
+	brd, err := bg.brand.SetAdmins(ctx, v.TraceID, params["id"], req.Admins, v.Now)
+	if err != nil {
+		return brandError(err, "ID: %s Admins: %v", params["id"], req.Admins)
+	}
+
+	return web.Respond(ctx, w, brd, http.StatusOK)
+}
+
+// addStudio puts a studio under a brand. The caller must be able to manage
+// both the studio and the brand.
+func (bg brandGroup) addStudio(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	return bg.setBrand(ctx, w, r, "handlers.brandGroup.addStudio", true)
+}
+
+// removeStudio takes a studio out of a brand.
+func (bg brandGroup) removeStudio(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	return bg.setBrand(ctx, w, r, "handlers.brandGroup.removeStudio", false)
+}
+
+// setBrand adds the studio named in the path to the brand, or takes it out.
+func (bg brandGroup) setBrand(ctx context.Context, w http.ResponseWriter, r *http.Request, name string, add bool) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, name)
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	params := web.Params(r)
+	std, err := bg.studio.QueryByID(ctx, v.TraceID, params["studioID"], false)
+	if err != nil {
+		return brandError(err, "Studio: %s", params["studioID"])
+	}
+
+	brandID := params["id"]
+	if !add {
+		if std.BrandID != brandID {
+			return validate.NewRequestError(studio.ErrNotFound, http.StatusNotFound)
+		}
+		brandID = ""
+	}
+
+	std, err = bg.studio.SetBrand(ctx, v.TraceID, claims, std.ID, brandID, v.Now)
+	if err != nil {
+		return brandError(err, "ID: %s Studio: %s", params["id"], params["studioID"])
+	}
+
+	return web.Respond(ctx, w, std, http.StatusOK)
+}
+
+// brandError maps the errors of the brand and studio packages onto their
+// responses.
+func brandError(err error, format string, args ...interface{}) error {
+	switch errors.Cause(err) {
+	case brand.ErrInvalidID, studio.ErrInvalidID:
+		return validate.NewRequestError(err, http.StatusBadRequest)
+	case brand.ErrNotFound, studio.ErrNotFound:
+		return validate.NewRequestError(err, http.StatusNotFound)
+	case brand.ErrForbidden, studio.ErrForbidden:
+		return validate.NewRequestError(err, http.StatusForbidden)
+	default:
+		return errors.Wrapf(err, format, args...)
+	}
+}
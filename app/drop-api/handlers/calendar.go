@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nextwavedevs/drop/business/auth"
+	"github.com/nextwavedevs/drop/business/data/booking"
+	"github.com/nextwavedevs/drop/business/data/schedule"
+	"github.com/nextwavedevs/drop/business/data/studio"
+	"github.com/nextwavedevs/drop/business/validate"
+	"github.com/nextwavedevs/drop/foundation/ical"
+	"github.com/nextwavedevs/drop/foundation/web"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// prodID identifies this service as the producer of calendar feeds.
+const prodID = "-//drop//drop-api//EN"
+
+// feedHistory is how far back the private booking feed reaches.
+const feedHistory = 30 * 24 * time.Hour
+
+type calendarGroup struct {
+	studio     studio.Studio
+	schedule   schedule.Schedule
+	booking    booking.Booking
+	feedSecret string
+}
+
+// feedLink is the private address of a user's calendar feed.
+type feedLink struct {
+	URL string `json:"url"`
+}
+
+// studioFeed publishes a studio's classes as an iCalendar feed. Recurring
+// classes are emitted with their RRULE so calendar applications expand them.
+func (cg calendarGroup) studioFeed(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.calendarGroup.studioFeed")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	params := web.Params(r)
+	std, err := cg.studio.QueryByID(ctx, v.TraceID, params["id"], false)
+	if err != nil {
+		switch errors.Cause(err) {
+		case studio.ErrInvalidID:
+			return validate.NewRequestError(err, http.StatusBadRequest)
+		case studio.ErrNotFound:
+			return validate.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "ID: %s", params["id"])
+		}
+	}
+
+	schedules, err := cg.schedule.Query(ctx, v.TraceID, std.ID)
+	if err != nil {
+		return errors.Wrapf(err, "ID: %s", std.ID)
+	}
+
+	cal := ical.Calendar{
+		ProdID: prodID,
+		Name:   std.Name,
+		Events: make([]ical.Event, len(schedules)),
+	}
+	for i, sch := range schedules {
+		cal.Events[i] = ical.Event{
+			UID:          sch.ID + "@drop",
+			Summary:      sch.Title,
+			Description:  sch.Description,
+			Location:     studioLocation(std),
+			Start:        sch.Start,
+			End:          sch.Start.Add(time.Duration(sch.Duration_minutes) * time.Minute),
+			TZID:         sch.Timezone,
+			RRule:        sch.RRule,
+			ExDates:      sch.ExDates,
+			Created:      sch.Created_at,
+			LastModified: sch.Updated_at,
+		}
+	}
+
+	return respondCalendar(ctx, w, cal, v.Now)
+}
+
+// feedURL returns the signed private feed URL of a user's bookings.
+func (cg calendarGroup) feedURL(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.calendarGroup.feedURL")
+	defer span.End()
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	params := web.Params(r)
+	userID := params["id"]
+	if err := validate.CheckID(userID); err != nil {
+		return validate.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	// If you are not an admin and looking to retrieve someone other than yourself.
+	if !claims.Authorized(auth.RoleAdmin) && claims.Subject != userID {
+		return validate.NewRequestError(errors.New("attempted action is not allowed"), http.StatusForbidden)
+	}
+
+	feed := feedLink{
+		URL: fmt.Sprintf("/v1/users/%s/calendar/%s.ics", userID, auth.FeedToken(cg.feedSecret, userID)),
+	}
+
+	return web.Respond(ctx, w, feed, http.StatusOK)
+}
+
+// userFeed publishes a user's bookings as an iCalendar feed. The request is
+// authorised by the token in the URL rather than a bearer token since
+// calendar applications can't send one.
+func (cg calendarGroup) userFeed(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.calendarGroup.userFeed")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	params := web.Params(r)
+	userID := params["id"]
+	token := strings.TrimSuffix(params["token"], ".ics")
+	if !auth.CheckFeedToken(cg.feedSecret, userID, token) {
+		return validate.NewRequestError(errors.New("not found"), http.StatusNotFound)
+	}
+
+	bookings, err := cg.booking.QueryFeed(ctx, v.TraceID, userID, v.Now.Add(-feedHistory))
+	if err != nil {
+		return errors.Wrapf(err, "ID: %s", userID)
+	}
+
+	ids := make([]string, len(bookings))
+	for i, bk := range bookings {
+		ids[i] = bk.StudioID
+	}
+	studios, err := cg.studio.QueryByIDs(ctx, v.TraceID, ids)
+	if err != nil {
+		return errors.Wrapf(err, "ID: %s", userID)
+	}
+
+	cal := ical.Calendar{
+		ProdID: prodID,
+		Name:   "My bookings",
+		Events: make([]ical.Event, len(bookings)),
+	}
+	for i, bk := range bookings {
+		std := studios[bk.StudioID]
+		cal.Events[i] = ical.Event{
+			UID:          bk.ID + "@drop",
+			Summary:      "Booking at " + std.Name,
+			Description:  bk.Notes,
+			Location:     studioLocation(std),
+			Status:       bookingStatus(bk.Status),
+			Start:        bk.Start,
+			End:          bk.End,
+			Created:      bk.Created_at,
+			LastModified: bk.Updated_at,
+		}
+	}
+
+	return respondCalendar(ctx, w, cal, v.Now)
+}
+
+// respondCalendar encodes the calendar and sends it to the client.
+func respondCalendar(ctx context.Context, w http.ResponseWriter, cal ical.Calendar, now time.Time) error {
+	var b bytes.Buffer
+	if err := cal.Encode(&b, now); err != nil {
+		return errors.Wrap(err, "encoding calendar")
+	}
+
+	return web.RespondRaw(ctx, w, b.Bytes(), ical.ContentType, http.StatusOK)
+}
+
+// studioLocation formats the location of a studio for calendar entries.
+func studioLocation(std studio.Info) string {
+	addr := std.Address
+	parts := append([]string{}, addr.Lines...)
+	for _, p := range []string{addr.Locality, addr.Region, addr.PostalCode, addr.Country} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// bookingStatus maps a booking status onto an iCalendar event status.
+func bookingStatus(status string) string {
+	switch status {
+	case booking.StatusPending:
+		return ical.StatusTentative
+	case booking.StatusCancelled:
+		return ical.StatusCancelled
+	default:
+		return ical.StatusConfirmed
+	}
+}
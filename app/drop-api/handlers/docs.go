@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nextwavedevs/drop/business/validate"
+	"github.com/nextwavedevs/drop/foundation/web"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// docsGroup describes the API from the routes registered with the app.
+type docsGroup struct {
+	app   *web.App
+	build string
+}
+
+// spec serves the OpenAPI document of the API. It is built on each request
+// so it always matches the routes being served.
+func (dg docsGroup) spec(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.docsGroup.spec")
+	defer span.End()
+
+	doc := dg.app.OpenAPI(web.APIInfo{
+		Title:       "Drop API",
+		Version:     dg.build,
+		Description: "Studios, classes and bookings.",
+		Errors: map[string]interface{}{
+			"application/json":   validate.ErrorResponse{},
+			validate.ProblemType: validate.Problem{},
+		},
+	})
+
+	return web.Respond(ctx, w, doc, http.StatusOK)
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nextwavedevs/drop/business/auth"
+	"github.com/nextwavedevs/drop/business/data/favorite"
+	"github.com/nextwavedevs/drop/business/validate"
+	"github.com/nextwavedevs/drop/foundation/web"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type favoriteGroup struct {
+	favorite favorite.Favorite
+}
+
+func (fg favoriteGroup) query(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.favoriteGroup.query")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	pageNumber, rowsPerPage, err := pageQuery(r)
+	if err != nil {
+		return err
+	}
+
+	params := web.Params(r)
+	favs, err := fg.favorite.Query(ctx, v.TraceID, claims, params["id"], pageNumber, rowsPerPage)
+	if err != nil {
+		switch errors.Cause(err) {
+		case favorite.ErrInvalidID:
+			return validate.NewRequestError(err, http.StatusBadRequest)
+		case favorite.ErrForbidden:
+			return validate.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "ID: %s", params["id"])
+		}
+	}
+
+	return web.Respond(ctx, w, favs, http.StatusOK)
+}
+
+func (fg favoriteGroup) add(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.favoriteGroup.add")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	params := web.Params(r)
+	fav, err := fg.favorite.Add(ctx, v.TraceID, claims, params["id"], params["studioID"], v.Now)
+	if err != nil {
+		switch errors.Cause(err) {
+		case favorite.ErrInvalidID:
+			return validate.NewRequestError(err, http.StatusBadRequest)
+		case favorite.ErrNotFound:
+			return validate.NewRequestError(err, http.StatusNotFound)
+		case favorite.ErrForbidden:
+			return validate.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "ID: %s Studio: %s", params["id"], params["studioID"])
+		}
+	}
+
+	return web.Respond(ctx, w, fav, http.StatusCreated)
+}
+
+func (fg favoriteGroup) remove(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.favoriteGroup.remove")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	params := web.Params(r)
+	err := fg.favorite.Remove(ctx, v.TraceID, claims, params["id"], params["studioID"], v.Now)
+	if err != nil {
+		switch errors.Cause(err) {
+		case favorite.ErrInvalidID:
+			return validate.NewRequestError(err, http.StatusBadRequest)
+		case favorite.ErrNotFound:
+			return validate.NewRequestError(err, http.StatusNotFound)
+		case favorite.ErrForbidden:
+			return validate.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "ID: %s Studio: %s", params["id"], params["studioID"])
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
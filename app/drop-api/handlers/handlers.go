@@ -4,21 +4,53 @@ package handlers
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/nextwavedevs/drop/business/auth"
+	"github.com/nextwavedevs/drop/business/data/audit"
+	"github.com/nextwavedevs/drop/business/data/booking"
+	"github.com/nextwavedevs/drop/business/data/brand"
+	"github.com/nextwavedevs/drop/business/data/favorite"
+	"github.com/nextwavedevs/drop/business/data/schedule"
 	"github.com/nextwavedevs/drop/business/data/studio"
+	"github.com/nextwavedevs/drop/business/data/tag"
 	"github.com/nextwavedevs/drop/business/data/user"
 	"github.com/nextwavedevs/drop/business/mid"
+	"github.com/nextwavedevs/drop/business/validate"
+	"github.com/nextwavedevs/drop/foundation/export"
+	"github.com/nextwavedevs/drop/foundation/geocode"
+	"github.com/nextwavedevs/drop/foundation/idempotency"
+	"github.com/nextwavedevs/drop/foundation/logger"
+	"github.com/nextwavedevs/drop/foundation/patch"
+	"github.com/nextwavedevs/drop/foundation/ratelimit"
 	"github.com/nextwavedevs/drop/foundation/web"
+	"github.com/pkg/errors"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // Options represent optional parameters.
 type Options struct {
-	corsOrigin string
+	corsOrigin  string
+	compressMin int
+	maxBody     int64
+	timeout     time.Duration
+	exportLimit time.Duration
+	importLimit time.Duration
+	feedSecret  string
+	geocoder    geocode.Geocoder
+	rateStore   ratelimit.Store
+	rateLimits  map[string]ratelimit.Limit
+	idemStore   idempotency.Store
+	idemTTL     time.Duration
+	proxies     []*net.IPNet
 }
 
 // WithCORS provides configuration options for CORS.
@@ -28,8 +60,123 @@ func WithCORS(origin string) func(opts *Options) {
 	}
 }
 
+// WithCompression compresses responses of at least minSize bytes for
+// clients that accept it.
+func WithCompression(minSize int) func(opts *Options) {
+	return func(opts *Options) {
+		opts.compressMin = minSize
+	}
+}
+
+// WithMaxBody sets the largest request body, in bytes, routes accept unless
+// they set their own limit.
+func WithMaxBody(n int64) func(opts *Options) {
+	return func(opts *Options) {
+		opts.maxBody = n
+	}
+}
+
+// WithWriteTimeouts sets how long routes have to write their response and
+// the longer time given to streamed exports.
+func WithWriteTimeouts(timeout time.Duration, export time.Duration) func(opts *Options) {
+	return func(opts *Options) {
+		opts.timeout = timeout
+		opts.exportLimit = export
+	}
+}
+
+// WithImportTimeout sets how long imports have to upload their file and
+// respond, in place of the server's read timeout and the write timeout of
+// other routes.
+func WithImportTimeout(d time.Duration) func(opts *Options) {
+	return func(opts *Options) {
+		opts.importLimit = d
+	}
+}
+
+// WithFeedSecret provides the secret used to sign private calendar feed URLs.
+// Private feeds are disabled when no secret is configured.
+func WithFeedSecret(secret string) func(opts *Options) {
+	return func(opts *Options) {
+		opts.feedSecret = secret
+	}
+}
+
+// WithGeocoder provides the geocoder used to locate studios from their
+// address. Studios are saved without coordinates when none is configured.
+func WithGeocoder(g geocode.Geocoder) func(opts *Options) {
+	return func(opts *Options) {
+		opts.geocoder = g
+	}
+}
+
+// WithTrustedProxies provides the proxies, such as load balancers, trusted
+// to report the address of the client in X-Forwarded-For.
+func WithTrustedProxies(nets []*net.IPNet) func(opts *Options) {
+	return func(opts *Options) {
+		opts.proxies = nets
+	}
+}
+
+// WithRateLimit provides the store holding rate limit buckets and the limit
+// of each route group. The "default" group applies to every route; groups
+// without a limit are not limited.
+func WithRateLimit(store ratelimit.Store, limits map[string]ratelimit.Limit) func(opts *Options) {
+	return func(opts *Options) {
+		opts.rateStore = store
+		opts.rateLimits = limits
+	}
+}
+
+// rateLimit returns the middleware limiting a route group, or nil when the
+// group has no limit.
+func (opts Options) rateLimit(log *logger.Logger, group string, key mid.RateKey) web.Middleware {
+	limit, ok := opts.rateLimits[group]
+	if !ok || opts.rateStore == nil {
+		return nil
+	}
+	return mid.RateLimit(log, opts.rateStore, group, limit, key)
+}
+
+// WithIdempotency provides the store remembering the responses to requests
+// made with an Idempotency-Key and how long they are kept. Keys are ignored
+// when no store is configured.
+func WithIdempotency(store idempotency.Store, ttl time.Duration) func(opts *Options) {
+	return func(opts *Options) {
+		opts.idemStore = store
+		opts.idemTTL = ttl
+	}
+}
+
+// idempotency returns the middleware replaying retried requests, or nil when
+// no store is configured.
+func (opts Options) idempotency(log *logger.Logger) web.Middleware {
+	if opts.idemStore == nil {
+		return nil
+	}
+	return mid.Idempotency(log, opts.idemStore, opts.idemTTL)
+}
+
+// exportDoc documents the time a streamed export has to finish, after which
+// the response is cut short.
+func (opts Options) exportDoc(summary string) string {
+	if opts.exportLimit <= 0 {
+		return summary
+	}
+	return fmt.Sprintf("%s. The export must finish within %s or it is cut short", summary, opts.exportLimit)
+}
+
+// compression returns the middleware compressing responses, or nil when
+// compression is off.
+func (opts Options) compression() web.Middleware {
+	if opts.compressMin <= 0 {
+		return nil
+	}
+	return web.Compress(opts.compressMin)
+}
+
 // API constructs an http.Handler with all application routes defined.
-func API(build string, shutdown chan os.Signal, log *log.Logger, a *auth.Auth, db *mongo.Client, options ...func(opts *Options)) http.Handler {
+func API(build string, shutdown chan os.Signal, log *logger.Logger, a *auth.Auth, db *mongo.Client, options ...func(opts *Options)) http.Handler {
 
 	var opts Options
 	for _, option := range options {
@@ -37,7 +184,14 @@ func API(build string, shutdown chan os.Signal, log *log.Logger, a *auth.Auth, d
 	}
 
 	// Construct the web.App which holds all routes as well as common Middleware.
-	app := web.NewApp(shutdown, mid.Logger(log), mid.Errors(log), mid.Metrics(), mid.Panics(log))
+	app := web.NewApp(shutdown, log, opts.compression(), mid.Logger(log), mid.Metrics(), mid.Errors(log), mid.Panics(log), opts.rateLimit(log, "default", mid.ByIP))
+	if opts.maxBody != 0 {
+		app.MaxBody(opts.maxBody)
+	}
+	if opts.timeout != 0 {
+		app.WriteTimeout(opts.timeout)
+	}
+	app.TrustProxies(opts.proxies)
 
 	//Register check group
 	cg := checkGroup{
@@ -54,24 +208,413 @@ func API(build string, shutdown chan os.Signal, log *log.Logger, a *auth.Auth, d
 		auth: a,
 	}
 
-	app.Handle(http.MethodGet, "/v1/users/:page/:rows", ug.query, mid.Authenticate(a), mid.Authorize(auth.RoleAdmin)) //<== you can't do this if you are not an admin and are not yet authenticated. so he used the get token with his id as kid to generate token
-	app.Handle(http.MethodGet, "/v1/users/token/:kid", ug.token)
-	app.Handle(http.MethodGet, "/v1/users/:id", ug.queryByID, mid.Authenticate(a))
-	app.Handle(http.MethodPost, "/v1/users", ug.create)
-	app.Handle(http.MethodPut, "/v1/users/:id", ug.update, mid.Authenticate(a), mid.Authorize(auth.RoleAdmin))
-	app.Handle(http.MethodDelete, "/v1/users/:id", ug.delete, mid.Authenticate(a), mid.Authorize(auth.RoleAdmin))
+	app.Handle(http.MethodGet, "/v1/users/export", ug.exportUsers, mid.Authenticate(a), mid.Authorize(auth.RoleAdmin)).
+		Doc(opts.exportDoc("Export users as JSON, NDJSON or CSV")).
+		Timeout(opts.exportLimit).
+		Query("format", "json, ndjson or csv").
+		Query("fields", "Comma separated fields to export").
+		ReturnsRaw(http.StatusOK, "application/json", "application/x-ndjson", "text/csv")
+	//<== you can't do this if you are not an admin and are not yet authenticated. so he used the get token with his id as kid to generate token
+	app.Handle(http.MethodGet, "/v1/users/:page/:rows", ug.query, mid.Authenticate(a), mid.Authorize(auth.RoleAdmin)).
+		Doc("List users").
+		Returns(http.StatusOK, []user.Info{}).
+		Fails(http.StatusBadRequest)
+	app.Handle(http.MethodGet, "/v1/users/token/:kid", ug.token, opts.rateLimit(log, "token", mid.ByIP)).
+		Doc("Issue a token for the user authenticated with basic auth").
+		Returns(http.StatusOK, token{}).
+		Fails(http.StatusUnauthorized)
+	app.Handle(http.MethodGet, "/v1/users/:id", ug.queryByID, mid.Authenticate(a)).
+		Doc("Get a user").
+		Cache("private, no-cache").
+		Query("include_deleted", "Include a deleted user, admins only").
+		Returns(http.StatusOK, user.Info{}).
+		Fails(http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound)
+	app.Handle(http.MethodPost, "/v1/users", ug.create, opts.rateLimit(log, "signup", mid.ByIP), opts.idempotency(log)).
+		Doc("Sign up a user").
+		Accepts(user.NewUser{}).
+		Returns(http.StatusCreated, user.Info{}).
+		Fails(http.StatusBadRequest)
+	app.Handle(http.MethodPut, "/v1/users/:id", ug.update, mid.Authenticate(a), mid.Authorize(auth.RoleAdmin)).
+		Doc("Update a user, conditional on If-Match").
+		Accepts(user.UpdateUser{}).
+		Returns(http.StatusNoContent, nil).
+		Fails(http.StatusBadRequest, http.StatusNotFound, http.StatusPreconditionFailed, http.StatusPreconditionRequired)
+	app.Handle(http.MethodPatch, "/v1/users/:id", ug.patch, mid.Authenticate(a), mid.Authorize(auth.RoleAdmin)).
+		Doc("Patch a user with a JSON merge patch or JSON patch").
+		AcceptsRaw("application/merge-patch+json", "application/json-patch+json").
+		Returns(http.StatusNoContent, nil).
+		Fails(http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusPreconditionFailed, http.StatusPreconditionRequired, http.StatusUnsupportedMediaType)
+	app.Handle(http.MethodDelete, "/v1/users/:id", ug.delete, mid.Authenticate(a), mid.Authorize(auth.RoleAdmin)).
+		Doc("Delete a user, conditional on If-Match").
+		Returns(http.StatusNoContent, nil).
+		Fails(http.StatusBadRequest, http.StatusNotFound, http.StatusPreconditionFailed, http.StatusPreconditionRequired)
+	app.Handle(http.MethodPost, "/v1/users/:id/restore", ug.restore, mid.Authenticate(a), mid.Authorize(auth.RoleAdmin)).
+		Doc("Restore a deleted user").
+		Returns(http.StatusOK, user.Info{}).
+		Fails(http.StatusBadRequest, http.StatusNotFound)
+
+	// Register the saved studio endpoints for users.
+	fg := favoriteGroup{
+		favorite: favorite.New(log, db),
+	}
+
+	app.Handle(http.MethodGet, "/v1/users/:id/favorites", fg.query, mid.Authenticate(a)).
+		Doc("List the studios a user saved").
+		Query("page", "Page number").
+		Query("rows", "Rows per page").
+		Returns(http.StatusOK, []favorite.Studio{}).
+		Fails(http.StatusBadRequest, http.StatusForbidden)
+	app.Handle(http.MethodPost, "/v1/users/:id/favorites/:studioID", fg.add, mid.Authenticate(a)).
+		Doc("Save a studio").
+		Returns(http.StatusCreated, favorite.Info{}).
+		Fails(http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound)
+	app.Handle(http.MethodDelete, "/v1/users/:id/favorites/:studioID", fg.remove, mid.Authenticate(a)).
+		Doc("Remove a saved studio").
+		Returns(http.StatusNoContent, nil).
+		Fails(http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound)
 
 	// Register studio endpoints.
 	sg := studioGroup{
-		studio: studio.New(log, db),
+		studio: studio.New(log, db, studio.WithGeocoder(opts.geocoder)),
+	}
+
+	app.Handle(http.MethodGet, "/v1/studio/export", sg.exportStudios, mid.Authenticate(a), mid.Authorize(auth.RoleAdmin)).
+		Doc(opts.exportDoc("Export studios as JSON, NDJSON or CSV")).
+		Timeout(opts.exportLimit).
+		Query("format", "json, ndjson or csv").
+		Query("fields", "Comma separated fields to export").
+		ReturnsRaw(http.StatusOK, "application/json", "application/x-ndjson", "text/csv")
+	app.Handle(http.MethodGet, "/v1/studio/:page/:rows", sg.query, mid.Identify(a)).
+		Doc("List studios").
+		Cache("no-cache").
+		Query("tags", "Comma separated tag slugs").
+		Query("match", "all to require every tag").
+		Query("city", "Locality of the studios").
+		Returns(http.StatusOK, []studio.Info{}).
+		Fails(http.StatusBadRequest)
+	app.Handle(http.MethodGet, "/v1/studio/:page/:rows/:city", sg.queryByLocation, mid.Identify(a)).
+		Doc("List the studios in a city").
+		Cache("no-cache").
+		Query("tags", "Comma separated tag slugs").
+		Query("match", "all to require every tag").
+		Returns(http.StatusOK, []studio.Info{}).
+		Fails(http.StatusBadRequest)
+	app.Handle(http.MethodGet, "/v1/studio/:id", sg.queryByID, mid.Identify(a)).
+		Doc("Get a studio").
+		Cache("no-cache").
+		Query("include_deleted", "Include a deleted studio, admins only").
+		Returns(http.StatusOK, studio.Info{}).
+		Returns(http.StatusMovedPermanently, redirect{}).
+		Fails(http.StatusBadRequest, http.StatusNotFound)
+	app.Handle(http.MethodPost, "/v1/studio", sg.create, mid.Identify(a), opts.idempotency(log)).
+		Doc("Create a studio").
+		Accepts(studio.NewStudio{}).
+		Returns(http.StatusCreated, studio.Info{}).
+		Fails(http.StatusBadRequest)
+	app.Handle(http.MethodPost, "/v1/studio/import", sg.importStudios, mid.Authenticate(a), mid.Authorize(auth.RoleAdmin)).
+		Doc("Import studios from CSV or NDJSON").
+		Limit(32<<20).
+		BodyTimeout(opts.importLimit).
+		Timeout(opts.importLimit).
+		AcceptsRaw("text/csv", "application/x-ndjson").
+		Returns(http.StatusOK, studio.ImportReport{}).
+		Fails(http.StatusBadRequest, http.StatusUnsupportedMediaType)
+	app.Handle(http.MethodPut, "/v1/studio/:id", sg.update, mid.Authenticate(a)).
+		Doc("Update a studio, conditional on If-Match").
+		Accepts(studio.UpdateStudio{}).
+		Returns(http.StatusNoContent, nil).
+		Fails(http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusPreconditionFailed, http.StatusPreconditionRequired)
+	app.Handle(http.MethodPatch, "/v1/studio/:id", sg.patch, mid.Authenticate(a)).
+		Doc("Patch a studio with a JSON merge patch or JSON patch").
+		AcceptsRaw("application/merge-patch+json", "application/json-patch+json").
+		Returns(http.StatusNoContent, nil).
+		Fails(http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusPreconditionFailed, http.StatusPreconditionRequired, http.StatusUnsupportedMediaType)
+	app.Handle(http.MethodDelete, "/v1/studio/:id", sg.delete, mid.Authenticate(a), mid.Authorize(auth.RoleAdmin)).
+		Doc("Delete a studio, conditional on If-Match").
+		Returns(http.StatusNoContent, nil).
+		Fails(http.StatusBadRequest, http.StatusNotFound, http.StatusPreconditionFailed, http.StatusPreconditionRequired)
+	app.Handle(http.MethodPost, "/v1/studio/:id/restore", sg.restore, mid.Authenticate(a), mid.Authorize(auth.RoleAdmin)).
+		Doc("Restore a deleted studio").
+		Returns(http.StatusOK, studio.Info{}).
+		Fails(http.StatusBadRequest, http.StatusNotFound)
+	app.Handle(http.MethodPut, "/v1/studio/:id/tags", sg.setTags, mid.Authenticate(a)).
+		Doc("Replace the tags of a studio").
+		Accepts(tagSet{}).
+		Returns(http.StatusOK, tagSet{}).
+		Fails(http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound)
+	app.Handle(http.MethodPut, "/v1/studio/:id/owners", sg.setOwners, mid.Authenticate(a), mid.Authorize(auth.RoleAdmin)).
+		Doc("Replace the owners of a studio").
+		Accepts(ownerSet{}).
+		Returns(http.StatusNoContent, nil).
+		Fails(http.StatusBadRequest, http.StatusNotFound)
+
+	// Register the booking endpoints. Studio owners manage resources, slots
+	// and the bookings made against them; customers reserve and cancel.
+	bg := bookingGroup{
+		booking: booking.New(log, db),
 	}
 
-	app.Handle(http.MethodGet, "/v1/studio/:page/:rows", sg.query)
-	app.Handle(http.MethodGet, "/v1/studio/:page/:rows/:city", sg.queryByLocation)
-	app.Handle(http.MethodGet, "/v1/studio/:id", sg.queryByID)
-	app.Handle(http.MethodPost, "/v1/studio", sg.create)
-	app.Handle(http.MethodPut, "/v1/studio/:id", sg.update)
-	app.Handle(http.MethodDelete, "/v1/studio/:id", sg.delete, mid.Authenticate(a), mid.Authorize(auth.RoleAdmin))
+	app.Handle(http.MethodGet, "/v1/studio/:id/resources", bg.queryResources).
+		Doc("List the bookable resources of a studio").
+		Cache("public, max-age=60").
+		Returns(http.StatusOK, []booking.Resource{}).
+		Fails(http.StatusBadRequest)
+	app.Handle(http.MethodPost, "/v1/studio/:id/resources", bg.createResource, mid.Authenticate(a)).
+		Doc("Add a bookable resource to a studio").
+		Accepts(booking.NewResource{}).
+		Returns(http.StatusCreated, booking.Resource{}).
+		Fails(http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound)
+	app.Handle(http.MethodPost, "/v1/studio/:id/resources/:resourceID/slots", bg.createSlot, mid.Authenticate(a)).
+		Doc("Open a slot on a resource").
+		Accepts(booking.NewSlot{}).
+		Returns(http.StatusCreated, booking.Slot{}).
+		Fails(http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict)
+	app.Handle(http.MethodGet, "/v1/studio/:id/slots", bg.querySlots).
+		Doc("List the open slots of a studio").
+		Cache("public, no-cache").
+		Query("resource", "Resource id").
+		Query("from", "Start of the range, RFC 3339").
+		Query("to", "End of the range, RFC 3339").
+		Returns(http.StatusOK, []booking.Slot{}).
+		Fails(http.StatusBadRequest)
+	app.Handle(http.MethodGet, "/v1/studio/:id/bookings", bg.queryByStudio, mid.Authenticate(a)).
+		Doc("List the bookings of a studio").
+		Query("status", "Booking status").
+		Query("page", "Page number").
+		Query("rows", "Rows per page").
+		Returns(http.StatusOK, []booking.Info{}).
+		Fails(http.StatusBadRequest, http.StatusForbidden)
+	app.Handle(http.MethodGet, "/v1/users/:id/bookings", bg.queryByUser, mid.Authenticate(a)).
+		Doc("List the bookings of a user").
+		Query("page", "Page number").
+		Query("rows", "Rows per page").
+		Returns(http.StatusOK, []booking.Info{}).
+		Fails(http.StatusBadRequest, http.StatusForbidden)
+	app.Handle(http.MethodGet, "/v1/bookings/:id", bg.queryByID, mid.Authenticate(a)).
+		Doc("Get a booking").
+		Returns(http.StatusOK, booking.Info{}).
+		Fails(http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound)
+	app.Handle(http.MethodPost, "/v1/bookings", bg.create, mid.Authenticate(a), opts.rateLimit(log, "bookings", mid.BySubject)).
+		Doc("Book a slot").
+		Accepts(booking.NewBooking{}).
+		Returns(http.StatusCreated, booking.Info{}).
+		Fails(http.StatusBadRequest, http.StatusNotFound, http.StatusConflict)
+	app.Handle(http.MethodPut, "/v1/bookings/:id/status", bg.updateStatus, mid.Authenticate(a)).
+		Doc("Confirm or cancel a booking").
+		Accepts(booking.UpdateStatus{}).
+		Returns(http.StatusOK, booking.Info{}).
+		Fails(http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict)
+
+	// Register the class timetable and instructor endpoints.
+	scg := scheduleGroup{
+		schedule: schedule.New(log, db),
+	}
+
+	app.Handle(http.MethodGet, "/v1/studio/:id/schedule", scg.timetable).
+		Doc("List the classes of a studio in a date range").
+		Cache("public, max-age=300").
+		Query("from", "First day, YYYY-MM-DD").
+		Query("to", "Last day, YYYY-MM-DD").
+		Returns(http.StatusOK, []schedule.Occurrence{}).
+		Fails(http.StatusBadRequest)
+	app.Handle(http.MethodGet, "/v1/studio/:id/schedules", scg.query).
+		Doc("List the schedules of a studio").
+		Cache("public, max-age=300").
+		Returns(http.StatusOK, []schedule.Info{}).
+		Fails(http.StatusBadRequest)
+	app.Handle(http.MethodPost, "/v1/studio/:id/schedules", scg.create, mid.Authenticate(a)).
+		Doc("Add a schedule to a studio").
+		Accepts(schedule.NewSchedule{}).
+		Returns(http.StatusCreated, schedule.Info{}).
+		Fails(http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound)
+	app.Handle(http.MethodDelete, "/v1/schedules/:id", scg.delete, mid.Authenticate(a)).
+		Doc("Remove a schedule").
+		Returns(http.StatusNoContent, nil).
+		Fails(http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound)
+	app.Handle(http.MethodGet, "/v1/studio/:id/instructors", scg.queryInstructors).
+		Doc("List the instructors of a studio").
+		Cache("public, max-age=300").
+		Returns(http.StatusOK, []schedule.Instructor{}).
+		Fails(http.StatusBadRequest)
+	app.Handle(http.MethodPost, "/v1/studio/:id/instructors", scg.createInstructor, mid.Authenticate(a)).
+		Doc("Add an instructor to a studio").
+		Accepts(schedule.NewInstructor{}).
+		Returns(http.StatusCreated, schedule.Instructor{}).
+		Fails(http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound)
+	app.Handle(http.MethodGet, "/v1/instructors/:id", scg.queryInstructorByID).
+		Doc("Get an instructor").
+		Cache("public, max-age=300").
+		Returns(http.StatusOK, schedule.Instructor{}).
+		Fails(http.StatusBadRequest, http.StatusNotFound)
+	app.Handle(http.MethodDelete, "/v1/instructors/:id", scg.deleteInstructor, mid.Authenticate(a)).
+		Doc("Remove an instructor").
+		Returns(http.StatusNoContent, nil).
+		Fails(http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound)
+
+	// Register the brand endpoints. Brand admins manage their own brand and
+	// its studios.
+	brg := brandGroup{
+		brand:  brand.New(log, db),
+		studio: sg.studio,
+	}
+
+	app.Handle(http.MethodGet, "/v1/brands", brg.query).
+		Doc("List brands").
+		Cache("public, max-age=300").
+		Query("page", "Page number").
+		Query("rows", "Rows per page").
+		Returns(http.StatusOK, []brand.Info{}).
+		Fails(http.StatusBadRequest)
+	app.Handle(http.MethodGet, "/v1/brands/:id", brg.queryByID).
+		Doc("Get a brand").
+		Cache("public, max-age=300").
+		Returns(http.StatusOK, brand.Info{}).
+		Fails(http.StatusBadRequest, http.StatusNotFound)
+	app.Handle(http.MethodGet, "/v1/brands/:id/studios", brg.queryStudios).
+		Doc("List the studios of a brand").
+		Cache("public, max-age=60").
+		Query("page", "Page number").
+		Query("rows", "Rows per page").
+		Returns(http.StatusOK, []studio.Info{}).
+		Fails(http.StatusBadRequest, http.StatusNotFound)
+	app.Handle(http.MethodPost, "/v1/brands", brg.create, mid.Authenticate(a), mid.Authorize(auth.RoleAdmin)).
+		Doc("Create a brand").
+		Accepts(brand.NewBrand{}).
+		Returns(http.StatusCreated, brand.Info{}).
+		Fails(http.StatusBadRequest)
+	app.Handle(http.MethodPut, "/v1/brands/:id", brg.update, mid.Authenticate(a)).
+		Doc("Update a brand").
+		Accepts(brand.UpdateBrand{}).
+		Returns(http.StatusOK, brand.Info{}).
+		Fails(http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound)
+	app.Handle(http.MethodDelete, "/v1/brands/:id", brg.delete, mid.Authenticate(a), mid.Authorize(auth.RoleAdmin)).
+		Doc("Delete a brand and detach its studios").
+		Returns(http.StatusNoContent, nil).
+		Fails(http.StatusBadRequest, http.StatusNotFound)
+	app.Handle(http.MethodPut, "/v1/brands/:id/admins", brg.setAdmins, mid.Authenticate(a), mid.Authorize(auth.RoleAdmin)).
+		Doc("Replace the admins of a brand").
+		Accepts(adminSet{}).
+		Returns(http.StatusOK, brand.Info{}).
+		Fails(http.StatusBadRequest, http.StatusNotFound)
+	app.Handle(http.MethodPut, "/v1/brands/:id/studios/:studioID", brg.addStudio, mid.Authenticate(a)).
+		Doc("Add a studio to a brand").
+		Returns(http.StatusOK, studio.Info{}).
+		Fails(http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound)
+	app.Handle(http.MethodDelete, "/v1/brands/:id/studios/:studioID", brg.removeStudio, mid.Authenticate(a)).
+		Doc("Take a studio out of a brand").
+		Returns(http.StatusOK, studio.Info{}).
+		Fails(http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound)
+
+	// Register the duplicate studio endpoints for admins.
+	mg := mergeGroup{
+		studio:   sg.studio,
+		favorite: fg.favorite,
+		booking:  bg.booking,
+		schedule: scg.schedule,
+	}
+
+	app.Handle(http.MethodGet, "/v1/admin/studio/duplicates", mg.duplicates, mid.Authenticate(a), mid.Authorize(auth.RoleAdmin)).
+		Doc("List likely duplicate studios").
+		Query("threshold", "Lowest score reported, between 0 and 1").
+		Query("limit", "Most pairs reported").
+		Returns(http.StatusOK, []studio.Duplicate{}).
+		Fails(http.StatusBadRequest)
+	app.Handle(http.MethodPost, "/v1/admin/studio/merge", mg.merge, mid.Authenticate(a), mid.Authorize(auth.RoleAdmin)).
+		Doc("Merge a duplicate studio into another").
+		Accepts(studio.MergeStudios{}).
+		Returns(http.StatusOK, mergeResult{}).
+		Fails(http.StatusBadRequest, http.StatusNotFound, http.StatusConflict)
+
+	// Register the iCalendar feeds.
+	cal := calendarGroup{
+		studio:     sg.studio,
+		schedule:   scg.schedule,
+		booking:    bg.booking,
+		feedSecret: opts.feedSecret,
+	}
+
+	app.Handle(http.MethodGet, "/v1/studio/:id/calendar.ics", cal.studioFeed).
+		Doc("iCalendar feed of the classes of a studio").
+		ReturnsRaw(http.StatusOK, "text/calendar").
+		Fails(http.StatusBadRequest, http.StatusNotFound)
+	if opts.feedSecret != "" {
+		app.Handle(http.MethodGet, "/v1/users/:id/calendar/url", cal.feedURL, mid.Authenticate(a)).
+			Doc("Get the private calendar feed address of a user").
+			Returns(http.StatusOK, feedLink{}).
+			Fails(http.StatusBadRequest, http.StatusForbidden)
+		app.Handle(http.MethodGet, "/v1/users/:id/calendar/:token", cal.userFeed).
+			Doc("iCalendar feed of the bookings of a user").
+			ReturnsRaw(http.StatusOK, "text/calendar").
+			Fails(http.StatusNotFound)
+	}
+
+	// Register the studio taxonomy endpoints.
+	tg := tagGroup{
+		tag:    tag.New(log, db),
+		studio: sg.studio,
+	}
+
+	app.Handle(http.MethodGet, "/v1/tags", tg.query).
+		Doc("List tags").
+		Cache("public, max-age=300").
+		Query("category", "Tag category").
+		Returns(http.StatusOK, []tag.Info{})
+	app.Handle(http.MethodGet, "/v1/tags/counts", tg.counts).
+		Doc("List tags with the number of studios carrying them").
+		Cache("public, max-age=300").
+		Query("category", "Tag category").
+		Returns(http.StatusOK, []tag.Count{})
+	app.Handle(http.MethodGet, "/v1/tags/:id", tg.queryByID).
+		Doc("Get a tag").
+		Cache("public, max-age=300").
+		Returns(http.StatusOK, tag.Info{}).
+		Fails(http.StatusBadRequest, http.StatusNotFound)
+	app.Handle(http.MethodPost, "/v1/tags", tg.create, mid.Authenticate(a), mid.Authorize(auth.RoleAdmin)).
+		Doc("Create a tag").
+		Accepts(tag.NewTag{}).
+		Returns(http.StatusCreated, tag.Info{}).
+		Fails(http.StatusBadRequest, http.StatusConflict)
+	app.Handle(http.MethodPut, "/v1/tags/:id", tg.update, mid.Authenticate(a), mid.Authorize(auth.RoleAdmin)).
+		Doc("Update a tag").
+		Accepts(tag.UpdateTag{}).
+		Returns(http.StatusNoContent, nil).
+		Fails(http.StatusBadRequest, http.StatusNotFound)
+	app.Handle(http.MethodDelete, "/v1/tags/:id", tg.delete, mid.Authenticate(a), mid.Authorize(auth.RoleAdmin)).
+		Doc("Delete a tag and remove it from studios").
+		Returns(http.StatusNoContent, nil).
+		Fails(http.StatusBadRequest, http.StatusNotFound)
+
+	// Register the audit trail endpoint.
+	ag := auditGroup{
+		audit: audit.New(log, db),
+	}
+
+	app.Handle(http.MethodGet, "/v1/audit", ag.query, mid.Authenticate(a), mid.Authorize(auth.RoleAdmin)).
+		Doc("Search the audit trail").
+		Query("entity", "Entity type").
+		Query("entity_id", "Entity id").
+		Query("actor_id", "User who made the change").
+		Query("action", "Action taken").
+		Query("from", "Start of the range, RFC 3339").
+		Query("to", "End of the range, RFC 3339").
+		Query("page", "Page number").
+		Query("rows", "Rows per page").
+		Returns(http.StatusOK, []audit.Info{}).
+		Fails(http.StatusBadRequest)
+
+	// Register the API documentation. The document is public and a page to
+	// browse it is served on the debug port.
+	dg := docsGroup{
+		app:   app,
+		build: build,
+	}
+
+	app.Handle(http.MethodGet, "/v1/openapi.json", dg.spec).
+		Doc("OpenAPI document of this API").
+		Cache("public, max-age=3600").
+		ReturnsRaw(http.StatusOK, "application/json")
+	app.HandleDebug(http.MethodGet, "/openapi.json", dg.spec)
+	app.HandleDebug(http.MethodGet, "/docs", web.DocsPage("Drop API", "/debug/openapi.json"))
 
 	// Accept CORS 'OPTIONS' preflight requests if config has been provided.
 	// Don't forget to apply the CORS middleware to the routes that need it.
@@ -85,3 +628,148 @@ func API(build string, shutdown chan os.Signal, log *log.Logger, a *auth.Auth, d
 
 	return app
 }
+
+// pagePath holds the /:page/:rows pagination parameters of listing routes.
+type pagePath struct {
+	Page int `param:"page" validate:"min=1"`
+	Rows int `param:"rows" validate:"min=1"`
+}
+
+// paging holds the optional ?page= and ?rows= pagination parameters used by
+// routes whose path is already taken by an id.
+type paging struct {
+	Page int `query:"page" default:"1" validate:"min=1"`
+	Rows int `query:"rows" default:"20" validate:"min=1"`
+}
+
+// pageQuery reads the optional ?page= and ?rows= pagination parameters used
+// by routes whose path is already taken by an id.
+func pageQuery(r *http.Request) (int, int, error) {
+	var p paging
+	if err := web.DecodeQuery(r, &p); err != nil {
+		return 0, 0, err
+	}
+
+	return p.Page, p.Rows, nil
+}
+
+// includeDeleted reports whether ?include_deleted=true was asked for. Only
+// admins may see deleted records.
+func includeDeleted(ctx context.Context, r *http.Request) (bool, error) {
+	var q struct {
+		IncludeDeleted bool `query:"include_deleted"`
+	}
+	if err := web.DecodeQuery(r, &q); err != nil {
+		return false, err
+	}
+	if !q.IncludeDeleted {
+		return false, nil
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok || !claims.Authorized(auth.RoleAdmin) {
+		return false, validate.NewRequestError(errors.New("only admins may include deleted records"), http.StatusForbidden)
+	}
+
+	return true, nil
+}
+
+// etag renders the version of a document as a strong entity tag.
+func etag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// studioTag renders the version of a studio, along with the time its brand
+// last changed when it has one, as a strong entity tag. ifMatch only reads
+// the version back.
+func studioTag(std studio.Info) string {
+	tag := strconv.Itoa(std.Version)
+	if !std.BrandUpdated.IsZero() {
+		tag += "-" + strconv.FormatInt(std.BrandUpdated.UnixNano()/int64(time.Millisecond), 10)
+	}
+	return strconv.Quote(tag)
+}
+
+// lastModified sets the Last-Modified header from the time a document was
+// last updated.
+func lastModified(w http.ResponseWriter, updated time.Time) {
+	if !updated.IsZero() {
+		w.Header().Set("Last-Modified", updated.UTC().Format(http.TimeFormat))
+	}
+}
+
+// ifMatch reads the document version a write is conditional on from the
+// If-Match header. Writes without one are refused with 428 so clients can't
+// overwrite changes they haven't seen, and anything but a single strong tag
+// from etag or studioTag, in any representation, fails with 412. For
+// `If-Match: *` wildcard is set and the caller resolves the current version.
+func ifMatch(r *http.Request) (version int, wildcard bool, err error) {
+	h := strings.TrimSpace(r.Header.Get("If-Match"))
+	if h == "" {
+		return 0, false, validate.NewRequestError(errors.New("If-Match header required"), http.StatusPreconditionRequired)
+	}
+	if h == "*" {
+		return 0, true, nil
+	}
+
+	s, err := strconv.Unquote(web.BaseTag(h))
+	if err != nil {
+		return 0, false, validate.NewRequestError(errors.New("precondition failed"), http.StatusPreconditionFailed)
+	}
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		s = s[:i]
+	}
+	version, err = strconv.Atoi(s)
+	if err != nil || version < 0 {
+		return 0, false, validate.NewRequestError(errors.New("precondition failed"), http.StatusPreconditionFailed)
+	}
+
+	return version, false, nil
+}
+
+// patchFunc reads the body of a PATCH request and returns a function applying
+// it to a JSON document in the format named by the Content-Type, which must
+// be a JSON Merge Patch or a JSON Patch.
+func patchFunc(w http.ResponseWriter, r *http.Request) (func(doc []byte) ([]byte, error), error) {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mt != patch.MergePatchType && mt != patch.JSONPatchType) {
+		w.Header().Set("Accept-Patch", patch.MergePatchType+", "+patch.JSONPatchType)
+		return nil, validate.NewRequestError(fmt.Errorf("unsupported patch format: %s", r.Header.Get("Content-Type")), http.StatusUnsupportedMediaType)
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading patch")
+	}
+
+	if mt == patch.MergePatchType {
+		return func(doc []byte) ([]byte, error) {
+			return patch.Merge(doc, body)
+		}, nil
+	}
+	return func(doc []byte) ([]byte, error) {
+		return patch.Apply(doc, body)
+	}, nil
+}
+
+// exportEncoder reads the ?format= and comma separated ?fields= of an export
+// route. The format defaults to JSON and the fields to all allowed ones.
+func exportEncoder(r *http.Request, allowed []string) (export.Encoder, error) {
+	var q struct {
+		Format string   `query:"format"`
+		Fields []string `query:"fields"`
+	}
+	if err := web.DecodeQuery(r, &q); err != nil {
+		return export.Encoder{}, err
+	}
+	if q.Format == "" {
+		q.Format = export.FormatJSON
+	}
+
+	enc, err := export.NewEncoder(q.Format, q.Fields, allowed)
+	if err != nil {
+		return export.Encoder{}, validate.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	return enc, nil
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nextwavedevs/drop/business/auth"
+	"github.com/nextwavedevs/drop/business/data/booking"
+	"github.com/nextwavedevs/drop/business/data/favorite"
+	"github.com/nextwavedevs/drop/business/data/schedule"
+	"github.com/nextwavedevs/drop/business/data/studio"
+	"github.com/nextwavedevs/drop/business/validate"
+	"github.com/nextwavedevs/drop/foundation/web"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// mergeGroup finds duplicate studios and folds them together. Merging moves
+// records owned by several packages so it is orchestrated here.
+type mergeGroup struct {
+	studio   studio.Studio
+	favorite favorite.Favorite
+	booking  booking.Booking
+	schedule schedule.Schedule
+}
+
+// mergeResult reports a merged studio and how many related records were
+// moved onto it.
+type mergeResult struct {
+	Studio    studio.Info `json:"studio"`
+	Favorites int         `json:"favorites_moved"`
+	Bookings  int64       `json:"bookings_moved"`
+	Schedules int64       `json:"schedules_moved"`
+}
+
+// duplicateQuery holds the options of the duplicate studio report.
+type duplicateQuery struct {
+	Threshold *float64 `query:"threshold" validate:"omitempty,gt=0,lte=1"`
+	Limit     int      `query:"limit" default:"100" validate:"min=1"`
+}
+
+// duplicates lists candidate pairs of duplicate studios, best match first.
+// The ?threshold= score between 0 and 1 and the ?limit= on pairs are optional.
+func (mg mergeGroup) duplicates(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.mergeGroup.duplicates")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	var dq duplicateQuery
+	if err := web.DecodeQuery(r, &dq); err != nil {
+		return err
+	}
+
+	threshold := studio.DuplicateThreshold
+	if dq.Threshold != nil {
+		threshold = *dq.Threshold
+	}
+
+	dups, err := mg.studio.Duplicates(ctx, v.TraceID, threshold, dq.Limit)
+	if err != nil {
+		return errors.Wrap(err, "unable to query for duplicates")
+	}
+
+	return web.Respond(ctx, w, dups, http.StatusOK)
+}
+
+// merge folds one studio into another and moves its favourites, bookings and
+// timetable across. A failed merge can be retried with the same payload.
+func (mg mergeGroup) merge(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.mergeGroup.merge")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var ms studio.MergeStudios
+	if err := web.Decode(r, &ms); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	std, err := mg.studio.Merge(ctx, v.TraceID, claims, ms, v.Now)
+	if err != nil {
+		switch errors.Cause(err) {
+		case studio.ErrInvalidID:
+			return validate.NewRequestError(err, http.StatusBadRequest)
+		case studio.ErrNotFound:
+			return validate.NewRequestError(err, http.StatusNotFound)
+		case studio.ErrForbidden:
+			return validate.NewRequestError(err, http.StatusForbidden)
+		case studio.ErrVersionMismatch:
+			return validate.NewRequestError(err, http.StatusConflict)
+		default:
+			return errors.Wrapf(err, "Keep: %s Merge: %s", ms.KeepID, ms.MergeID)
+		}
+	}
+
+	result := mergeResult{
+		Studio: std,
+	}
+
+	if result.Favorites, err = mg.favorite.Repoint(ctx, v.TraceID, ms.MergeID, ms.KeepID, v.Now); err != nil {
+		return errors.Wrap(err, "moving favorites")
+	}
+	if result.Bookings, err = mg.booking.Repoint(ctx, v.TraceID, ms.MergeID, ms.KeepID); err != nil {
+		return errors.Wrap(err, "moving bookings")
+	}
+	if result.Schedules, err = mg.schedule.Repoint(ctx, v.TraceID, ms.MergeID, ms.KeepID); err != nil {
+		return errors.Wrap(err, "moving schedules")
+	}
+
+	// Pick up the favourite count recounted after the move.
+	if result.Studio, err = mg.studio.QueryByID(ctx, v.TraceID, ms.KeepID, false); err != nil {
+		return errors.Wrapf(err, "ID: %s", ms.KeepID)
+	}
+
+	return web.Respond(ctx, w, result, http.StatusOK)
+}
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/nextwavedevs/drop/business/auth"
+	"github.com/nextwavedevs/drop/business/data/schedule"
+	"github.com/nextwavedevs/drop/business/validate"
+	"github.com/nextwavedevs/drop/foundation/web"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type scheduleGroup struct {
+	schedule schedule.Schedule
+}
+
+// timetable renders the occurrences of a studio's classes. The range is
+// given by ?from= and ?to= as RFC 3339 times or YYYY-MM-DD dates and
+// defaults to the coming week.
+func (sg scheduleGroup) timetable(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.scheduleGroup.timetable")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	from, to, err := dateRange(r, v.Now)
+	if err != nil {
+		return err
+	}
+
+	params := web.Params(r)
+	occs, err := sg.schedule.Timetable(ctx, v.TraceID, params["id"], from, to)
+	if err != nil {
+		return scheduleError(err, "ID: %s", params["id"])
+	}
+
+	return web.Respond(ctx, w, occs, http.StatusOK)
+}
+
+func (sg scheduleGroup) query(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.scheduleGroup.query")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	params := web.Params(r)
+	schedules, err := sg.schedule.Query(ctx, v.TraceID, params["id"])
+	if err != nil {
+		return scheduleError(err, "ID: %s", params["id"])
+	}
+
+	return web.Respond(ctx, w, schedules, http.StatusOK)
+}
+
+func (sg scheduleGroup) create(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.scheduleGroup.create")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var ns schedule.NewSchedule
+	if err := web.Decode(r, &ns); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	params := web.Params(r)
+	sch, err := sg.schedule.Create(ctx, v.TraceID, claims, params["id"], ns, v.Now)
+	if err != nil {
+		return scheduleError(err, "ID: %s Schedule: %+v", params["id"], &ns)
+	}
+
+	return web.Respond(ctx, w, sch, http.StatusCreated)
+}
+
+func (sg scheduleGroup) delete(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.scheduleGroup.delete")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	params := web.Params(r)
+	if err := sg.schedule.Delete(ctx, v.TraceID, claims, params["id"]); err != nil {
+		return scheduleError(err, "ID: %s", params["id"])
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+func (sg scheduleGroup) queryInstructors(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.scheduleGroup.queryInstructors")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	params := web.Params(r)
+	instructors, err := sg.schedule.QueryInstructors(ctx, v.TraceID, params["id"])
+	if err != nil {
+		return scheduleError(err, "ID: %s", params["id"])
+	}
+
+	return web.Respond(ctx, w, instructors, http.StatusOK)
+}
+
+func (sg scheduleGroup) queryInstructorByID(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.scheduleGroup.queryInstructorByID")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	params := web.Params(r)
+	ins, err := sg.schedule.QueryInstructorByID(ctx, v.TraceID, params["id"])
+	if err != nil {
+		return scheduleError(err, "ID: %s", params["id"])
+	}
+
+	return web.Respond(ctx, w, ins, http.StatusOK)
+}
+
+func (sg scheduleGroup) createInstructor(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.scheduleGroup.createInstructor")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var ni schedule.NewInstructor
+	if err := web.Decode(r, &ni); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	params := web.Params(r)
+	ins, err := sg.schedule.CreateInstructor(ctx, v.TraceID, claims, params["id"], ni, v.Now)
+	if err != nil {
+		return scheduleError(err, "ID: %s Instructor: %+v", params["id"], &ni)
+	}
+
+	return web.Respond(ctx, w, ins, http.StatusCreated)
+}
+
+func (sg scheduleGroup) deleteInstructor(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.scheduleGroup.deleteInstructor")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	params := web.Params(r)
+	if err := sg.schedule.DeleteInstructor(ctx, v.TraceID, claims, params["id"]); err != nil {
+		return scheduleError(err, "ID: %s", params["id"])
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// scheduleError maps the errors of the schedule package onto request errors.
+func scheduleError(err error, format string, args ...interface{}) error {
+	switch errors.Cause(err) {
+	case schedule.ErrInvalidID, schedule.ErrInvalidRange:
+		return validate.NewRequestError(err, http.StatusBadRequest)
+	case schedule.ErrNotFound:
+		return validate.NewRequestError(err, http.StatusNotFound)
+	case schedule.ErrForbidden:
+		return validate.NewRequestError(err, http.StatusForbidden)
+	default:
+		return errors.Wrapf(err, format, args...)
+	}
+}
+
+// dateRange reads the ?from= and ?to= parameters of calendar style routes.
+// Without from the range starts at the beginning of today in UTC, and
+// without to it spans seven days.
+func dateRange(r *http.Request, now time.Time) (time.Time, time.Time, error) {
+	var q struct {
+		From time.Time `query:"from"`
+		To   time.Time `query:"to"`
+	}
+	if err := web.DecodeQuery(r, &q); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	from := q.From
+	if from.IsZero() {
+		from = now.UTC().Truncate(24 * time.Hour)
+	}
+
+	to := q.To
+	if to.IsZero() {
+		to = from.AddDate(0, 0, 7)
+	}
+
+	return from, to, nil
+}
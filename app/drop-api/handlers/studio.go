@@ -3,13 +3,16 @@ package handlers
 import (
 	"context"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
-	"strconv"
+	"strings"
 
 	"github.com/nextwavedevs/drop/business/auth"
 	"github.com/nextwavedevs/drop/business/data/studio"
+	"github.com/nextwavedevs/drop/business/data/tag"
 	"github.com/nextwavedevs/drop/business/validate"
-	"github.com/nextwavedevs/drop/foundation/database"
+	"github.com/nextwavedevs/drop/foundation/patch"
 	"github.com/nextwavedevs/drop/foundation/web"
 	"github.com/pkg/errors"
 	"go.opentelemetry.io/otel/trace"
@@ -19,6 +22,27 @@ type studioGroup struct {
 	studio studio.Studio
 }
 
+// tagSet is the set of tags assigned to a studio.
+type tagSet struct {
+	Tags []string `json:"tags"`
+}
+
+// ownerSet is the set of users allowed to manage a studio.
+type ownerSet struct {
+	Owners []string `json:"owners"`
+}
+
+// locationPath holds the parameters of the studio listing for a city.
+type locationPath struct {
+	pagePath
+	City string `param:"city"`
+}
+
+// redirect points at the studio a merged studio now lives on as.
+type redirect struct {
+	MergedInto string `json:"merged_into"`
+}
+
 func (sg studioGroup) query(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.studioGroup.query")
 	defer span.End()
@@ -28,22 +52,25 @@ func (sg studioGroup) query(ctx context.Context, w http.ResponseWriter, r *http.
 		return web.NewShutdownError("web value missing from context")
 	}
 
-	params := web.Params(r)
-	pageNumber, err := strconv.Atoi(params["page"])
-	if err != nil {
-		return validate.NewRequestError(fmt.Errorf("invalid page format: %s", params["page"]), http.StatusBadRequest)
+	var pp pagePath
+	if err := web.DecodeQuery(r, &pp); err != nil {
+		return err
 	}
-	rowsPerPage, err := strconv.Atoi(params["rows"])
+
+	qf, err := studioFilter(ctx, r)
 	if err != nil {
-		return validate.NewRequestError(fmt.Errorf("invalid rows format: %s", params["rows"]), http.StatusBadRequest)
+		return err
 	}
 
-	users, err := sg.studio.Query(ctx, v.TraceID, pageNumber, rowsPerPage)
+	studios, err := sg.studio.Query(ctx, v.TraceID, pp.Page, pp.Rows, qf)
 	if err != nil {
-		return errors.Wrap(err, "unable to query for users")
+		return errors.Wrap(err, "unable to query for studios")
+	}
+	if err := sg.studio.Inherit(ctx, v.TraceID, studios...); err != nil {
+		return errors.Wrap(err, "unable to inherit brand details")
 	}
 
-	return web.Respond(ctx, w, users, http.StatusOK)
+	return web.Respond(ctx, w, studios, http.StatusOK)
 }
 
 func (sg studioGroup) queryByID(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
@@ -56,20 +83,43 @@ func (sg studioGroup) queryByID(ctx context.Context, w http.ResponseWriter, r *h
 		return web.NewShutdownError("web value missing from context")
 	}
 
+	deleted, err := includeDeleted(ctx, r)
+	if err != nil {
+		return err
+	}
+
 	params := web.Params(r)
-	usr, err := sg.studio.QueryByID(ctx, v.TraceID, params["id"])
+	std, err := sg.studio.QueryByID(ctx, v.TraceID, params["id"], deleted)
 	if err != nil {
 		switch errors.Cause(err) {
-		case database.ErrInvalidID:
+		case studio.ErrInvalidID:
 			return validate.NewRequestError(err, http.StatusBadRequest)
-		case database.ErrNotFound:
+		case studio.ErrNotFound:
+
+			// Studios merged into another point callers at the one kept.
+			if to, err := sg.studio.MergedInto(ctx, v.TraceID, params["id"]); err == nil {
+				w.Header().Set("Location", "/v1/studio/"+to)
+				return web.Respond(ctx, w, redirect{to}, http.StatusMovedPermanently)
+			}
 			return validate.NewRequestError(err, http.StatusNotFound)
 		default:
 			return errors.Wrapf(err, "ID: %s", params["id"])
 		}
 	}
 
-	return web.Respond(ctx, w, usr, http.StatusOK)
+	if err := sg.studio.Inherit(ctx, v.TraceID, &std); err != nil {
+		return errors.Wrap(err, "unable to inherit brand details")
+	}
+
+	// The brand fields filled in by Inherit change without the studio's
+	// version moving, so the brand's last change is part of the tag.
+	w.Header().Set("ETag", studioTag(std))
+	modified := std.Updated_at
+	if std.BrandUpdated.After(modified) {
+		modified = std.BrandUpdated
+	}
+	lastModified(w, modified)
+	return web.Respond(ctx, w, std, http.StatusOK)
 }
 
 func (sg studioGroup) queryByLocation(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
@@ -82,24 +132,25 @@ func (sg studioGroup) queryByLocation(ctx context.Context, w http.ResponseWriter
 		return web.NewShutdownError("web value missing from context")
 	}
 
-	params := web.Params(r)
-	pageNumber, err := strconv.Atoi(params["page"])
-	if err != nil {
-		return validate.NewRequestError(fmt.Errorf("invalid page format: %s", params["page"]), http.StatusBadRequest)
+	var lp locationPath
+	if err := web.DecodeQuery(r, &lp); err != nil {
+		return err
 	}
-	rowsPerPage, err := strconv.Atoi(params["rows"])
+
+	qf, err := studioFilter(ctx, r)
 	if err != nil {
-		return validate.NewRequestError(fmt.Errorf("invalid rows format: %s", params["rows"]), http.StatusBadRequest)
+		return err
 	}
 
-	city := params["city"]
-
-	users, err := sg.studio.QueryByLocation(ctx, v.TraceID, pageNumber, rowsPerPage, city)
+	studios, err := sg.studio.QueryByLocation(ctx, v.TraceID, lp.Page, lp.Rows, lp.City, qf)
 	if err != nil {
-		return errors.Wrap(err, "unable to query for users")
+		return errors.Wrap(err, "unable to query for studios")
+	}
+	if err := sg.studio.Inherit(ctx, v.TraceID, studios...); err != nil {
+		return errors.Wrap(err, "unable to inherit brand details")
 	}
 
-	return web.Respond(ctx, w, users, http.StatusOK)
+	return web.Respond(ctx, w, studios, http.StatusOK)
 }
 
 func (sg studioGroup) create(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
@@ -125,6 +176,101 @@ func (sg studioGroup) create(ctx context.Context, w http.ResponseWriter, r *http
 	return web.Respond(ctx, w, std, http.StatusCreated)
 }
 
+// importStudios creates or updates studios from the rows of a CSV (text/csv)
+// or NDJSON (application/x-ndjson) request body and reports the outcome of
+// every row.
+func (sg studioGroup) importStudios(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.studioGroup.importStudios")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	var rows studio.RowReader
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mt {
+	case "text/csv":
+		var err error
+		if rows, err = studio.CSVRows(r.Body); err != nil {
+			return validate.NewRequestError(err, http.StatusBadRequest)
+		}
+	case "application/x-ndjson", "application/ndjson":
+		rows = studio.NDJSONRows(r.Body)
+	default:
+		return validate.NewRequestError(fmt.Errorf("unsupported import format: %s", r.Header.Get("Content-Type")), http.StatusUnsupportedMediaType)
+	}
+
+	report, err := sg.studio.Import(ctx, v.TraceID, rows, v.Now)
+	if err != nil {
+		return errors.Wrap(err, "unable to import studios")
+	}
+
+	return web.Respond(ctx, w, report, http.StatusOK)
+}
+
+// exportBatch is how many exported studios have their brand fields filled
+// in at a time.
+const exportBatch = 100
+
+// exportStudios streams the studios matching the listing filters and an
+// optional ?city= in the ?format= asked for, with the fields they inherit
+// from their brands filled in.
+func (sg studioGroup) exportStudios(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.studioGroup.exportStudios")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	enc, err := exportEncoder(r, studio.ExportFields)
+	if err != nil {
+		return err
+	}
+
+	qf, err := studioFilter(ctx, r)
+	if err != nil {
+		return err
+	}
+	qf.Locality = r.URL.Query().Get("city")
+
+	w.Header().Set("Content-Disposition", `attachment; filename="studios`+enc.Extension()+`"`)
+	return web.RespondStream(ctx, w, enc.ContentType(), http.StatusOK, func(out io.Writer) error {
+		ew := enc.NewWriter(out)
+		batch := make([]*studio.Info, 0, exportBatch)
+		flush := func() error {
+			if err := sg.studio.Inherit(ctx, v.TraceID, batch...); err != nil {
+				return errors.Wrap(err, "inheriting brand fields")
+			}
+			for _, std := range batch {
+				if err := ew.Write(*std); err != nil {
+					return err
+				}
+			}
+			batch = batch[:0]
+			return nil
+		}
+		write := func(std studio.Info) error {
+			if batch = append(batch, &std); len(batch) < exportBatch {
+				return nil
+			}
+			return flush()
+		}
+		if err := sg.studio.Export(ctx, v.TraceID, qf, write); err != nil {
+			return errors.Wrap(err, "exporting studios")
+		}
+		if err := flush(); err != nil {
+			return errors.Wrap(err, "exporting studios")
+		}
+		return ew.Close()
+	})
+}
+
 func (sg studioGroup) update(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.studioGroup.update")
@@ -135,24 +281,92 @@ func (sg studioGroup) update(ctx context.Context, w http.ResponseWriter, r *http
 		return web.NewShutdownError("web value missing from context")
 	}
 
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
 	var upd studio.UpdateStudio
 	if err := web.Decode(r, &upd); err != nil {
 		return errors.Wrap(err, "unable to decode payload")
 	}
 
 	params := web.Params(r)
-	err := sg.studio.Update(ctx, v.TraceID, params["id"], upd, v.Now)
+	version, err := sg.version(ctx, v.TraceID, r, params["id"])
+	if err != nil {
+		return err
+	}
+
+	std, err := sg.studio.Update(ctx, v.TraceID, claims, params["id"], upd, version, v.Now)
 	if err != nil {
 		switch errors.Cause(err) {
-		case database.ErrInvalidID:
+		case studio.ErrInvalidID:
 			return validate.NewRequestError(err, http.StatusBadRequest)
-		case database.ErrNotFound:
+		case studio.ErrNotFound:
 			return validate.NewRequestError(err, http.StatusNotFound)
+		case studio.ErrForbidden:
+			return validate.NewRequestError(err, http.StatusForbidden)
+		case studio.ErrVersionMismatch:
+			return validate.NewRequestError(err, http.StatusPreconditionFailed)
 		default:
 			return errors.Wrapf(err, "ID: %s  User: %+v", params["id"], &upd)
 		}
 	}
 
+	w.Header().Set("ETag", etag(std.Version))
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// patch applies a JSON Merge Patch or JSON Patch to a studio. A patch that
+// can't be applied is unprocessable and a failed test operation conflicts
+// with the current state of the studio.
+func (sg studioGroup) patch(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.studioGroup.patch")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	apply, err := patchFunc(w, r)
+	if err != nil {
+		return err
+	}
+
+	params := web.Params(r)
+	version, err := sg.version(ctx, v.TraceID, r, params["id"])
+	if err != nil {
+		return err
+	}
+
+	std, err := sg.studio.Patch(ctx, v.TraceID, claims, params["id"], apply, version, v.Now)
+	if err != nil {
+		switch errors.Cause(err) {
+		case studio.ErrInvalidID:
+			return validate.NewRequestError(err, http.StatusBadRequest)
+		case studio.ErrNotFound:
+			return validate.NewRequestError(err, http.StatusNotFound)
+		case studio.ErrForbidden:
+			return validate.NewRequestError(err, http.StatusForbidden)
+		case studio.ErrVersionMismatch:
+			return validate.NewRequestError(err, http.StatusPreconditionFailed)
+		case patch.ErrInvalid:
+			return validate.NewRequestError(err, http.StatusUnprocessableEntity)
+		case patch.ErrTestFailed:
+			return validate.NewRequestError(err, http.StatusConflict)
+		default:
+			return errors.Wrapf(err, "ID: %s", params["id"])
+		}
+	}
+
+	w.Header().Set("ETag", etag(std.Version))
 	return web.Respond(ctx, w, nil, http.StatusNoContent)
 }
 
@@ -172,17 +386,169 @@ func (sg studioGroup) delete(ctx context.Context, w http.ResponseWriter, r *http
 	}
 
 	params := web.Params(r)
-	err := sg.studio.Delete(ctx, v.TraceID, claims, params["id"])
+	version, err := sg.version(ctx, v.TraceID, r, params["id"])
+	if err != nil {
+		return err
+	}
+
+	err = sg.studio.Delete(ctx, v.TraceID, claims, params["id"], version, v.Now)
+	if err != nil {
+		switch errors.Cause(err) {
+		case studio.ErrInvalidID:
+			return validate.NewRequestError(err, http.StatusBadRequest)
+		case studio.ErrNotFound:
+			return validate.NewRequestError(err, http.StatusNotFound)
+		case studio.ErrVersionMismatch:
+			return validate.NewRequestError(err, http.StatusPreconditionFailed)
+		default:
+			return errors.Wrapf(err, "ID: %s", params["id"])
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+func (sg studioGroup) setTags(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.studioGroup.setTags")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var req tagSet
+	if err := web.Decode(r, &req); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	params := web.Params(r)
+	tags, err := sg.studio.SetTags(ctx, v.TraceID, claims, params["id"], req.Tags, v.Now)
+	if err != nil {
+		switch errors.Cause(err) {
+		case studio.ErrInvalidID:
+			return validate.NewRequestError(err, http.StatusBadRequest)
+		case studio.ErrNotFound:
+			return validate.NewRequestError(err, http.StatusNotFound)
+		case studio.ErrForbidden:
+			return validate.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "ID: %s Tags: %v", params["id"], req.Tags)
+		}
+	}
+
+	req.Tags = tags
+	return web.Respond(ctx, w, req, http.StatusOK)
+}
+
+func (sg studioGroup) restore(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.studioGroup.restore")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	params := web.Params(r)
+	std, err := sg.studio.Restore(ctx, v.TraceID, params["id"], v.Now)
 	if err != nil {
 		switch errors.Cause(err) {
-		case database.ErrInvalidID:
+		case studio.ErrInvalidID:
 			return validate.NewRequestError(err, http.StatusBadRequest)
-		case database.ErrNotFound:
+		case studio.ErrNotFound:
 			return validate.NewRequestError(err, http.StatusNotFound)
 		default:
 			return errors.Wrapf(err, "ID: %s", params["id"])
 		}
 	}
 
+	return web.Respond(ctx, w, std, http.StatusOK)
+}
+
+// version reads the studio version a write is conditional on, resolving
+// `If-Match: *` to the current version.
+func (sg studioGroup) version(ctx context.Context, traceID string, r *http.Request, studioID string) (int, error) {
+	version, wildcard, err := ifMatch(r)
+	if err != nil || !wildcard {
+		return version, err
+	}
+
+	std, err := sg.studio.QueryByID(ctx, traceID, studioID, false)
+	if err != nil {
+		switch errors.Cause(err) {
+		case studio.ErrInvalidID:
+			return 0, validate.NewRequestError(err, http.StatusBadRequest)
+		case studio.ErrNotFound:
+			return 0, validate.NewRequestError(errors.New("precondition failed"), http.StatusPreconditionFailed)
+		default:
+			return 0, errors.Wrapf(err, "ID: %s", studioID)
+		}
+	}
+
+	return std.Version, nil
+}
+
+// studioQuery holds the listing filters of studio routes.
+type studioQuery struct {
+	Tags  []string `query:"tags"`
+	Match string   `query:"match"`
+}
+
+// studioFilter builds the listing filter from the query string. Tags are
+// given as ?tags=a,b and match any of them unless ?match=all is provided.
+func studioFilter(ctx context.Context, r *http.Request) (studio.QueryFilter, error) {
+	var sq studioQuery
+	if err := web.DecodeQuery(r, &sq); err != nil {
+		return studio.QueryFilter{}, err
+	}
+
+	qf := studio.QueryFilter{
+		Tags:     tag.NormalizeSlugs(sq.Tags),
+		MatchAll: strings.EqualFold(sq.Match, "all"),
+	}
+
+	var err error
+	if qf.IncludeDeleted, err = includeDeleted(ctx, r); err != nil {
+		return studio.QueryFilter{}, err
+	}
+
+	return qf, nil
+}
+
+func (sg studioGroup) setOwners(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.studioGroup.setOwners")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	var req ownerSet
+	if err := web.Decode(r, &req); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	params := web.Params(r)
+	if err := sg.studio.SetOwners(ctx, v.TraceID, params["id"], req.Owners, v.Now); err != nil {
+		switch errors.Cause(err) {
+		case studio.ErrInvalidID:
+			return validate.NewRequestError(err, http.StatusBadRequest)
+		case studio.ErrNotFound:
+			return validate.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "ID: %s Owners: %v", params["id"], req.Owners)
+		}
+	}
+
 	return web.Respond(ctx, w, nil, http.StatusNoContent)
 }
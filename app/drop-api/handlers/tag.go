@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nextwavedevs/drop/business/data/studio"
+	"github.com/nextwavedevs/drop/business/data/tag"
+	"github.com/nextwavedevs/drop/business/validate"
+	"github.com/nextwavedevs/drop/foundation/web"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type tagGroup struct {
+	tag    tag.Tag
+	studio studio.Studio
+}
+
+func (tg tagGroup) query(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.tagGroup.query")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	tags, err := tg.tag.Query(ctx, v.TraceID, r.URL.Query().Get("category"))
+	if err != nil {
+		return errors.Wrap(err, "unable to query for tags")
+	}
+
+	return web.Respond(ctx, w, tags, http.StatusOK)
+}
+
+// counts returns every tag in the taxonomy alongside the number of studios
+// carrying it so discovery pages can render facets.
+func (tg tagGroup) counts(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.tagGroup.counts")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	tags, err := tg.tag.Query(ctx, v.TraceID, r.URL.Query().Get("category"))
+	if err != nil {
+		return errors.Wrap(err, "unable to query for tags")
+	}
+
+	used, err := tg.studio.CountTags(ctx, v.TraceID)
+	if err != nil {
+		return errors.Wrap(err, "unable to count tags")
+	}
+
+	bySlug := make(map[string]int, len(used))
+	for _, c := range used {
+		bySlug[c.Slug] = c.Count
+	}
+
+	counts := make([]tag.Count, len(tags))
+	for i, t := range tags {
+		counts[i] = tag.Count{
+			Slug:     t.Slug,
+			Name:     t.Name,
+			Category: t.Category,
+			Count:    bySlug[t.Slug],
+		}
+	}
+
+	return web.Respond(ctx, w, counts, http.StatusOK)
+}
+
+func (tg tagGroup) queryByID(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.tagGroup.queryByID")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	params := web.Params(r)
+	t, err := tg.tag.QueryByID(ctx, v.TraceID, params["id"])
+	if err != nil {
+		switch errors.Cause(err) {
+		case tag.ErrInvalidID:
+			return validate.NewRequestError(err, http.StatusBadRequest)
+		case tag.ErrNotFound:
+			return validate.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "ID: %s", params["id"])
+		}
+	}
+
+	return web.Respond(ctx, w, t, http.StatusOK)
+}
+
+func (tg tagGroup) create(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.tagGroup.create")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	var nt tag.NewTag
+	if err := web.Decode(r, &nt); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	t, err := tg.tag.Create(ctx, v.TraceID, nt, v.Now)
+	if err != nil {
+		switch errors.Cause(err) {
+		case tag.ErrSlugExists:
+			return validate.NewRequestError(err, http.StatusConflict)
+		default:
+			return errors.Wrapf(err, "Tag: %+v", &nt)
+		}
+	}
+
+	return web.Respond(ctx, w, t, http.StatusCreated)
+}
+
+func (tg tagGroup) update(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.tagGroup.update")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	var upd tag.UpdateTag
+	if err := web.Decode(r, &upd); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	params := web.Params(r)
+	if err := tg.tag.Update(ctx, v.TraceID, params["id"], upd, v.Now); err != nil {
+		switch errors.Cause(err) {
+		case tag.ErrInvalidID:
+			return validate.NewRequestError(err, http.StatusBadRequest)
+		case tag.ErrNotFound:
+			return validate.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "ID: %s  Tag: %+v", params["id"], &upd)
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// delete removes a tag from the taxonomy and detaches it from every studio.
+func (tg tagGroup) delete(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.tagGroup.delete")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	params := web.Params(r)
+	t, err := tg.tag.Delete(ctx, v.TraceID, params["id"])
+	if err != nil {
+		switch errors.Cause(err) {
+		case tag.ErrInvalidID:
+			return validate.NewRequestError(err, http.StatusBadRequest)
+		case tag.ErrNotFound:
+			return validate.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "ID: %s", params["id"])
+		}
+	}
+
+	if err := tg.studio.RemoveTag(ctx, v.TraceID, t.Slug, v.Now); err != nil {
+		return errors.Wrapf(err, "detaching tag %s", t.Slug)
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
@@ -2,14 +2,13 @@ package handlers
 
 import (
 	"context"
-	"fmt"
+	"io"
 	"net/http"
-	"strconv"
 
 	"github.com/nextwavedevs/drop/business/auth"
 	"github.com/nextwavedevs/drop/business/data/user"
 	"github.com/nextwavedevs/drop/business/validate"
-	"github.com/nextwavedevs/drop/foundation/database"
+	"github.com/nextwavedevs/drop/foundation/patch"
 	"github.com/nextwavedevs/drop/foundation/web"
 	"github.com/pkg/errors"
 	"go.opentelemetry.io/otel/trace"
@@ -20,6 +19,11 @@ type userGroup struct {
 	auth *auth.Auth
 }
 
+// token carries a signed token for the authenticated user.
+type token struct {
+	Token string `json:"token"`
+}
+
 func (ug userGroup) query(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.query")
@@ -30,17 +34,17 @@ func (ug userGroup) query(ctx context.Context, w http.ResponseWriter, r *http.Re
 		return web.NewShutdownError("web value missing from context")
 	}
 
-	params := web.Params(r)
-	pageNumber, err := strconv.Atoi(params["page"])
-	if err != nil {
-		return validate.NewRequestError(fmt.Errorf("invalid page format: %s", params["page"]), http.StatusBadRequest)
+	var pp pagePath
+	if err := web.DecodeQuery(r, &pp); err != nil {
+		return err
 	}
-	rowsPerPage, err := strconv.Atoi(params["rows"])
+
+	deleted, err := includeDeleted(ctx, r)
 	if err != nil {
-		return validate.NewRequestError(fmt.Errorf("invalid rows format: %s", params["rows"]), http.StatusBadRequest)
+		return err
 	}
 
-	users, err := ug.user.Query(ctx, v.TraceID, pageNumber, rowsPerPage)
+	users, err := ug.user.Query(ctx, v.TraceID, pp.Page, pp.Rows, deleted)
 	if err != nil {
 		return errors.Wrap(err, "unable to query for users")
 	}
@@ -48,6 +52,40 @@ func (ug userGroup) query(ctx context.Context, w http.ResponseWriter, r *http.Re
 	return web.Respond(ctx, w, users, http.StatusOK)
 }
 
+// exportUsers streams every user in the ?format= asked for.
+func (ug userGroup) exportUsers(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.exportUsers")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	enc, err := exportEncoder(r, user.ExportFields)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := includeDeleted(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Disposition", `attachment; filename="users`+enc.Extension()+`"`)
+	return web.RespondStream(ctx, w, enc.ContentType(), http.StatusOK, func(out io.Writer) error {
+		ew := enc.NewWriter(out)
+		write := func(usr user.Info) error {
+			return ew.Write(usr)
+		}
+		if err := ug.user.Export(ctx, v.TraceID, deleted, write); err != nil {
+			return errors.Wrap(err, "exporting users")
+		}
+		return ew.Close()
+	})
+}
+
 func (ug userGroup) queryByID(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.queryByID")
@@ -63,21 +101,28 @@ func (ug userGroup) queryByID(ctx context.Context, w http.ResponseWriter, r *htt
 		return errors.New("claims missing from context")
 	}
 
+	deleted, err := includeDeleted(ctx, r)
+	if err != nil {
+		return err
+	}
+
 	params := web.Params(r)
-	usr, err := ug.user.QueryByID(ctx, v.TraceID, claims, params["id"])
+	usr, err := ug.user.QueryByID(ctx, v.TraceID, claims, params["id"], deleted)
 	if err != nil {
 		switch errors.Cause(err) {
-		case database.ErrInvalidID:
+		case user.ErrInvalidID:
 			return validate.NewRequestError(err, http.StatusBadRequest)
-		case database.ErrNotFound:
+		case user.ErrNotFound:
 			return validate.NewRequestError(err, http.StatusNotFound)
-		case database.ErrForbidden:
+		case user.ErrForbidden:
 			return validate.NewRequestError(err, http.StatusForbidden)
 		default:
 			return errors.Wrapf(err, "ID: %s", params["id"])
 		}
 	}
 
+	w.Header().Set("ETag", etag(usr.Version))
+	lastModified(w, usr.Updated_at)
 	return web.Respond(ctx, w, usr, http.StatusOK)
 }
 
@@ -125,20 +170,81 @@ func (ug userGroup) update(ctx context.Context, w http.ResponseWriter, r *http.R
 	}
 
 	params := web.Params(r)
-	err := ug.user.Update(ctx, v.TraceID, claims, params["id"], upd, v.Now)
+	version, err := ug.version(ctx, v.TraceID, claims, r, params["id"])
+	if err != nil {
+		return err
+	}
+
+	usr, err := ug.user.Update(ctx, v.TraceID, claims, params["id"], upd, version, v.Now)
 	if err != nil {
 		switch errors.Cause(err) {
-		case database.ErrInvalidID:
+		case user.ErrInvalidID:
 			return validate.NewRequestError(err, http.StatusBadRequest)
-		case database.ErrNotFound:
+		case user.ErrNotFound:
 			return validate.NewRequestError(err, http.StatusNotFound)
-		case database.ErrForbidden:
+		case user.ErrForbidden:
 			return validate.NewRequestError(err, http.StatusForbidden)
+		case user.ErrVersionMismatch:
+			return validate.NewRequestError(err, http.StatusPreconditionFailed)
 		default:
 			return errors.Wrapf(err, "ID: %s  User: %+v", params["id"], &upd)
 		}
 	}
 
+	w.Header().Set("ETag", etag(usr.Version))
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// patch applies a JSON Merge Patch or JSON Patch to a user. A patch that
+// can't be applied is unprocessable and a failed test operation conflicts
+// with the current state of the user.
+func (ug userGroup) patch(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.patch")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	apply, err := patchFunc(w, r)
+	if err != nil {
+		return err
+	}
+
+	params := web.Params(r)
+	version, err := ug.version(ctx, v.TraceID, claims, r, params["id"])
+	if err != nil {
+		return err
+	}
+
+	usr, err := ug.user.Patch(ctx, v.TraceID, claims, params["id"], apply, version, v.Now)
+	if err != nil {
+		switch errors.Cause(err) {
+		case user.ErrInvalidID:
+			return validate.NewRequestError(err, http.StatusBadRequest)
+		case user.ErrNotFound:
+			return validate.NewRequestError(err, http.StatusNotFound)
+		case user.ErrForbidden:
+			return validate.NewRequestError(err, http.StatusForbidden)
+		case user.ErrVersionMismatch:
+			return validate.NewRequestError(err, http.StatusPreconditionFailed)
+		case patch.ErrInvalid:
+			return validate.NewRequestError(err, http.StatusUnprocessableEntity)
+		case patch.ErrTestFailed:
+			return validate.NewRequestError(err, http.StatusConflict)
+		default:
+			return errors.Wrapf(err, "ID: %s", params["id"])
+		}
+	}
+
+	w.Header().Set("ETag", etag(usr.Version))
 	return web.Respond(ctx, w, nil, http.StatusNoContent)
 }
 
@@ -158,15 +264,22 @@ func (ug userGroup) delete(ctx context.Context, w http.ResponseWriter, r *http.R
 	}
 
 	params := web.Params(r)
-	err := ug.user.Delete(ctx, v.TraceID, claims, params["id"])
+	version, err := ug.version(ctx, v.TraceID, claims, r, params["id"])
+	if err != nil {
+		return err
+	}
+
+	err = ug.user.Delete(ctx, v.TraceID, claims, params["id"], version, v.Now)
 	if err != nil {
 		switch errors.Cause(err) {
-		case database.ErrInvalidID:
+		case user.ErrInvalidID:
 			return validate.NewRequestError(err, http.StatusBadRequest)
-		case database.ErrNotFound:
+		case user.ErrNotFound:
 			return validate.NewRequestError(err, http.StatusNotFound)
-		case database.ErrForbidden:
+		case user.ErrForbidden:
 			return validate.NewRequestError(err, http.StatusForbidden)
+		case user.ErrVersionMismatch:
+			return validate.NewRequestError(err, http.StatusPreconditionFailed)
 		default:
 			return errors.Wrapf(err, "ID: %s", params["id"])
 		}
@@ -175,6 +288,57 @@ func (ug userGroup) delete(ctx context.Context, w http.ResponseWriter, r *http.R
 	return web.Respond(ctx, w, nil, http.StatusNoContent)
 }
 
+func (ug userGroup) restore(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.restore")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	params := web.Params(r)
+	usr, err := ug.user.Restore(ctx, v.TraceID, params["id"], v.Now)
+	if err != nil {
+		switch errors.Cause(err) {
+		case user.ErrInvalidID:
+			return validate.NewRequestError(err, http.StatusBadRequest)
+		case user.ErrNotFound:
+			return validate.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "ID: %s", params["id"])
+		}
+	}
+
+	return web.Respond(ctx, w, usr, http.StatusOK)
+}
+
+// version reads the user version a write is conditional on, resolving
+// `If-Match: *` to the current version.
+func (ug userGroup) version(ctx context.Context, traceID string, claims auth.Claims, r *http.Request, userID string) (int, error) {
+	version, wildcard, err := ifMatch(r)
+	if err != nil || !wildcard {
+		return version, err
+	}
+
+	usr, err := ug.user.QueryByID(ctx, traceID, claims, userID, false)
+	if err != nil {
+		switch errors.Cause(err) {
+		case user.ErrInvalidID:
+			return 0, validate.NewRequestError(err, http.StatusBadRequest)
+		case user.ErrNotFound:
+			return 0, validate.NewRequestError(errors.New("precondition failed"), http.StatusPreconditionFailed)
+		case user.ErrForbidden:
+			return 0, validate.NewRequestError(err, http.StatusForbidden)
+		default:
+			return 0, errors.Wrapf(err, "ID: %s", userID)
+		}
+	}
+
+	return usr.Version, nil
+}
+
 func (ug userGroup) token(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.token")
@@ -194,7 +358,7 @@ func (ug userGroup) token(ctx context.Context, w http.ResponseWriter, r *http.Re
 	claims, err := ug.user.Authenticate(ctx, v.TraceID, v.Now, email, pass)
 	if err != nil {
 		switch errors.Cause(err) {
-		case database.ErrAuthenticationFailure:
+		case user.ErrAuthenticationFailure:
 			return validate.NewRequestError(err, http.StatusUnauthorized)
 		default:
 			return errors.Wrap(err, "authenticating")
@@ -203,9 +367,7 @@ func (ug userGroup) token(ctx context.Context, w http.ResponseWriter, r *http.Re
 
 	params := web.Params(r)
 
-	var tkn struct {
-		Token string `json:"token"`
-	}
+	var tkn token
 	tkn.Token, err = ug.auth.GenerateToken(params["kid"], claims)
 	if err != nil {
 		return errors.Wrap(err, "generating token")
@@ -4,7 +4,6 @@ import (
 	"context"
 	"expvar"
 	"fmt"
-	"log"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
@@ -15,8 +14,15 @@ import (
 	"github.com/ardanlabs/conf"
 	"github.com/nextwavedevs/drop/app/drop-api/handlers"
 	"github.com/nextwavedevs/drop/business/auth"
+	"github.com/nextwavedevs/drop/business/data/booking"
 	"github.com/nextwavedevs/drop/foundation/database"
+	"github.com/nextwavedevs/drop/foundation/geocode"
+	"github.com/nextwavedevs/drop/foundation/idempotency"
 	"github.com/nextwavedevs/drop/foundation/keystore"
+	"github.com/nextwavedevs/drop/foundation/logger"
+	"github.com/nextwavedevs/drop/foundation/metrics"
+	"github.com/nextwavedevs/drop/foundation/ratelimit"
+	"github.com/nextwavedevs/drop/foundation/web"
 	"github.com/pkg/errors"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -32,31 +38,59 @@ var build = "develop"
 func main() {
 	database.DBinstance()
 
-	log := log.New(os.Stdout, "DROP : ", log.LstdFlags|log.Lmicroseconds|log.Lshortfile)
+	log := logger.New(os.Stdout, "drop-api", logger.InfoLevel)
 
 	if err := run(log); err != nil {
-		log.Println("main: error:", err)
+		log.Error("main: error", "error", err)
 		os.Exit(1)
 	}
 }
 
-func run(log *log.Logger) error {
+func run(log *logger.Logger) error {
 
 	// =========================================================================
 	// Configuration
 
 	var cfg struct {
 		conf.Version
+		Log struct {
+			Level string `conf:"default:info,help:least severe level logged: debug or info or warn or error"`
+		}
 		Web struct {
 			APIHost         string        `conf:"default:0.0.0.0:3000"`
 			DebugHost       string        `conf:"default:0.0.0.0:4000"`
 			ReadTimeout     time.Duration `conf:"default:5s"`
-			WriteTimeout    time.Duration `conf:"default:5s"`
+			WriteTimeout    time.Duration `conf:"default:5s,help:time most routes have to write their response"`
+			ExportTimeout   time.Duration `conf:"default:5m,help:time streamed exports have to finish before they are cut short"`
+			ImportTimeout   time.Duration `conf:"default:2m,help:time imports have to upload their file and respond"`
 			ShutdownTimeout time.Duration `conf:"default:5s"`
+			CompressMinSize int           `conf:"default:1024,help:smallest response to compress or 0 to disable"`
+			MaxBodySize     int64         `conf:"default:1048576,help:largest request body accepted by most routes"`
+			TrustedProxies  []string      `conf:"help:addresses or CIDR ranges of load balancers trusted to set X-Forwarded-For separated by semicolons"`
 		}
 		Auth struct {
 			KeysFolder string `conf:"default:scripts/keys/"`
 			Algorithm  string `conf:"default:RS256"`
+			FeedSecret string `conf:"noprint"`
+		}
+		Geocode struct {
+			Gazetteer   string        `conf:"help:CSV gazetteer to use in place of the bundled one"`
+			ProviderURL string        `conf:"help:base URL of a Nominatim compatible service tried after the gazetteer"`
+			UserAgent   string        `conf:"default:drop-api"`
+			Timeout     time.Duration `conf:"default:5s"`
+			CacheTTL    time.Duration `conf:"default:24h"`
+			CacheSize   int           `conf:"default:10000"`
+		}
+		RateLimit struct {
+			Default   string `conf:"default:600/m,help:limit on every route by address"`
+			Signup    string `conf:"default:5/m,help:limit on sign ups by address"`
+			Token     string `conf:"default:10/m,help:limit on token requests by address"`
+			Bookings  string `conf:"default:30/m,help:limit on bookings by user"`
+			StoreSize int    `conf:"default:100000"`
+		}
+		Idempotency struct {
+			TTL       time.Duration `conf:"default:24h"`
+			StoreSize int           `conf:"default:100000"`
 		}
 		Zipkin struct {
 			ReporterURI string  `conf:"default:http://zipkin:9411/api/v2/spans"`
@@ -87,22 +121,28 @@ func run(log *log.Logger) error {
 		return errors.Wrap(err, "parsing config")
 	}
 
+	level, err := logger.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		return errors.Wrap(err, "parsing log level")
+	}
+	log.SetLevel(level)
+
 	// App Starting
 
 	expvar.NewString("build").Set(build)
-	log.Printf("main: Started: Application initializing: version %q", build)
-	defer log.Println("main: Completed")
+	log.Info("main: Started: Application initializing", "version", build)
+	defer log.Info("main: Completed")
 
 	out, err := conf.String(&cfg)
 	if err != nil {
 		return errors.Wrap(err, "generating config for output")
 	}
-	log.Printf("main: Config:\n%v\n", out)
+	log.Info("main: Config", "config", out)
 
 	//================================================
 	// Initialize authentication support
 
-	log.Println("main: Started: Initializing authentication support")
+	log.Info("main: Started: Initializing authentication support")
 
 	// Construct a key store based on the key files stored in
 	// the specified directory.
@@ -116,6 +156,74 @@ func run(log *log.Logger) error {
 		return errors.Wrap(err, "constructing auth")
 	}
 
+	// =========================================================================
+	// Initialize database support
+
+	log.Info("main: Initializing database indexes")
+
+	ictx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := booking.EnsureIndexes(ictx); err != nil {
+		return errors.Wrap(err, "ensuring booking indexes")
+	}
+
+	// =========================================================================
+	// Initialize geocoding support
+
+	log.Info("main: Initializing geocoding support")
+
+	var gaz *geocode.Gazetteer
+	if cfg.Geocode.Gazetteer != "" {
+		gaz, err = geocode.OpenGazetteer(cfg.Geocode.Gazetteer)
+	} else {
+		gaz, err = geocode.Bundled()
+	}
+	if err != nil {
+		return errors.Wrap(err, "loading gazetteer")
+	}
+
+	geocoders := geocode.Chain{gaz}
+	if cfg.Geocode.ProviderURL != "" {
+		client := http.Client{Timeout: cfg.Geocode.Timeout}
+		geocoders = append(geocoders, geocode.NewHTTP(cfg.Geocode.ProviderURL, &client, cfg.Geocode.UserAgent))
+	}
+	geocoder := geocode.NewCache(geocoders, cfg.Geocode.CacheTTL, cfg.Geocode.CacheSize)
+
+	// =========================================================================
+	// Initialize rate limiting support
+
+	log.Info("main: Initializing rate limiting support")
+
+	limits := make(map[string]ratelimit.Limit)
+	for group, spec := range map[string]string{
+		"default":  cfg.RateLimit.Default,
+		"signup":   cfg.RateLimit.Signup,
+		"token":    cfg.RateLimit.Token,
+		"bookings": cfg.RateLimit.Bookings,
+	} {
+		if spec == "" {
+			continue
+		}
+		limit, err := ratelimit.ParseLimit(spec)
+		if err != nil {
+			return errors.Wrapf(err, "parsing %s rate limit", group)
+		}
+		limits[group] = limit
+	}
+	rateStore := ratelimit.NewMemory(cfg.RateLimit.StoreSize)
+
+	proxies, err := web.ParseProxies(cfg.Web.TrustedProxies)
+	if err != nil {
+		return errors.Wrap(err, "parsing trusted proxies")
+	}
+
+	// =========================================================================
+	// Initialize idempotency support
+
+	log.Info("main: Initializing idempotency support")
+
+	idemStore := idempotency.NewMemory(cfg.Idempotency.StoreSize)
+
 	// =========================================================================
 	// Start Tracing Support
 
@@ -123,11 +231,11 @@ func run(log *log.Logger) error {
 	// compatible with your project. Please review the documentation for
 	// opentelemetry.
 
-	log.Println("main: Initializing OT/Zipkin tracing support")
+	log.Info("main: Initializing OT/Zipkin tracing support")
 
 	exporter, err := zipkin.NewRawExporter(
 		cfg.Zipkin.ReporterURI,
-		zipkin.WithLogger(log),
+		zipkin.WithLogger(log.Std(logger.WarnLevel)),
 	)
 	if err != nil {
 		return errors.Wrap(err, "creating new exporter")
@@ -153,37 +261,54 @@ func run(log *log.Logger) error {
 	//==================================================
 	//Start Debugging....
 
-	log.Println("main: Initializing debugging support")
+	log.Info("main: Initializing debugging support")
+
+	// Let the log level be read and changed while the service runs.
+	http.Handle("/debug/loglevel", log.LevelHandler())
+
+	// Serve request, database and runtime metrics for Prometheus.
+	metrics.Default.RegisterRuntime()
+	http.Handle("/debug/metrics", metrics.Default.Handler())
 
 	go func() {
-		log.Printf("main: Debug Listening %s", cfg.Web.DebugHost)
+		log.Info("main: Debug Listening", "host", cfg.Web.DebugHost)
 		if err := http.ListenAndServe(cfg.Web.DebugHost, http.DefaultServeMux); err != nil {
-			log.Printf("main: Debug Listener closed: %v", err)
+			log.Error("main: Debug Listener closed", "error", err)
 		}
 	}()
 
 	//===================================================
 	// Start API Service
 
-	log.Println("main: Initializing API support")
+	log.Info("main: Initializing API support")
 
 	// Make a channel to listen for an interrupt or terminate signal from the OS.
 	// Use a buffered channel because the signal package requires it.
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 
+	// Routes set their own write deadline on the connection, so the server
+	// only bounds the longest of them.
+	writeTimeout := cfg.Web.WriteTimeout
+	for _, d := range []time.Duration{cfg.Web.ExportTimeout, cfg.Web.ImportTimeout} {
+		if d > writeTimeout {
+			writeTimeout = d
+		}
+	}
+
 	api := http.Server{
 		Addr:         cfg.Web.APIHost,
-		Handler:      handlers.API(build, shutdown, log, auth, database.Client),
+		Handler:      handlers.API(build, shutdown, log, auth, database.Client, handlers.WithCompression(cfg.Web.CompressMinSize), handlers.WithMaxBody(cfg.Web.MaxBodySize), handlers.WithWriteTimeouts(cfg.Web.WriteTimeout, cfg.Web.ExportTimeout), handlers.WithImportTimeout(cfg.Web.ImportTimeout), handlers.WithFeedSecret(cfg.Auth.FeedSecret), handlers.WithGeocoder(geocoder), handlers.WithRateLimit(rateStore, limits), handlers.WithTrustedProxies(proxies), handlers.WithIdempotency(idemStore, cfg.Idempotency.TTL)),
 		ReadTimeout:  cfg.Web.ReadTimeout,
-		WriteTimeout: cfg.Web.WriteTimeout,
+		WriteTimeout: writeTimeout,
+		ConnContext:  web.ConnContext,
 	}
 
 	serverErrors := make(chan error, 1)
 
 	// Start the service listening for requests.
 	go func() {
-		log.Printf("main: API listening on %s", api.Addr)
+		log.Info("main: API listening", "host", api.Addr)
 		serverErrors <- api.ListenAndServe()
 	}()
 
@@ -195,7 +320,7 @@ func run(log *log.Logger) error {
 		return errors.Wrap(err, "server error")
 
 	case sig := <-shutdown:
-		log.Printf("main: %v: Start shutdown", sig)
+		log.Info("main: Start shutdown", "signal", sig)
 
 		// Give outstanding requests a deadline for completion.
 		ctx, cancel := context.WithTimeout(context.Background(), cfg.Web.ShutdownTimeout)
@@ -0,0 +1,24 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// FeedToken returns the token embedded in a subject's private calendar feed
+// URL. Calendar applications can't send bearer tokens, so the URL itself is
+// signed with a server secret.
+func FeedToken(secret string, subject string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("feed:" + subject))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// CheckFeedToken reports whether token is the valid feed token of subject.
+func CheckFeedToken(secret string, subject string, token string) bool {
+	if secret == "" {
+		return false
+	}
+	return hmac.Equal([]byte(FeedToken(secret, subject)), []byte(token))
+}
@@ -0,0 +1,199 @@
+// Package audit keeps an append-only trail of the writes made to users and
+// studios so it is known who changed what and when.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/nextwavedevs/drop/business/auth"
+	"github.com/nextwavedevs/drop/business/validate"
+	"github.com/nextwavedevs/drop/foundation/database"
+	"github.com/nextwavedevs/drop/foundation/logger"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// redacted replaces the values of sensitive fields in recorded changes.
+const redacted = "[redacted]"
+
+// Audit manages the set of API's for audit access.
+type Audit struct {
+	log *logger.Logger
+	db  *mongo.Client
+}
+
+// New constructs an Audit for api access.
+func New(log *logger.Logger, db *mongo.Client) Audit {
+	return Audit{
+		log: log,
+		db:  db,
+	}
+}
+
+var auditCollection *mongo.Collection = database.OpenCollection(database.Client, "audit")
+
+// Record appends an event for a write to the trail. The actor is taken from
+// the claims in the context. The changes are the difference between before
+// and after, either of which may be nil, with the values of the fields named
+// in redact hidden.
+func (a Audit) Record(ctx context.Context, traceID string, entity string, entityID string, action string, before interface{}, after interface{}, now time.Time, redact ...string) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.audit.record")
+	defer span.End()
+
+	changes, err := Diff(before, after, redact...)
+	if err != nil {
+		return errors.Wrap(err, "diffing documents")
+	}
+
+	var actorID string
+	if claims, ok := ctx.Value(auth.Key).(auth.Claims); ok {
+		actorID = claims.Subject
+	}
+
+	evt := Info{
+		ID:         validate.GenerateID(),
+		Entity:     entity,
+		EntityID:   entityID,
+		Action:     action,
+		ActorID:    actorID,
+		TraceID:    traceID,
+		Changes:    changes,
+		Created_at: now.UTC(),
+	}
+
+	if _, err := auditCollection.InsertOne(ctx, evt); err != nil {
+		return errors.Wrapf(err, "recording %s of %s %q", action, entity, entityID)
+	}
+
+	a.log.Debug("audit.Record", "trace_id", traceID)
+	return nil
+}
+
+// Query retrieves a page of the audit trail, most recent first.
+func (a Audit) Query(ctx context.Context, traceID string, qf QueryFilter, pageNumber int, rowsPerPage int) ([]Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.audit.query")
+	defer span.End()
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(int64((pageNumber - 1) * rowsPerPage)).
+		SetLimit(int64(rowsPerPage))
+
+	cur, err := auditCollection.Find(ctx, qf.document(), opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "selecting audit events")
+	}
+
+	events := []Info{}
+	if err := cur.All(ctx, &events); err != nil {
+		return nil, errors.Wrap(err, "decoding audit events")
+	}
+
+	a.log.Debug("audit.Query", "trace_id", traceID)
+	return events, nil
+}
+
+// document converts the filter into a Mongo query document.
+func (qf QueryFilter) document() bson.M {
+	filter := bson.M{}
+	if qf.Entity != "" {
+		filter["entity"] = qf.Entity
+	}
+	if qf.EntityID != "" {
+		filter["entityid"] = qf.EntityID
+	}
+	if qf.ActorID != "" {
+		filter["actorid"] = qf.ActorID
+	}
+	if qf.Action != "" {
+		filter["action"] = qf.Action
+	}
+
+	created := bson.M{}
+	if !qf.From.IsZero() {
+		created["$gte"] = qf.From.UTC()
+	}
+	if !qf.To.IsZero() {
+		created["$lt"] = qf.To.UTC()
+	}
+	if len(created) > 0 {
+		filter["created_at"] = created
+	}
+
+	return filter
+}
+
+// Diff lists the top level fields that differ between two documents as they
+// are rendered in JSON, ordered by field name. Either document may be nil.
+// The values of the fields named in redact are hidden.
+func Diff(before interface{}, after interface{}, redact ...string) ([]Change, error) {
+	b, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	hide := make(map[string]bool, len(redact))
+	for _, f := range redact {
+		hide[f] = true
+	}
+
+	names := make(map[string]bool, len(a)+len(b))
+	for name := range b {
+		names[name] = true
+	}
+	for name := range a {
+		names[name] = true
+	}
+
+	changes := []Change{}
+	for name := range names {
+		bv, av := b[name], a[name]
+		if reflect.DeepEqual(bv, av) {
+			continue
+		}
+		if hide[name] {
+			if bv != nil {
+				bv = redacted
+			}
+			if av != nil {
+				av = redacted
+			}
+		}
+		changes = append(changes, Change{Field: name, Before: bv, After: av})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+
+	return changes, nil
+}
+
+// fields renders a document as a map of its JSON fields.
+func fields(doc interface{}) (map[string]interface{}, error) {
+	if doc == nil {
+		return map[string]interface{}{}, nil
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, errors.Wrap(err, "encoding document")
+	}
+
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, errors.Wrap(err, "decoding document")
+	}
+
+	return m, nil
+}
@@ -0,0 +1,45 @@
+package audit
+
+import "time"
+
+// Set of actions recorded in the audit trail.
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+	ActionPurge   = "purge"
+	ActionMerge   = "merge"
+)
+
+// Info is a single append-only audit event describing a write to an entity.
+// ActorID is empty when the write was made by an anonymous request.
+type Info struct {
+	ID         string    `bson:"_id" json:"id"`
+	Entity     string    `json:"entity"`
+	EntityID   string    `json:"entity_id"`
+	Action     string    `json:"action"`
+	ActorID    string    `json:"actor_id"`
+	TraceID    string    `json:"trace_id"`
+	Changes    []Change  `json:"changes"`
+	Created_at time.Time `json:"created_at"`
+}
+
+// Change is the before and after value of one field of an entity. Before is
+// nil for created fields and After is nil for removed ones.
+type Change struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// QueryFilter holds the optional criteria the audit trail can be narrowed by.
+// From is inclusive and To exclusive.
+type QueryFilter struct {
+	Entity   string
+	EntityID string
+	ActorID  string
+	Action   string
+	From     time.Time
+	To       time.Time
+}
@@ -0,0 +1,461 @@
+// Package booking manages the resources studios offer for booking, the
+// time slots they open on them and the reservations users make.
+package booking
+
+import (
+	"context"
+	"time"
+
+	"github.com/nextwavedevs/drop/business/auth"
+	"github.com/nextwavedevs/drop/business/data/studio"
+	"github.com/nextwavedevs/drop/business/validate"
+	"github.com/nextwavedevs/drop/foundation/database"
+	"github.com/nextwavedevs/drop/foundation/logger"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// ErrNotFound is used when a specific booking, slot or resource is
+	// requested but does not exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrInvalidID occurs when an ID is not in a valid form.
+	ErrInvalidID = errors.New("ID is not in its proper form")
+
+	// ErrForbidden occurs when a user tries to do something that is forbidden to them according to our access control policies.
+	ErrForbidden = errors.New("attempted action is not allowed")
+
+	// ErrSlotFull occurs when every seat of a slot has been reserved.
+	ErrSlotFull = errors.New("slot is fully booked")
+
+	// ErrSlotClosed occurs when a slot has already started.
+	ErrSlotClosed = errors.New("slot is no longer open for booking")
+
+	// ErrSlotOverlap occurs when a new slot overlaps an existing slot on the
+	// same resource.
+	ErrSlotOverlap = errors.New("slot overlaps an existing slot")
+
+	// ErrAlreadyBooked occurs when a user reserves a slot they already hold
+	// an active booking for.
+	ErrAlreadyBooked = errors.New("slot already booked by user")
+
+	// ErrInvalidTransition occurs when a booking can't move from its current
+	// status to the requested one.
+	ErrInvalidTransition = errors.New("invalid booking status transition")
+
+	// ErrCancelWindow occurs when a customer cancels inside the resource's
+	// cancellation window.
+	ErrCancelWindow = errors.New("cancellation window has passed")
+
+	// ErrResourceBusy occurs when slots are being added to a resource by
+	// another request for longer than a caller is willing to wait.
+	ErrResourceBusy = errors.New("resource is busy, try again")
+)
+
+// Booking manages the set of API's for booking access.
+type Booking struct {
+	log    *logger.Logger
+	db     *mongo.Client
+	studio studio.Studio
+}
+
+// New constructs a Booking for api access.
+func New(log *logger.Logger, db *mongo.Client) Booking {
+	return Booking{
+		log:    log,
+		db:     db,
+		studio: studio.New(log, db),
+	}
+}
+
+var (
+	resourceCollection *mongo.Collection = database.OpenCollection(database.Client, "resource")
+	slotCollection     *mongo.Collection = database.OpenCollection(database.Client, "slot")
+	bookingCollection  *mongo.Collection = database.OpenCollection(database.Client, "booking")
+)
+
+// EnsureIndexes creates the indexes the package relies on for correctness.
+// A user may hold only one active booking on a slot, which is enforced by a
+// unique index over the bookings still marked active. Bookings made before
+// the flag existed are marked first.
+func EnsureIndexes(ctx context.Context) error {
+	backfill := bson.A{bson.M{"$set": bson.M{"active": bson.M{"$in": bson.A{"$status", bson.A{StatusPending, StatusConfirmed}}}}}}
+	if _, err := bookingCollection.UpdateMany(ctx, bson.M{"active": bson.M{"$exists": false}}, backfill); err != nil {
+		return errors.Wrap(err, "marking active bookings")
+	}
+
+	index := mongo.IndexModel{
+		Keys: bson.D{{Key: "slotid", Value: 1}, {Key: "userid", Value: 1}},
+		Options: options.Index().
+			SetName("active_booking").
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"active": true}),
+	}
+	if _, err := bookingCollection.Indexes().CreateOne(ctx, index); err != nil {
+		return errors.Wrap(err, "creating active booking index")
+	}
+	return nil
+}
+
+// Create reserves a seat on a slot for the authenticated user. The seat is
+// claimed with a single conditional increment so concurrent requests can
+// never book a slot beyond its capacity, and the unique active booking index
+// stops a user from holding two seats on the same slot.
+func (b Booking) Create(ctx context.Context, traceID string, claims auth.Claims, nb NewBooking, now time.Time) (Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.booking.create")
+	defer span.End()
+
+	if err := validate.Check(nb); err != nil {
+		return Info{}, errors.Wrap(err, "validating data")
+	}
+	if err := validate.CheckID(nb.SlotID); err != nil {
+		return Info{}, ErrInvalidID
+	}
+
+	filter := bson.M{
+		"_id":   nb.SlotID,
+		"start": bson.M{"$gt": now.UTC()},
+		"$expr": bson.M{"$lt": bson.A{"$booked", "$capacity"}},
+	}
+	update := bson.M{"$inc": bson.M{"booked": 1}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var slot Slot
+	if err := slotCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&slot); err != nil {
+		if err != mongo.ErrNoDocuments {
+			return Info{}, errors.Wrap(err, "claiming slot")
+		}
+		return Info{}, b.slotUnavailable(ctx, nb.SlotID, now)
+	}
+
+	bk := Info{
+		ID:         validate.GenerateID(),
+		SlotID:     slot.ID,
+		ResourceID: slot.ResourceID,
+		StudioID:   slot.StudioID,
+		UserID:     claims.Subject,
+		Status:     StatusPending,
+		Active:     true,
+		Start:      slot.Start,
+		End:        slot.End,
+		Notes:      nb.Notes,
+		Created_at: now.UTC(),
+		Updated_at: now.UTC(),
+	}
+
+	if _, err := bookingCollection.InsertOne(ctx, bk); err != nil {
+		if rerr := b.releaseSeat(ctx, slot.ID); rerr != nil {
+			b.log.Error("booking.Create: releasing seat", "trace_id", traceID, "error", rerr)
+		}
+		if mongo.IsDuplicateKeyError(err) {
+			return Info{}, ErrAlreadyBooked
+		}
+		return Info{}, errors.Wrap(err, "inserting booking")
+	}
+
+	b.log.Debug("booking.Create", "trace_id", traceID)
+	return bk, nil
+}
+
+// UpdateStatus moves a booking to a new status. Studio owners may perform any
+// valid transition while customers may only cancel their own bookings before
+// the resource's cancellation window opens.
+func (b Booking) UpdateStatus(ctx context.Context, traceID string, claims auth.Claims, bookingID string, us UpdateStatus, now time.Time) (Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.booking.updatestatus")
+	defer span.End()
+
+	if err := validate.Check(us); err != nil {
+		return Info{}, errors.Wrap(err, "validating data")
+	}
+
+	bk, err := b.queryByID(ctx, bookingID)
+	if err != nil {
+		return Info{}, err
+	}
+
+	if !canTransition(bk.Status, us.Status) {
+		return Info{}, ErrInvalidTransition
+	}
+
+	switch err := b.checkOwner(ctx, traceID, claims, bk.StudioID); {
+	case err == nil:
+		if us.Status == StatusNoShow && now.Before(bk.Start) {
+			return Info{}, ErrInvalidTransition
+		}
+
+	case errors.Cause(err) == ErrForbidden && claims.Subject == bk.UserID:
+		if us.Status != StatusCancelled {
+			return Info{}, ErrForbidden
+		}
+		res, err := b.queryResource(ctx, bk.StudioID, bk.ResourceID)
+		if err != nil {
+			return Info{}, errors.Wrap(err, "selecting resource")
+		}
+		window := time.Duration(res.Cancel_window_minutes) * time.Minute
+		if !now.Before(bk.Start.Add(-window)) {
+			return Info{}, ErrCancelWindow
+		}
+
+	default:
+		return Info{}, err
+	}
+
+	// Filter on the current status so two concurrent transitions can't both
+	// succeed.
+	filter := bson.D{{Key: "_id", Value: bk.ID}, {Key: "status", Value: bk.Status}}
+	active := us.Status == StatusPending || us.Status == StatusConfirmed
+	update := bson.M{"$set": bson.M{"status": us.Status, "active": active, "updated_at": now.UTC()}}
+	res, err := bookingCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return Info{}, errors.Wrap(err, "updating booking status")
+	}
+	if res.MatchedCount == 0 {
+		return Info{}, ErrInvalidTransition
+	}
+
+	if us.Status == StatusCancelled {
+		if err := b.releaseSeat(ctx, bk.SlotID); err != nil {
+			return Info{}, errors.Wrap(err, "releasing seat")
+		}
+	}
+
+	bk.Status = us.Status
+	bk.Active = active
+	bk.Updated_at = now.UTC()
+
+	b.log.Debug("booking.UpdateStatus", "trace_id", traceID)
+	return bk, nil
+}
+
+// QueryByID gets the specified booking. Only the customer who made it and
+// the studio's owners may see it.
+func (b Booking) QueryByID(ctx context.Context, traceID string, claims auth.Claims, bookingID string) (Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.booking.querybyid")
+	defer span.End()
+
+	bk, err := b.queryByID(ctx, bookingID)
+	if err != nil {
+		return Info{}, err
+	}
+
+	if claims.Subject != bk.UserID {
+		if err := b.checkOwner(ctx, traceID, claims, bk.StudioID); err != nil {
+			return Info{}, err
+		}
+	}
+
+	b.log.Debug("booking.QueryByID", "trace_id", traceID)
+	return bk, nil
+}
+
+// QueryByUser retrieves a page of a user's bookings, soonest first.
+func (b Booking) QueryByUser(ctx context.Context, traceID string, claims auth.Claims, userID string, pageNumber int, rowsPerPage int) ([]Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.booking.querybyuser")
+	defer span.End()
+
+	if err := validate.CheckID(userID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	// If you are not an admin and looking to retrieve someone other than yourself.
+	if !claims.Authorized(auth.RoleAdmin) && claims.Subject != userID {
+		return nil, ErrForbidden
+	}
+
+	bookings, err := b.query(ctx, bson.M{"userid": userID}, pageNumber, rowsPerPage)
+	if err != nil {
+		return nil, err
+	}
+
+	b.log.Debug("booking.QueryByUser", "trace_id", traceID)
+	return bookings, nil
+}
+
+// QueryByStudio retrieves a page of a studio's bookings for its owners,
+// optionally restricted to a single status.
+func (b Booking) QueryByStudio(ctx context.Context, traceID string, claims auth.Claims, studioID string, status string, pageNumber int, rowsPerPage int) ([]Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.booking.querybystudio")
+	defer span.End()
+
+	if err := validate.CheckID(studioID); err != nil {
+		return nil, ErrInvalidID
+	}
+	if err := b.checkOwner(ctx, traceID, claims, studioID); err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{"studioid": studioID}
+	if status != "" {
+		filter["status"] = status
+	}
+
+	bookings, err := b.query(ctx, filter, pageNumber, rowsPerPage)
+	if err != nil {
+		return nil, err
+	}
+
+	b.log.Debug("booking.QueryByStudio", "trace_id", traceID)
+	return bookings, nil
+}
+
+// =============================================================================
+
+// query runs a paged booking query sorted by start time.
+func (b Booking) query(ctx context.Context, filter bson.M, pageNumber int, rowsPerPage int) ([]Info, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "start", Value: 1}}).
+		SetSkip(int64((pageNumber - 1) * rowsPerPage)).
+		SetLimit(int64(rowsPerPage))
+
+	cur, err := bookingCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "selecting bookings")
+	}
+
+	bookings := []Info{}
+	if err := cur.All(ctx, &bookings); err != nil {
+		return nil, errors.Wrap(err, "decoding bookings")
+	}
+
+	return bookings, nil
+}
+
+// queryByID gets the specified booking without any access checks.
+func (b Booking) queryByID(ctx context.Context, bookingID string) (Info, error) {
+	if err := validate.CheckID(bookingID); err != nil {
+		return Info{}, ErrInvalidID
+	}
+
+	var bk Info
+	if err := bookingCollection.FindOne(ctx, bson.D{{Key: "_id", Value: bookingID}}).Decode(&bk); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, errors.Wrapf(err, "selecting booking %q", bookingID)
+	}
+
+	return bk, nil
+}
+
+// slotUnavailable works out why a slot could not be claimed.
+func (b Booking) slotUnavailable(ctx context.Context, slotID string, now time.Time) error {
+	var slot Slot
+	if err := slotCollection.FindOne(ctx, bson.D{{Key: "_id", Value: slotID}}).Decode(&slot); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return ErrNotFound
+		}
+		return errors.Wrapf(err, "selecting slot %q", slotID)
+	}
+
+	if !slot.Start.After(now) {
+		return ErrSlotClosed
+	}
+	return ErrSlotFull
+}
+
+// releaseSeat gives a claimed seat back to a slot.
+func (b Booking) releaseSeat(ctx context.Context, slotID string) error {
+	filter := bson.M{"_id": slotID, "booked": bson.M{"$gt": 0}}
+	update := bson.M{"$inc": bson.M{"booked": -1}}
+	_, err := slotCollection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+// Repoint moves the resources, slots and bookings of one studio onto
+// another, as when duplicate studios are merged. It reports how many
+// records moved.
+func (b Booking) Repoint(ctx context.Context, traceID string, fromID string, toID string) (int64, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.booking.repoint")
+	defer span.End()
+
+	if err := validate.CheckID(fromID); err != nil {
+		return 0, ErrInvalidID
+	}
+	if err := validate.CheckID(toID); err != nil {
+		return 0, ErrInvalidID
+	}
+
+	filter := bson.M{"studioid": fromID}
+	update := bson.M{"$set": bson.M{"studioid": toID}}
+
+	var moved int64
+	for name, coll := range map[string]*mongo.Collection{
+		"resources": resourceCollection,
+		"slots":     slotCollection,
+		"bookings":  bookingCollection,
+	} {
+		res, err := coll.UpdateMany(ctx, filter, update)
+		if err != nil {
+			return moved, errors.Wrapf(err, "repointing %s", name)
+		}
+		moved += res.ModifiedCount
+	}
+
+	b.log.Debug("booking.Repoint", "trace_id", traceID)
+	return moved, nil
+}
+
+// checkOwner verifies the claims may manage the specified studio.
+func (b Booking) checkOwner(ctx context.Context, traceID string, claims auth.Claims, studioID string) error {
+	err := b.studio.CheckOwner(ctx, traceID, claims, studioID)
+	switch errors.Cause(err) {
+	case nil:
+		return nil
+	case studio.ErrNotFound:
+		return ErrNotFound
+	case studio.ErrInvalidID:
+		return ErrInvalidID
+	case studio.ErrForbidden:
+		return ErrForbidden
+	default:
+		return errors.Wrap(err, "checking studio owner")
+	}
+}
+
+// canTransition reports whether a booking may move between two statuses.
+func canTransition(from string, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// QueryFeed retrieves every booking of a user ending after since. It performs
+// no access checks and backs the signed calendar feed, whose URL has already
+// been verified by the caller.
+func (b Booking) QueryFeed(ctx context.Context, traceID string, userID string, since time.Time) ([]Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.booking.queryfeed")
+	defer span.End()
+
+	if err := validate.CheckID(userID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	filter := bson.M{"userid": userID, "end": bson.M{"$gte": since.UTC()}}
+	opts := options.Find().SetSort(bson.D{{Key: "start", Value: 1}})
+	cur, err := bookingCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "selecting bookings")
+	}
+
+	bookings := []Info{}
+	if err := cur.All(ctx, &bookings); err != nil {
+		return nil, errors.Wrap(err, "decoding bookings")
+	}
+
+	b.log.Debug("booking.QueryFeed", "trace_id", traceID)
+	return bookings, nil
+}
@@ -0,0 +1,93 @@
+package booking
+
+import "time"
+
+// Set of statuses a booking moves through.
+const (
+	StatusPending   = "pending"
+	StatusConfirmed = "confirmed"
+	StatusCancelled = "cancelled"
+	StatusNoShow    = "no_show"
+)
+
+// transitions lists the statuses a booking may move to from its current one.
+var transitions = map[string][]string{
+	StatusPending:   {StatusConfirmed, StatusCancelled},
+	StatusConfirmed: {StatusCancelled, StatusNoShow},
+}
+
+// Resource is something a studio offers for booking, such as a room, a
+// booth or a piece of equipment.
+type Resource struct {
+	ID                    string    `bson:"_id"`
+	StudioID              string    `json:"studio_id"`
+	Name                  string    `json:"name"`
+	Description           string    `json:"description"`
+	Capacity              int       `json:"capacity"`
+	Cancel_window_minutes int       `json:"cancel_window_minutes"`
+	Created_at            time.Time `json:"created_at"`
+	Updated_at            time.Time `json:"updated_at"`
+}
+
+// NewResource contains information needed to create a new Resource.
+// Capacity is the number of bookings each slot accepts by default.
+type NewResource struct {
+	Name                  string `json:"name" validate:"required"`
+	Description           string `json:"description"`
+	Capacity              int    `json:"capacity" validate:"required,min=1"`
+	Cancel_window_minutes int    `json:"cancel_window_minutes" validate:"min=0"`
+}
+
+// Slot is a window of time in which a resource can be booked.
+type Slot struct {
+	ID         string    `bson:"_id"`
+	ResourceID string    `json:"resource_id"`
+	StudioID   string    `json:"studio_id"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Capacity   int       `json:"capacity"`
+	Booked     int       `json:"booked"`
+	Created_at time.Time `json:"created_at"`
+}
+
+// NewSlot contains information needed to open a new Slot on a resource.
+// When Capacity is zero the resource capacity is used.
+type NewSlot struct {
+	Start    time.Time `json:"start" validate:"required"`
+	End      time.Time `json:"end" validate:"required,gtfield=Start"`
+	Capacity int       `json:"capacity" validate:"omitempty,min=1"`
+}
+
+// Info represents a reservation of a slot by a user.
+type Info struct {
+	ID         string    `bson:"_id"`
+	SlotID     string    `json:"slot_id"`
+	ResourceID string    `json:"resource_id"`
+	StudioID   string    `json:"studio_id"`
+	UserID     string    `json:"user_id"`
+	Status     string    `json:"status"`
+	Active     bool      `json:"-"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Notes      string    `json:"notes"`
+	Created_at time.Time `json:"created_at"`
+	Updated_at time.Time `json:"updated_at"`
+}
+
+// NewBooking contains information needed to reserve a slot.
+type NewBooking struct {
+	SlotID string `json:"slot_id" validate:"required"`
+	Notes  string `json:"notes" validate:"max=500"`
+}
+
+// UpdateStatus is used to move a booking to a new status.
+type UpdateStatus struct {
+	Status string `json:"status" validate:"required,oneof=confirmed cancelled no_show"`
+}
+
+// SlotFilter narrows the slots returned for a studio.
+type SlotFilter struct {
+	ResourceID string
+	From       time.Time
+	To         time.Time
+}
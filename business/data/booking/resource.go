@@ -0,0 +1,246 @@
+package booking
+
+import (
+	"context"
+	"time"
+
+	"github.com/nextwavedevs/drop/business/auth"
+	"github.com/nextwavedevs/drop/business/validate"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CreateResource adds a bookable resource to a studio. Only admins and the
+// studio's owners may do this.
+func (b Booking) CreateResource(ctx context.Context, traceID string, claims auth.Claims, studioID string, nr NewResource, now time.Time) (Resource, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.booking.createresource")
+	defer span.End()
+
+	if err := validate.CheckID(studioID); err != nil {
+		return Resource{}, ErrInvalidID
+	}
+	if err := validate.Check(nr); err != nil {
+		return Resource{}, errors.Wrap(err, "validating data")
+	}
+	if err := b.checkOwner(ctx, traceID, claims, studioID); err != nil {
+		return Resource{}, err
+	}
+
+	res := Resource{
+		ID:                    validate.GenerateID(),
+		StudioID:              studioID,
+		Name:                  nr.Name,
+		Description:           nr.Description,
+		Capacity:              nr.Capacity,
+		Cancel_window_minutes: nr.Cancel_window_minutes,
+		Created_at:            now.UTC(),
+		Updated_at:            now.UTC(),
+	}
+
+	if _, err := resourceCollection.InsertOne(ctx, res); err != nil {
+		return Resource{}, errors.Wrap(err, "inserting resource")
+	}
+
+	b.log.Debug("booking.CreateResource", "trace_id", traceID)
+	return res, nil
+}
+
+// QueryResources retrieves the bookable resources of a studio.
+func (b Booking) QueryResources(ctx context.Context, traceID string, studioID string) ([]Resource, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.booking.queryresources")
+	defer span.End()
+
+	if err := validate.CheckID(studioID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cur, err := resourceCollection.Find(ctx, bson.D{{Key: "studioid", Value: studioID}}, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "selecting resources")
+	}
+
+	resources := []Resource{}
+	if err := cur.All(ctx, &resources); err != nil {
+		return nil, errors.Wrap(err, "decoding resources")
+	}
+
+	b.log.Debug("booking.QueryResources", "trace_id", traceID)
+	return resources, nil
+}
+
+// queryResource gets the specified resource of a studio.
+func (b Booking) queryResource(ctx context.Context, studioID string, resourceID string) (Resource, error) {
+	if err := validate.CheckID(resourceID); err != nil {
+		return Resource{}, ErrInvalidID
+	}
+
+	var res Resource
+	filter := bson.D{{Key: "_id", Value: resourceID}, {Key: "studioid", Value: studioID}}
+	if err := resourceCollection.FindOne(ctx, filter).Decode(&res); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return Resource{}, ErrNotFound
+		}
+		return Resource{}, errors.Wrapf(err, "selecting resource %q", resourceID)
+	}
+
+	return res, nil
+}
+
+// CreateSlot opens a bookable window on a resource. Slots on the same
+// resource may not overlap, so the resource is leased while the overlap
+// check and insert run and concurrent requests add their slots one at a
+// time.
+func (b Booking) CreateSlot(ctx context.Context, traceID string, claims auth.Claims, studioID string, resourceID string, ns NewSlot, now time.Time) (Slot, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.booking.createslot")
+	defer span.End()
+
+	if err := validate.CheckID(studioID); err != nil {
+		return Slot{}, ErrInvalidID
+	}
+	if err := validate.Check(ns); err != nil {
+		return Slot{}, errors.Wrap(err, "validating data")
+	}
+	if err := b.checkOwner(ctx, traceID, claims, studioID); err != nil {
+		return Slot{}, err
+	}
+
+	res, err := b.queryResource(ctx, studioID, resourceID)
+	if err != nil {
+		return Slot{}, err
+	}
+
+	release, err := b.leaseResource(ctx, resourceID)
+	if err != nil {
+		return Slot{}, err
+	}
+	defer release()
+
+	overlap := bson.M{
+		"resourceid": resourceID,
+		"start":      bson.M{"$lt": ns.End.UTC()},
+		"end":        bson.M{"$gt": ns.Start.UTC()},
+	}
+	n, err := slotCollection.CountDocuments(ctx, overlap)
+	if err != nil {
+		return Slot{}, errors.Wrap(err, "checking overlapping slots")
+	}
+	if n > 0 {
+		return Slot{}, ErrSlotOverlap
+	}
+
+	capacity := ns.Capacity
+	if capacity == 0 {
+		capacity = res.Capacity
+	}
+
+	slot := Slot{
+		ID:         validate.GenerateID(),
+		ResourceID: resourceID,
+		StudioID:   studioID,
+		Start:      ns.Start.UTC(),
+		End:        ns.End.UTC(),
+		Capacity:   capacity,
+		Created_at: now.UTC(),
+	}
+
+	if _, err := slotCollection.InsertOne(ctx, slot); err != nil {
+		return Slot{}, errors.Wrap(err, "inserting slot")
+	}
+
+	b.log.Debug("booking.CreateSlot", "trace_id", traceID)
+	return slot, nil
+}
+
+// Set of values bounding how long a resource is leased for slot changes.
+const (
+	resourceLeaseTTL   = 10 * time.Second
+	resourceLeaseWait  = 2 * time.Second
+	resourceLeaseRetry = 20 * time.Millisecond
+)
+
+// leaseResource takes an exclusive, expiring lease on a resource, waiting a
+// short while for a lease held by another request. The lease expires on its
+// own if the holder never releases it. The returned function releases it.
+func (b Booking) leaseResource(ctx context.Context, resourceID string) (func(), error) {
+	token := validate.GenerateID()
+	deadline := time.Now().Add(resourceLeaseWait)
+
+	for {
+		now := time.Now().UTC()
+		filter := bson.M{
+			"_id": resourceID,
+			"$or": bson.A{
+				bson.M{"slotlease_expires": nil},
+				bson.M{"slotlease_expires": bson.M{"$lte": now}},
+			},
+		}
+		update := bson.M{"$set": bson.M{"slotlease": token, "slotlease_expires": now.Add(resourceLeaseTTL)}}
+
+		res, err := resourceCollection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return nil, errors.Wrap(err, "leasing resource")
+		}
+		if res.MatchedCount == 1 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			return nil, ErrResourceBusy
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(resourceLeaseRetry):
+		}
+	}
+
+	release := func() {
+		filter := bson.M{"_id": resourceID, "slotlease": token}
+		update := bson.M{"$unset": bson.M{"slotlease": "", "slotlease_expires": ""}}
+		if _, err := resourceCollection.UpdateOne(context.Background(), filter, update); err != nil {
+			b.log.Error("booking.leaseResource: releasing lease", "resource_id", resourceID, "error", err)
+		}
+	}
+	return release, nil
+}
+
+// QuerySlots retrieves the slots of a studio starting within the filter's
+// time range, earliest first.
+func (b Booking) QuerySlots(ctx context.Context, traceID string, studioID string, sf SlotFilter) ([]Slot, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.booking.queryslots")
+	defer span.End()
+
+	if err := validate.CheckID(studioID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	filter := bson.M{
+		"studioid": studioID,
+		"start":    bson.M{"$gte": sf.From.UTC(), "$lt": sf.To.UTC()},
+	}
+	if sf.ResourceID != "" {
+		filter["resourceid"] = sf.ResourceID
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "start", Value: 1}})
+	cur, err := slotCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "selecting slots")
+	}
+
+	slots := []Slot{}
+	if err := cur.All(ctx, &slots); err != nil {
+		return nil, errors.Wrap(err, "decoding slots")
+	}
+
+	b.log.Debug("booking.QuerySlots", "trace_id", traceID)
+	return slots, nil
+}
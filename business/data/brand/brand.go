@@ -0,0 +1,316 @@
+// Package brand manages the brands that group studios operated by the same
+// business under one name.
+package brand
+
+import (
+	"context"
+	"time"
+
+	"github.com/nextwavedevs/drop/business/auth"
+	"github.com/nextwavedevs/drop/business/data/audit"
+	"github.com/nextwavedevs/drop/business/validate"
+	"github.com/nextwavedevs/drop/foundation/database"
+	"github.com/nextwavedevs/drop/foundation/logger"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// ErrNotFound is used when a specific Brand is requested but does not exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrInvalidID occurs when an ID is not in a valid form.
+	ErrInvalidID = errors.New("ID is not in its proper form")
+
+	// ErrForbidden occurs when a user tries to manage a brand they are not an
+	// admin of.
+	ErrForbidden = errors.New("attempted action is not allowed")
+)
+
+// entity names brands in the audit trail.
+const entity = "brand"
+
+// Brand manages the set of API's for brand access.
+type Brand struct {
+	log   *logger.Logger
+	db    *mongo.Client
+	audit audit.Audit
+}
+
+// New constructs a Brand for api access.
+func New(log *logger.Logger, db *mongo.Client) Brand {
+	return Brand{
+		log:   log,
+		db:    db,
+		audit: audit.New(log, db),
+	}
+}
+
+var brandCollection *mongo.Collection = database.OpenCollection(database.Client, "brand")
+
+// Create inserts a new brand into the database.
+func (b Brand) Create(ctx context.Context, traceID string, nb NewBrand, now time.Time) (Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.brand.create")
+	defer span.End()
+
+	if err := validate.Check(nb); err != nil {
+		return Info{}, errors.Wrap(err, "validating data")
+	}
+	if err := checkIDs(nb.Admins); err != nil {
+		return Info{}, err
+	}
+
+	admins := nb.Admins
+	if admins == nil {
+		admins = []string{}
+	}
+
+	brd := Info{
+		ID:           validate.GenerateID(),
+		Name:         nb.Name,
+		Logo:         nb.Logo,
+		Description:  nb.Description,
+		SocialHandle: nb.SocialHandle,
+		Admins:       admins,
+		Created_at:   now.UTC(),
+		Updated_at:   now.UTC(),
+	}
+
+	if _, err := brandCollection.InsertOne(ctx, brd); err != nil {
+		return Info{}, errors.Wrap(err, "inserting brand")
+	}
+
+	if err := b.audit.Record(ctx, traceID, entity, brd.ID, audit.ActionCreate, nil, brd, now); err != nil {
+		return Info{}, err
+	}
+
+	b.log.Debug("brand.Create", "trace_id", traceID)
+	return brd, nil
+}
+
+// Update writes the provided fields to a brand. Site admins and the admins
+// of the brand may update it.
+func (b Brand) Update(ctx context.Context, traceID string, claims auth.Claims, brandID string, ub UpdateBrand, now time.Time) (Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.brand.update")
+	defer span.End()
+
+	if err := validate.Check(ub); err != nil {
+		return Info{}, errors.Wrap(err, "validating data")
+	}
+
+	brd, err := b.QueryByID(ctx, traceID, brandID)
+	if err != nil {
+		return Info{}, err
+	}
+	if !isAdmin(claims, brd) {
+		return Info{}, ErrForbidden
+	}
+
+	set := bson.M{}
+	for key, value := range map[string]*string{
+		"name":         ub.Name,
+		"logo":         ub.Logo,
+		"description":  ub.Description,
+		"socialhandle": ub.SocialHandle,
+	} {
+		if value != nil {
+			set[key] = *value
+		}
+	}
+	if len(set) == 0 {
+		return brd, nil
+	}
+	set["updated_at"] = now.UTC()
+
+	return b.set(ctx, traceID, brd, bson.M{"$set": set}, now)
+}
+
+// SetAdmins replaces the set of users allowed to manage a brand and its
+// studios.
+func (b Brand) SetAdmins(ctx context.Context, traceID string, brandID string, admins []string, now time.Time) (Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.brand.setadmins")
+	defer span.End()
+
+	if err := checkIDs(admins); err != nil {
+		return Info{}, err
+	}
+	if admins == nil {
+		admins = []string{}
+	}
+
+	brd, err := b.QueryByID(ctx, traceID, brandID)
+	if err != nil {
+		return Info{}, err
+	}
+
+	update := bson.M{"$set": bson.M{"admins": admins, "updated_at": now.UTC()}}
+	return b.set(ctx, traceID, brd, update, now)
+}
+
+// Delete removes a brand. Its studios are left to the caller to detach.
+func (b Brand) Delete(ctx context.Context, traceID string, brandID string, now time.Time) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.brand.delete")
+	defer span.End()
+
+	brd, err := b.QueryByID(ctx, traceID, brandID)
+	if err != nil {
+		return err
+	}
+
+	res, err := brandCollection.DeleteOne(ctx, bson.M{"_id": brd.ID})
+	if err != nil {
+		return errors.Wrapf(err, "deleting brand %q", brd.ID)
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	if err := b.audit.Record(ctx, traceID, entity, brd.ID, audit.ActionDelete, brd, nil, now); err != nil {
+		return err
+	}
+
+	b.log.Debug("brand.Delete", "trace_id", traceID)
+	return nil
+}
+
+// Query retrieves a page of brands ordered by name.
+func (b Brand) Query(ctx context.Context, traceID string, pageNumber int, rowsPerPage int) ([]Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.brand.query")
+	defer span.End()
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}).
+		SetSkip(int64((pageNumber - 1) * rowsPerPage)).
+		SetLimit(int64(rowsPerPage))
+
+	cur, err := brandCollection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "selecting brands")
+	}
+
+	brands := []Info{}
+	if err := cur.All(ctx, &brands); err != nil {
+		return nil, errors.Wrap(err, "decoding brands")
+	}
+
+	b.log.Debug("brand.Query", "trace_id", traceID)
+	return brands, nil
+}
+
+// QueryByID gets the specified brand from the database.
+func (b Brand) QueryByID(ctx context.Context, traceID string, brandID string) (Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.brand.querybyid")
+	defer span.End()
+
+	if err := validate.CheckID(brandID); err != nil {
+		return Info{}, ErrInvalidID
+	}
+
+	var brd Info
+	if err := brandCollection.FindOne(ctx, bson.M{"_id": brandID}).Decode(&brd); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, errors.Wrapf(err, "selecting brand %q", brandID)
+	}
+
+	b.log.Debug("brand.QueryByID", "trace_id", traceID)
+	return brd, nil
+}
+
+// QueryByIDs retrieves the set of brands matching the provided ids keyed by
+// their id. Unknown ids are left out of the result.
+func (b Brand) QueryByIDs(ctx context.Context, traceID string, brandIDs []string) (map[string]Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.brand.querybyids")
+	defer span.End()
+
+	cur, err := brandCollection.Find(ctx, bson.M{"_id": bson.M{"$in": brandIDs}})
+	if err != nil {
+		return nil, errors.Wrap(err, "selecting brands")
+	}
+
+	var found []Info
+	if err := cur.All(ctx, &found); err != nil {
+		return nil, errors.Wrap(err, "decoding brands")
+	}
+
+	brands := make(map[string]Info, len(found))
+	for _, brd := range found {
+		brands[brd.ID] = brd
+	}
+
+	b.log.Debug("brand.QueryByIDs", "trace_id", traceID)
+	return brands, nil
+}
+
+// CheckAdmin verifies the claims belong to a site admin or to one of the
+// admins of the specified brand.
+func (b Brand) CheckAdmin(ctx context.Context, traceID string, claims auth.Claims, brandID string) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.brand.checkadmin")
+	defer span.End()
+
+	brd, err := b.QueryByID(ctx, traceID, brandID)
+	if err != nil {
+		return err
+	}
+	if !isAdmin(claims, brd) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// set applies an update to a brand, records it in the audit trail and
+// returns the result.
+func (b Brand) set(ctx context.Context, traceID string, brd Info, update bson.M, now time.Time) (Info, error) {
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var result Info
+	if err := brandCollection.FindOneAndUpdate(ctx, bson.M{"_id": brd.ID}, update, opts).Decode(&result); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, errors.Wrapf(err, "updating brand %q", brd.ID)
+	}
+
+	if err := b.audit.Record(ctx, traceID, entity, brd.ID, audit.ActionUpdate, brd, result, now); err != nil {
+		return Info{}, err
+	}
+
+	b.log.Debug("brand.Update", "trace_id", traceID)
+	return result, nil
+}
+
+// isAdmin reports whether the claims belong to a site admin or an admin of
+// the brand.
+func isAdmin(claims auth.Claims, brd Info) bool {
+	if claims.Authorized(auth.RoleAdmin) {
+		return true
+	}
+	for _, id := range brd.Admins {
+		if id == claims.Subject {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIDs validates the user ids of brand admins.
+func checkIDs(ids []string) error {
+	for _, id := range ids {
+		if err := validate.CheckID(id); err != nil {
+			return ErrInvalidID
+		}
+	}
+	return nil
+}
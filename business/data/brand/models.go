@@ -0,0 +1,35 @@
+package brand
+
+import "time"
+
+// Info represents a brand operating one or more studios. Studios of a brand
+// inherit its logo, description and socials where they leave their own
+// blank, and the brand's admins may manage every one of them.
+type Info struct {
+	ID           string    `bson:"_id"`
+	Name         string    `json:"name"`
+	Logo         string    `json:"logo"`
+	Description  string    `json:"description"`
+	SocialHandle string    `json:"socials"`
+	Admins       []string  `json:"admins"`
+	Created_at   time.Time `json:"created_at"`
+	Updated_at   time.Time `json:"updated_at"`
+}
+
+// NewBrand contains information needed to create a new Brand.
+type NewBrand struct {
+	Name         string   `json:"name" validate:"required,max=128"`
+	Logo         string   `json:"logo" validate:"omitempty,url"`
+	Description  string   `json:"description"`
+	SocialHandle string   `json:"socials"`
+	Admins       []string `json:"admins"`
+}
+
+// UpdateBrand defines what information may be provided to modify an existing
+// Brand.
+type UpdateBrand struct {
+	Name         *string `json:"name" validate:"omitempty,max=128"`
+	Logo         *string `json:"logo" validate:"omitempty,clearable_url"`
+	Description  *string `json:"description"`
+	SocialHandle *string `json:"socials"`
+}
@@ -0,0 +1,270 @@
+// Package favorite manages the set of studios users have saved.
+package favorite
+
+import (
+	"context"
+	"time"
+
+	"github.com/nextwavedevs/drop/business/auth"
+	"github.com/nextwavedevs/drop/business/data/studio"
+	"github.com/nextwavedevs/drop/business/validate"
+	"github.com/nextwavedevs/drop/foundation/database"
+	"github.com/nextwavedevs/drop/foundation/logger"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// ErrNotFound is used when a favourite or its studio does not exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrInvalidID occurs when an ID is not in a valid form.
+	ErrInvalidID = errors.New("ID is not in its proper form")
+
+	// ErrForbidden occurs when a user tries to manage the favourites of
+	// someone other than themselves.
+	ErrForbidden = errors.New("attempted action is not allowed")
+)
+
+// Favorite manages the set of API's for favourite access.
+type Favorite struct {
+	log    *logger.Logger
+	db     *mongo.Client
+	studio studio.Studio
+}
+
+// New constructs a Favorite for api access.
+func New(log *logger.Logger, db *mongo.Client) Favorite {
+	return Favorite{
+		log:    log,
+		db:     db,
+		studio: studio.New(log, db),
+	}
+}
+
+var favoriteCollection *mongo.Collection = database.OpenCollection(database.Client, "favorite")
+
+// Add saves a studio to the user's favourites. Saving the same studio twice
+// is not an error and leaves the studio's favourite count untouched.
+func (f Favorite) Add(ctx context.Context, traceID string, claims auth.Claims, userID string, studioID string, now time.Time) (Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.favorite.add")
+	defer span.End()
+
+	if err := checkIDs(userID, studioID); err != nil {
+		return Info{}, err
+	}
+
+	// If you are not an admin and looking to save for someone other than yourself.
+	if !claims.Authorized(auth.RoleAdmin) && claims.Subject != userID {
+		return Info{}, ErrForbidden
+	}
+
+	if _, err := f.studio.QueryByID(ctx, traceID, studioID, false); err != nil {
+		if errors.Cause(err) == studio.ErrNotFound {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, errors.Wrap(err, "checking studio")
+	}
+
+	// The document id is derived from the pair so the upsert is idempotent.
+	fav := Info{
+		ID:         favoriteID(userID, studioID),
+		UserID:     userID,
+		StudioID:   studioID,
+		Created_at: now.UTC(),
+	}
+
+	filter := bson.D{{Key: "_id", Value: fav.ID}}
+	update := bson.M{"$setOnInsert": bson.M{
+		"userid":     fav.UserID,
+		"studioid":   fav.StudioID,
+		"created_at": fav.Created_at,
+	}}
+	res, err := favoriteCollection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return Info{}, errors.Wrap(err, "saving favorite")
+	}
+
+	if res.UpsertedCount == 0 {
+		if err := favoriteCollection.FindOne(ctx, filter).Decode(&fav); err != nil {
+			return Info{}, errors.Wrap(err, "selecting favorite")
+		}
+		return fav, nil
+	}
+
+	if err := f.studio.AdjustFavorites(ctx, traceID, studioID, 1, now); err != nil {
+		return Info{}, errors.Wrap(err, "incrementing favorites")
+	}
+
+	f.log.Debug("favorite.Add", "trace_id", traceID)
+	return fav, nil
+}
+
+// Remove deletes a studio from the user's favourites.
+func (f Favorite) Remove(ctx context.Context, traceID string, claims auth.Claims, userID string, studioID string, now time.Time) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.favorite.remove")
+	defer span.End()
+
+	if err := checkIDs(userID, studioID); err != nil {
+		return err
+	}
+
+	// If you are not an admin and looking to remove for someone other than yourself.
+	if !claims.Authorized(auth.RoleAdmin) && claims.Subject != userID {
+		return ErrForbidden
+	}
+
+	res, err := favoriteCollection.DeleteOne(ctx, bson.D{{Key: "_id", Value: favoriteID(userID, studioID)}})
+	if err != nil {
+		return errors.Wrap(err, "removing favorite")
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	if err := f.studio.AdjustFavorites(ctx, traceID, studioID, -1, now); err != nil && errors.Cause(err) != studio.ErrNotFound {
+		return errors.Wrap(err, "decrementing favorites")
+	}
+
+	f.log.Debug("favorite.Remove", "trace_id", traceID)
+	return nil
+}
+
+// Query retrieves a page of the user's favourite studios, most recently
+// saved first.
+func (f Favorite) Query(ctx context.Context, traceID string, claims auth.Claims, userID string, pageNumber int, rowsPerPage int) ([]Studio, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.favorite.query")
+	defer span.End()
+
+	if err := validate.CheckID(userID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	// If you are not an admin and looking to retrieve someone other than yourself.
+	if !claims.Authorized(auth.RoleAdmin) && claims.Subject != userID {
+		return nil, ErrForbidden
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(int64((pageNumber - 1) * rowsPerPage)).
+		SetLimit(int64(rowsPerPage))
+
+	cur, err := favoriteCollection.Find(ctx, bson.D{{Key: "userid", Value: userID}}, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "selecting favorites")
+	}
+
+	var favs []Info
+	if err := cur.All(ctx, &favs); err != nil {
+		return nil, errors.Wrap(err, "decoding favorites")
+	}
+
+	ids := make([]string, len(favs))
+	for i, fav := range favs {
+		ids[i] = fav.StudioID
+	}
+
+	studios, err := f.studio.QueryByIDs(ctx, traceID, ids)
+	if err != nil {
+		return nil, errors.Wrap(err, "selecting favorite studios")
+	}
+
+	saved := []Studio{}
+	for _, fav := range favs {
+		std, ok := studios[fav.StudioID]
+		if !ok {
+			continue
+		}
+		saved = append(saved, Studio{
+			StudioID:   fav.StudioID,
+			Created_at: fav.Created_at,
+			Studio:     std,
+		})
+	}
+
+	f.log.Debug("favorite.Query", "trace_id", traceID)
+	return saved, nil
+}
+
+// Repoint moves the favourites saved against one studio onto another, as
+// when duplicate studios are merged. Users who saved both are left with a
+// single favourite. The target's counter is recounted from its favourites
+// at the end, so favourites moved by an earlier attempt that failed partway
+// are counted too. It reports how many favourites the target gained.
+func (f Favorite) Repoint(ctx context.Context, traceID string, fromID string, toID string, now time.Time) (int, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.favorite.repoint")
+	defer span.End()
+
+	if err := validate.CheckID(fromID); err != nil {
+		return 0, ErrInvalidID
+	}
+	if err := validate.CheckID(toID); err != nil {
+		return 0, ErrInvalidID
+	}
+
+	cur, err := favoriteCollection.Find(ctx, bson.D{{Key: "studioid", Value: fromID}})
+	if err != nil {
+		return 0, errors.Wrap(err, "selecting favorites")
+	}
+
+	var favs []Info
+	if err := cur.All(ctx, &favs); err != nil {
+		return 0, errors.Wrap(err, "decoding favorites")
+	}
+
+	var moved int
+	for _, fav := range favs {
+		filter := bson.D{{Key: "_id", Value: favoriteID(fav.UserID, toID)}}
+		update := bson.M{"$setOnInsert": bson.M{
+			"userid":     fav.UserID,
+			"studioid":   toID,
+			"created_at": fav.Created_at,
+		}}
+		res, err := favoriteCollection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+		if err != nil {
+			return moved, errors.Wrap(err, "saving favorite")
+		}
+		if res.UpsertedCount > 0 {
+			moved++
+		}
+
+		if _, err := favoriteCollection.DeleteOne(ctx, bson.D{{Key: "_id", Value: fav.ID}}); err != nil {
+			return moved, errors.Wrap(err, "removing favorite")
+		}
+	}
+
+	count, err := favoriteCollection.CountDocuments(ctx, bson.D{{Key: "studioid", Value: toID}})
+	if err != nil {
+		return moved, errors.Wrap(err, "counting favorites")
+	}
+	if err := f.studio.SetFavorites(ctx, traceID, toID, int(count), now); err != nil {
+		return moved, errors.Wrap(err, "recounting favorites")
+	}
+
+	f.log.Debug("favorite.Repoint", "trace_id", traceID)
+	return moved, nil
+}
+
+// checkIDs validates the user and studio ids of a favourite.
+func checkIDs(userID string, studioID string) error {
+	if err := validate.CheckID(userID); err != nil {
+		return ErrInvalidID
+	}
+	if err := validate.CheckID(studioID); err != nil {
+		return ErrInvalidID
+	}
+	return nil
+}
+
+// favoriteID derives the document id for a user and studio pair.
+func favoriteID(userID string, studioID string) string {
+	return userID + ":" + studioID
+}
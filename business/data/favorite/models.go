@@ -0,0 +1,22 @@
+package favorite
+
+import (
+	"time"
+
+	"github.com/nextwavedevs/drop/business/data/studio"
+)
+
+// Info represents a studio a user has saved to their favourites.
+type Info struct {
+	ID         string    `bson:"_id"`
+	UserID     string    `json:"user_id"`
+	StudioID   string    `json:"studio_id"`
+	Created_at time.Time `json:"created_at"`
+}
+
+// Studio is a saved studio returned when listing a user's favourites.
+type Studio struct {
+	StudioID   string      `json:"studio_id"`
+	Created_at time.Time   `json:"created_at"`
+	Studio     studio.Info `json:"studio"`
+}
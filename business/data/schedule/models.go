@@ -0,0 +1,67 @@
+package schedule
+
+import "time"
+
+// Instructor represents a person leading classes at a studio.
+type Instructor struct {
+	ID          string    `bson:"_id"`
+	StudioID    string    `json:"studio_id"`
+	Name        string    `json:"name"`
+	Email       string    `json:"email"`
+	Bio         string    `json:"bio"`
+	Photo_url   string    `json:"photo_url"`
+	Specialties []string  `json:"specialties"`
+	Created_at  time.Time `json:"created_at"`
+	Updated_at  time.Time `json:"updated_at"`
+}
+
+// NewInstructor contains information needed to create a new Instructor.
+type NewInstructor struct {
+	Name        string   `json:"name" validate:"required"`
+	Email       string   `json:"email" validate:"omitempty,email"`
+	Bio         string   `json:"bio"`
+	Photo_url   string   `json:"photo_url" validate:"omitempty,url"`
+	Specialties []string `json:"specialties"`
+}
+
+// Info represents a recurring class on a studio's timetable. Start is the
+// first occurrence and RRule, when set, is an RFC 5545 recurrence rule
+// expanded in the schedule's Timezone.
+type Info struct {
+	ID               string      `bson:"_id"`
+	StudioID         string      `json:"studio_id"`
+	InstructorID     string      `json:"instructor_id"`
+	Title            string      `json:"title"`
+	Description      string      `json:"description"`
+	Start            time.Time   `json:"start"`
+	Duration_minutes int         `json:"duration_minutes"`
+	Timezone         string      `json:"timezone"`
+	RRule            string      `json:"rrule"`
+	ExDates          []time.Time `json:"exdates"`
+	Created_at       time.Time   `json:"created_at"`
+	Updated_at       time.Time   `json:"updated_at"`
+}
+
+// NewSchedule contains information needed to create a new class schedule.
+type NewSchedule struct {
+	InstructorID     string      `json:"instructor_id"`
+	Title            string      `json:"title" validate:"required"`
+	Description      string      `json:"description"`
+	Start            time.Time   `json:"start" validate:"required"`
+	Duration_minutes int         `json:"duration_minutes" validate:"required,min=1,max=1440"`
+	Timezone         string      `json:"timezone" validate:"required"`
+	RRule            string      `json:"rrule"`
+	ExDates          []time.Time `json:"exdates"`
+}
+
+// Occurrence is a single concrete instance of a schedule on the timetable.
+type Occurrence struct {
+	ScheduleID   string      `json:"schedule_id"`
+	Title        string      `json:"title"`
+	Description  string      `json:"description"`
+	Start        time.Time   `json:"start"`
+	End          time.Time   `json:"end"`
+	Timezone     string      `json:"timezone"`
+	InstructorID string      `json:"instructor_id,omitempty"`
+	Instructor   *Instructor `json:"instructor,omitempty"`
+}
@@ -0,0 +1,454 @@
+// Package schedule manages a studio's instructors and the recurring classes
+// they lead, and expands those classes into a timetable.
+package schedule
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/nextwavedevs/drop/business/auth"
+	"github.com/nextwavedevs/drop/business/data/studio"
+	"github.com/nextwavedevs/drop/business/validate"
+	"github.com/nextwavedevs/drop/foundation/database"
+	"github.com/nextwavedevs/drop/foundation/logger"
+	"github.com/nextwavedevs/drop/foundation/rrule"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// MaxRange is the longest window a timetable can be expanded for.
+const MaxRange = 366 * 24 * time.Hour
+
+var (
+	// ErrNotFound is used when a specific schedule or instructor is requested
+	// but does not exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrInvalidID occurs when an ID is not in a valid form.
+	ErrInvalidID = errors.New("ID is not in its proper form")
+
+	// ErrForbidden occurs when a user tries to do something that is forbidden to them according to our access control policies.
+	ErrForbidden = errors.New("attempted action is not allowed")
+
+	// ErrInvalidRange occurs when a timetable is requested for a window that
+	// is empty, reversed or longer than MaxRange.
+	ErrInvalidRange = errors.New("invalid date range")
+)
+
+// Schedule manages the set of API's for schedule access.
+type Schedule struct {
+	log    *logger.Logger
+	db     *mongo.Client
+	studio studio.Studio
+}
+
+// New constructs a Schedule for api access.
+func New(log *logger.Logger, db *mongo.Client) Schedule {
+	return Schedule{
+		log:    log,
+		db:     db,
+		studio: studio.New(log, db),
+	}
+}
+
+var (
+	instructorCollection *mongo.Collection = database.OpenCollection(database.Client, "instructor")
+	scheduleCollection   *mongo.Collection = database.OpenCollection(database.Client, "schedule")
+)
+
+// CreateInstructor adds an instructor profile to a studio.
+func (s Schedule) CreateInstructor(ctx context.Context, traceID string, claims auth.Claims, studioID string, ni NewInstructor, now time.Time) (Instructor, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.schedule.createinstructor")
+	defer span.End()
+
+	if err := validate.CheckID(studioID); err != nil {
+		return Instructor{}, ErrInvalidID
+	}
+	if err := validate.Check(ni); err != nil {
+		return Instructor{}, errors.Wrap(err, "validating data")
+	}
+	if err := s.checkOwner(ctx, traceID, claims, studioID); err != nil {
+		return Instructor{}, err
+	}
+
+	ins := Instructor{
+		ID:          validate.GenerateID(),
+		StudioID:    studioID,
+		Name:        ni.Name,
+		Email:       ni.Email,
+		Bio:         ni.Bio,
+		Photo_url:   ni.Photo_url,
+		Specialties: ni.Specialties,
+		Created_at:  now.UTC(),
+		Updated_at:  now.UTC(),
+	}
+
+	if _, err := instructorCollection.InsertOne(ctx, ins); err != nil {
+		return Instructor{}, errors.Wrap(err, "inserting instructor")
+	}
+
+	s.log.Debug("schedule.CreateInstructor", "trace_id", traceID)
+	return ins, nil
+}
+
+// DeleteInstructor removes an instructor profile. Classes they led are kept
+// but no longer reference them.
+func (s Schedule) DeleteInstructor(ctx context.Context, traceID string, claims auth.Claims, instructorID string) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.schedule.deleteinstructor")
+	defer span.End()
+
+	ins, err := s.QueryInstructorByID(ctx, traceID, instructorID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkOwner(ctx, traceID, claims, ins.StudioID); err != nil {
+		return err
+	}
+
+	if _, err := instructorCollection.DeleteOne(ctx, bson.D{{Key: "_id", Value: ins.ID}}); err != nil {
+		return errors.Wrap(err, "deleting instructor")
+	}
+
+	filter := bson.M{"instructorid": ins.ID}
+	update := bson.M{"$set": bson.M{"instructorid": ""}}
+	if _, err := scheduleCollection.UpdateMany(ctx, filter, update); err != nil {
+		return errors.Wrap(err, "detaching instructor from schedules")
+	}
+
+	s.log.Debug("schedule.DeleteInstructor", "trace_id", traceID)
+	return nil
+}
+
+// QueryInstructors retrieves the instructors of a studio.
+func (s Schedule) QueryInstructors(ctx context.Context, traceID string, studioID string) ([]Instructor, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.schedule.queryinstructors")
+	defer span.End()
+
+	if err := validate.CheckID(studioID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cur, err := instructorCollection.Find(ctx, bson.D{{Key: "studioid", Value: studioID}}, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "selecting instructors")
+	}
+
+	instructors := []Instructor{}
+	if err := cur.All(ctx, &instructors); err != nil {
+		return nil, errors.Wrap(err, "decoding instructors")
+	}
+
+	s.log.Debug("schedule.QueryInstructors", "trace_id", traceID)
+	return instructors, nil
+}
+
+// QueryInstructorByID gets the specified instructor from the database.
+func (s Schedule) QueryInstructorByID(ctx context.Context, traceID string, instructorID string) (Instructor, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.schedule.queryinstructorbyid")
+	defer span.End()
+
+	if err := validate.CheckID(instructorID); err != nil {
+		return Instructor{}, ErrInvalidID
+	}
+
+	var ins Instructor
+	if err := instructorCollection.FindOne(ctx, bson.D{{Key: "_id", Value: instructorID}}).Decode(&ins); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return Instructor{}, ErrNotFound
+		}
+		return Instructor{}, errors.Wrapf(err, "selecting instructor %q", instructorID)
+	}
+
+	s.log.Debug("schedule.QueryInstructorByID", "trace_id", traceID)
+	return ins, nil
+}
+
+// Create adds a class to a studio's timetable.
+func (s Schedule) Create(ctx context.Context, traceID string, claims auth.Claims, studioID string, ns NewSchedule, now time.Time) (Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.schedule.create")
+	defer span.End()
+
+	if err := validate.CheckID(studioID); err != nil {
+		return Info{}, ErrInvalidID
+	}
+	if err := validate.Check(ns); err != nil {
+		return Info{}, errors.Wrap(err, "validating data")
+	}
+
+	var fields validate.FieldErrors
+	if _, err := time.LoadLocation(ns.Timezone); err != nil {
+		fields = append(fields, validate.FieldError{Field: "timezone", Error: "timezone must be an IANA time zone name"})
+	}
+	rule := ns.RRule
+	if rule != "" {
+		r, err := rrule.Parse(rule)
+		if err != nil {
+			fields = append(fields, validate.FieldError{Field: "rrule", Error: err.Error()})
+		}
+		rule = r.String()
+	}
+	if fields != nil {
+		return Info{}, errors.Wrap(fields, "validating data")
+	}
+
+	if err := s.checkOwner(ctx, traceID, claims, studioID); err != nil {
+		return Info{}, err
+	}
+
+	if ns.InstructorID != "" {
+		ins, err := s.QueryInstructorByID(ctx, traceID, ns.InstructorID)
+		if err != nil || ins.StudioID != studioID {
+			return Info{}, errors.Wrap(validate.FieldErrors{{Field: "instructor_id", Error: "instructor_id must be an instructor of this studio"}}, "validating data")
+		}
+	}
+
+	exdates := make([]time.Time, len(ns.ExDates))
+	for i, t := range ns.ExDates {
+		exdates[i] = t.UTC()
+	}
+
+	sch := Info{
+		ID:               validate.GenerateID(),
+		StudioID:         studioID,
+		InstructorID:     ns.InstructorID,
+		Title:            ns.Title,
+		Description:      ns.Description,
+		Start:            ns.Start.UTC(),
+		Duration_minutes: ns.Duration_minutes,
+		Timezone:         ns.Timezone,
+		RRule:            rule,
+		ExDates:          exdates,
+		Created_at:       now.UTC(),
+		Updated_at:       now.UTC(),
+	}
+
+	if _, err := scheduleCollection.InsertOne(ctx, sch); err != nil {
+		return Info{}, errors.Wrap(err, "inserting schedule")
+	}
+
+	s.log.Debug("schedule.Create", "trace_id", traceID)
+	return sch, nil
+}
+
+// Delete removes a class from a studio's timetable.
+func (s Schedule) Delete(ctx context.Context, traceID string, claims auth.Claims, scheduleID string) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.schedule.delete")
+	defer span.End()
+
+	sch, err := s.QueryByID(ctx, traceID, scheduleID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkOwner(ctx, traceID, claims, sch.StudioID); err != nil {
+		return err
+	}
+
+	if _, err := scheduleCollection.DeleteOne(ctx, bson.D{{Key: "_id", Value: sch.ID}}); err != nil {
+		return errors.Wrap(err, "deleting schedule")
+	}
+
+	s.log.Debug("schedule.Delete", "trace_id", traceID)
+	return nil
+}
+
+// Query retrieves the class definitions of a studio.
+func (s Schedule) Query(ctx context.Context, traceID string, studioID string) ([]Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.schedule.query")
+	defer span.End()
+
+	if err := validate.CheckID(studioID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "start", Value: 1}})
+	cur, err := scheduleCollection.Find(ctx, bson.D{{Key: "studioid", Value: studioID}}, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "selecting schedules")
+	}
+
+	schedules := []Info{}
+	if err := cur.All(ctx, &schedules); err != nil {
+		return nil, errors.Wrap(err, "decoding schedules")
+	}
+
+	s.log.Debug("schedule.Query", "trace_id", traceID)
+	return schedules, nil
+}
+
+// QueryByID gets the specified schedule from the database.
+func (s Schedule) QueryByID(ctx context.Context, traceID string, scheduleID string) (Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.schedule.querybyid")
+	defer span.End()
+
+	if err := validate.CheckID(scheduleID); err != nil {
+		return Info{}, ErrInvalidID
+	}
+
+	var sch Info
+	if err := scheduleCollection.FindOne(ctx, bson.D{{Key: "_id", Value: scheduleID}}).Decode(&sch); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, errors.Wrapf(err, "selecting schedule %q", scheduleID)
+	}
+
+	s.log.Debug("schedule.QueryByID", "trace_id", traceID)
+	return sch, nil
+}
+
+// Timetable expands every class of a studio into the occurrences starting
+// within [from, to), ordered by start time.
+func (s Schedule) Timetable(ctx context.Context, traceID string, studioID string, from time.Time, to time.Time) ([]Occurrence, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.schedule.timetable")
+	defer span.End()
+
+	if !to.After(from) || to.Sub(from) > MaxRange {
+		return nil, ErrInvalidRange
+	}
+
+	schedules, err := s.Query(ctx, traceID, studioID)
+	if err != nil {
+		return nil, err
+	}
+
+	instructors, err := s.QueryInstructors(ctx, traceID, studioID)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*Instructor, len(instructors))
+	for i := range instructors {
+		byID[instructors[i].ID] = &instructors[i]
+	}
+
+	occurrences := []Occurrence{}
+	for _, sch := range schedules {
+		occs, err := Expand(sch, from, to)
+		if err != nil {
+			s.log.Warn("schedule.Timetable: skipping schedule", "trace_id", traceID, "schedule_id", sch.ID, "error", err)
+			continue
+		}
+		for i := range occs {
+			occs[i].Instructor = byID[occs[i].InstructorID]
+		}
+		occurrences = append(occurrences, occs...)
+	}
+
+	sort.Slice(occurrences, func(i, j int) bool {
+		return occurrences[i].Start.Before(occurrences[j].Start)
+	})
+
+	s.log.Debug("schedule.Timetable", "trace_id", traceID)
+	return occurrences, nil
+}
+
+// =============================================================================
+
+// Expand returns the occurrences of a schedule starting within [from, to).
+// Occurrences are computed in the schedule's time zone so classes keep their
+// local start time across daylight saving changes.
+func Expand(sch Info, from time.Time, to time.Time) ([]Occurrence, error) {
+	loc, err := time.LoadLocation(sch.Timezone)
+	if err != nil {
+		return nil, errors.Wrapf(err, "loading timezone %q", sch.Timezone)
+	}
+	start := sch.Start.In(loc)
+
+	starts := []time.Time{start}
+	if sch.RRule != "" {
+		r, err := rrule.Parse(sch.RRule)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing rrule")
+		}
+		starts = r.Between(start, from, to)
+	} else if start.Before(from) || !start.Before(to) {
+		starts = nil
+	}
+
+	excluded := make(map[int64]bool, len(sch.ExDates))
+	for _, t := range sch.ExDates {
+		excluded[t.Unix()] = true
+	}
+
+	duration := time.Duration(sch.Duration_minutes) * time.Minute
+	var occs []Occurrence
+	for _, t := range starts {
+		if excluded[t.Unix()] {
+			continue
+		}
+		occs = append(occs, Occurrence{
+			ScheduleID:   sch.ID,
+			Title:        sch.Title,
+			Description:  sch.Description,
+			Start:        t,
+			End:          t.Add(duration),
+			Timezone:     sch.Timezone,
+			InstructorID: sch.InstructorID,
+		})
+	}
+
+	return occs, nil
+}
+
+// Repoint moves the instructors and schedules of one studio onto another,
+// as when duplicate studios are merged. It reports how many records moved.
+func (s Schedule) Repoint(ctx context.Context, traceID string, fromID string, toID string) (int64, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.schedule.repoint")
+	defer span.End()
+
+	if err := validate.CheckID(fromID); err != nil {
+		return 0, ErrInvalidID
+	}
+	if err := validate.CheckID(toID); err != nil {
+		return 0, ErrInvalidID
+	}
+
+	filter := bson.M{"studioid": fromID}
+	update := bson.M{"$set": bson.M{"studioid": toID}}
+
+	var moved int64
+	for name, coll := range map[string]*mongo.Collection{
+		"instructors": instructorCollection,
+		"schedules":   scheduleCollection,
+	} {
+		res, err := coll.UpdateMany(ctx, filter, update)
+		if err != nil {
+			return moved, errors.Wrapf(err, "repointing %s", name)
+		}
+		moved += res.ModifiedCount
+	}
+
+	s.log.Debug("schedule.Repoint", "trace_id", traceID)
+	return moved, nil
+}
+
+// checkOwner verifies the claims may manage the specified studio.
+func (s Schedule) checkOwner(ctx context.Context, traceID string, claims auth.Claims, studioID string) error {
+	err := s.studio.CheckOwner(ctx, traceID, claims, studioID)
+	switch errors.Cause(err) {
+	case nil:
+		return nil
+	case studio.ErrNotFound:
+		return ErrNotFound
+	case studio.ErrInvalidID:
+		return ErrInvalidID
+	case studio.ErrForbidden:
+		return ErrForbidden
+	default:
+		return errors.Wrap(err, "checking studio owner")
+	}
+}
@@ -0,0 +1,167 @@
+package studio
+
+import (
+	"context"
+	"time"
+
+	"github.com/nextwavedevs/drop/business/auth"
+	"github.com/nextwavedevs/drop/business/data/brand"
+	"github.com/nextwavedevs/drop/business/validate"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// QueryByBrand retrieves a page of the live studios of a brand ordered by
+// name.
+func (u Studio) QueryByBrand(ctx context.Context, traceID string, brandID string, pageNumber int, rowsPerPage int) ([]Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.studio.querybybrand")
+	defer span.End()
+
+	if err := validate.CheckID(brandID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}).
+		SetSkip(int64((pageNumber - 1) * rowsPerPage)).
+		SetLimit(int64(rowsPerPage))
+
+	cur, err := studioCollection.Find(ctx, bson.M{"brandid": brandID, "deleted_at": nil}, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "selecting studios")
+	}
+
+	studios := []Info{}
+	if err := cur.All(ctx, &studios); err != nil {
+		return nil, errors.Wrap(err, "decoding studios")
+	}
+
+	u.log.Debug("studio.QueryByBrand", "trace_id", traceID)
+	return studios, nil
+}
+
+// SetBrand adds a studio to a brand, or takes it out of its brand when
+// brandID is empty. Adding a studio takes both the right to manage the
+// studio and to manage the brand; taking it out needs either.
+func (u Studio) SetBrand(ctx context.Context, traceID string, claims auth.Claims, studioID string, brandID string, now time.Time) (Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.studio.setbrand")
+	defer span.End()
+
+	std, err := u.QueryByID(ctx, traceID, studioID, false)
+	if err != nil {
+		return Info{}, err
+	}
+
+	switch {
+	case brandID != "":
+		if err := u.CheckOwner(ctx, traceID, claims, studioID); err != nil {
+			return Info{}, err
+		}
+		if err := u.brand.CheckAdmin(ctx, traceID, claims, brandID); err != nil {
+			return Info{}, err
+		}
+	case std.BrandID != "":
+		if err := u.CheckOwner(ctx, traceID, claims, studioID); err != nil {
+			return Info{}, err
+		}
+	}
+
+	if std.BrandID == brandID {
+		return std, nil
+	}
+
+	filter := bson.M{"_id": std.ID, "deleted_at": nil}
+	update := bson.M{"$set": bson.M{"brandid": brandID, "updated_at": now.UTC()}, "$inc": bson.M{"version": 1}}
+	if err := u.set(ctx, traceID, std.ID, filter, update, now); err != nil {
+		return Info{}, errors.Wrap(err, "setting brand")
+	}
+
+	std, err = u.QueryByID(ctx, traceID, std.ID, false)
+	if err != nil {
+		return Info{}, err
+	}
+
+	u.log.Debug("studio.SetBrand", "trace_id", traceID)
+	return std, nil
+}
+
+// DetachBrand takes every studio out of a brand, such as when the brand is
+// removed, and returns how many were changed.
+func (u Studio) DetachBrand(ctx context.Context, traceID string, brandID string, now time.Time) (int64, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.studio.detachbrand")
+	defer span.End()
+
+	if err := validate.CheckID(brandID); err != nil {
+		return 0, ErrInvalidID
+	}
+
+	update := bson.M{"$set": bson.M{"brandid": "", "updated_at": now.UTC()}, "$inc": bson.M{"version": 1}}
+	n, err := u.setMany(ctx, traceID, bson.M{"brandid": brandID}, update, now)
+	if err != nil {
+		return n, errors.Wrapf(err, "detaching studios of brand %q", brandID)
+	}
+
+	u.log.Debug("studio.DetachBrand", "trace_id", traceID)
+	return n, nil
+}
+
+// Inherit fills in the logo, description and socials the studios leave blank
+// from their brand, naming the fields taken from it in Inherited. Studios
+// without a brand, or whose brand is gone, are left alone.
+func (u Studio) Inherit(ctx context.Context, traceID string, studios ...*Info) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.studio.inherit")
+	defer span.End()
+
+	var ids []string
+	for _, std := range studios {
+		if std.BrandID != "" {
+			ids = append(ids, std.BrandID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	brands, err := u.brand.QueryByIDs(ctx, traceID, ids)
+	if err != nil {
+		return errors.Wrap(err, "selecting brands")
+	}
+
+	for _, std := range studios {
+		brd, ok := brands[std.BrandID]
+		if !ok {
+			continue
+		}
+		inherit(std, brd)
+	}
+
+	u.log.Debug("studio.Inherit", "trace_id", traceID)
+	return nil
+}
+
+// inherit fills in the blank shared fields of a studio from its brand and
+// notes when the brand last changed, as that changes what is inherited.
+func inherit(std *Info, brd brand.Info) {
+	std.Inherited = nil
+	std.BrandUpdated = brd.Updated_at
+	for _, f := range []struct {
+		name  string
+		field *string
+		value string
+	}{
+		{"logo", &std.Logo, brd.Logo},
+		{"description", &std.Description, brd.Description},
+		{"socials", &std.SocialHandle, brd.SocialHandle},
+	} {
+		if *f.field == "" && f.value != "" {
+			*f.field = f.value
+			std.Inherited = append(std.Inherited, f.name)
+		}
+	}
+}
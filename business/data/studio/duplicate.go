@@ -0,0 +1,393 @@
+package studio
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/nextwavedevs/drop/business/auth"
+	"github.com/nextwavedevs/drop/business/data/audit"
+	"github.com/nextwavedevs/drop/business/data/tag"
+	"github.com/nextwavedevs/drop/business/validate"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DuplicateThreshold is the score at or above which two studios are reported
+// as duplicates when no other threshold is asked for.
+const DuplicateThreshold = 0.6
+
+// Weights of each field in the score of a pair of studios. They add up to one.
+const (
+	nameWeight  = 0.5
+	emailWeight = 0.3
+	cityWeight  = 0.2
+)
+
+// stopWords are left out of names before they are compared since nearly
+// every studio carries one of them.
+var stopWords = map[string]bool{
+	"the": true, "and": true, "studio": true, "studios": true,
+}
+
+// freeMail lists email domains shared by unrelated people, which say nothing
+// about two studios being the same.
+var freeMail = map[string]bool{
+	"gmail.com": true, "googlemail.com": true, "yahoo.com": true, "hotmail.com": true,
+	"outlook.com": true, "live.com": true, "icloud.com": true, "aol.com": true,
+}
+
+// Duplicates lists the pairs of live studios scoring at or above threshold,
+// best match first. Only studios sharing a city or an email are compared.
+// A limit of zero returns every pair.
+func (u Studio) Duplicates(ctx context.Context, traceID string, threshold float64, limit int) ([]Duplicate, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.studio.duplicates")
+	defer span.End()
+
+	cur, err := studioCollection.Find(ctx, bson.M{"deleted_at": nil}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, errors.Wrap(err, "selecting studios")
+	}
+
+	var studios []Info
+	if err := cur.All(ctx, &studios); err != nil {
+		return nil, errors.Wrap(err, "decoding studios")
+	}
+
+	// Group the studios into blocks so only likely pairs are scored.
+	blocks := make(map[string][]int)
+	for i, std := range studios {
+		if city := normalize(std.Address.Locality); city != "" {
+			blocks["city:"+city] = append(blocks["city:"+city], i)
+		}
+		if email := normalizeEmail(std.Email); email != "" {
+			blocks["email:"+email] = append(blocks["email:"+email], i)
+		}
+	}
+
+	dups := []Duplicate{}
+	seen := make(map[[2]int]bool)
+	for _, block := range blocks {
+		for x := 0; x < len(block); x++ {
+			for y := x + 1; y < len(block); y++ {
+				pair := [2]int{block[x], block[y]}
+				if seen[pair] {
+					continue
+				}
+				seen[pair] = true
+
+				a, b := studios[pair[0]], studios[pair[1]]
+				sc, reasons := score(a, b)
+				if sc < threshold {
+					continue
+				}
+				dups = append(dups, Duplicate{A: a, B: b, Score: sc, Reasons: reasons})
+			}
+		}
+	}
+
+	sort.Slice(dups, func(i, j int) bool {
+		if dups[i].Score != dups[j].Score {
+			return dups[i].Score > dups[j].Score
+		}
+		if dups[i].A.ID != dups[j].A.ID {
+			return dups[i].A.ID < dups[j].A.ID
+		}
+		return dups[i].B.ID < dups[j].B.ID
+	})
+	if limit > 0 && len(dups) > limit {
+		dups = dups[:limit]
+	}
+
+	u.log.Debug("studio.Duplicates", "trace_id", traceID)
+	return dups, nil
+}
+
+// Merge folds the duplicate studio into the one kept. Blank fields of the
+// kept studio are filled from the duplicate and their tags and owners are
+// combined. The duplicate is archived with a pointer to the kept studio so
+// its id keeps resolving. Running a merge again is harmless, which lets a
+// caller retry after re-pointing related records failed.
+func (u Studio) Merge(ctx context.Context, traceID string, claims auth.Claims, ms MergeStudios, now time.Time) (Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.studio.merge")
+	defer span.End()
+
+	if !claims.Authorized(auth.RoleAdmin) {
+		return Info{}, ErrForbidden
+	}
+	if err := validate.Check(ms); err != nil {
+		return Info{}, errors.Wrap(err, "validating data")
+	}
+	if err := validate.CheckID(ms.KeepID); err != nil {
+		return Info{}, ErrInvalidID
+	}
+	if err := validate.CheckID(ms.MergeID); err != nil {
+		return Info{}, ErrInvalidID
+	}
+
+	dup, err := u.QueryByID(ctx, traceID, ms.MergeID, true)
+	if err != nil {
+		return Info{}, errors.Wrap(err, "selecting duplicate")
+	}
+	merged := dup.Merged_into == ms.KeepID
+	if dup.Deleted_at != nil && !merged {
+		return Info{}, ErrNotFound
+	}
+
+	keep, err := u.QueryByID(ctx, traceID, ms.KeepID, false)
+	if err != nil {
+		return Info{}, errors.Wrap(err, "selecting studio")
+	}
+
+	if !merged {
+		update := bson.M{
+			"$set": bson.M{"deleted_at": now.UTC(), "deleted_by": claims.Subject, "merged_into": keep.ID},
+			"$inc": bson.M{"version": 1},
+		}
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+		var after Info
+		if err := studioCollection.FindOneAndUpdate(ctx, versionFilter(dup.ID, dup.Version), update, opts).Decode(&after); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return Info{}, missing(ctx, dup.ID)
+			}
+			return Info{}, errors.Wrapf(err, "archiving studio %q", dup.ID)
+		}
+		if err := u.audit.Record(ctx, traceID, entity, dup.ID, audit.ActionMerge, dup, after, now); err != nil {
+			return Info{}, err
+		}
+
+		// Studios merged into the duplicate earlier now redirect to the kept one.
+		update = bson.M{"$set": bson.M{"merged_into": keep.ID, "updated_at": now.UTC()}, "$inc": bson.M{"version": 1}}
+		if _, err := u.setMany(ctx, traceID, bson.M{"merged_into": dup.ID}, update, now); err != nil {
+			return Info{}, errors.Wrap(err, "moving redirects")
+		}
+	}
+
+	set := combine(keep, dup)
+	if len(set) == 0 {
+		u.log.Debug("studio.Merge", "trace_id", traceID)
+		return keep, nil
+	}
+	set["updated_at"] = now.UTC()
+
+	update := bson.M{"$set": set, "$inc": bson.M{"version": 1}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var result Info
+	if err := studioCollection.FindOneAndUpdate(ctx, versionFilter(keep.ID, keep.Version), update, opts).Decode(&result); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return Info{}, missing(ctx, keep.ID)
+		}
+		return Info{}, errors.Wrapf(err, "updating studio %q", keep.ID)
+	}
+
+	if err := u.audit.Record(ctx, traceID, entity, keep.ID, audit.ActionMerge, keep, result, now); err != nil {
+		return Info{}, err
+	}
+
+	u.log.Debug("studio.Merge", "trace_id", traceID)
+	return result, nil
+}
+
+// MergedInto returns the id of the studio the given studio was merged into.
+// ErrNotFound is returned for studios that were never merged.
+func (u Studio) MergedInto(ctx context.Context, traceID string, studioID string) (string, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.studio.mergedinto")
+	defer span.End()
+
+	if err := validate.CheckID(studioID); err != nil {
+		return "", ErrInvalidID
+	}
+
+	var std Info
+	filter := bson.M{"_id": studioID, "merged_into": bson.M{"$nin": bson.A{"", nil}}}
+	if err := studioCollection.FindOne(ctx, filter).Decode(&std); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return "", ErrNotFound
+		}
+		return "", errors.Wrapf(err, "selecting studio %q", studioID)
+	}
+
+	u.log.Debug("studio.MergedInto", "trace_id", traceID)
+	return std.Merged_into, nil
+}
+
+// combine works out the fields of keep to set when dup is folded into it.
+func combine(keep Info, dup Info) bson.M {
+	set := bson.M{}
+	for key, f := range map[string]struct{ keep, dup string }{
+		"email":        {keep.Email, dup.Email},
+		"socialhandle": {keep.SocialHandle, dup.SocialHandle},
+		"description":  {keep.Description, dup.Description},
+		"logo":         {keep.Logo, dup.Logo},
+		"brandid":      {keep.BrandID, dup.BrandID},
+		"externalid":   {keep.ExternalID, dup.ExternalID},
+	} {
+		if f.keep == "" && f.dup != "" {
+			set[key] = f.dup
+		}
+	}
+
+	// Only fill in the address from a duplicate in the same country, whose
+	// regions and postal codes are valid for it.
+	if keep.Address.Country == dup.Address.Country {
+		for key, f := range map[string]struct{ keep, dup string }{
+			"address.region":     {keep.Address.Region, dup.Address.Region},
+			"address.postalcode": {keep.Address.PostalCode, dup.Address.PostalCode},
+		} {
+			if f.keep == "" && f.dup != "" {
+				set[key] = f.dup
+			}
+		}
+		if len(keep.Address.Lines) == 0 && len(dup.Address.Lines) > 0 {
+			set["address.lines"] = dup.Address.Lines
+		}
+	}
+	if tags := union(keep.Tags, tag.NormalizeSlugs(dup.Tags)); len(tags) != len(keep.Tags) {
+		set["tags"] = tags
+	}
+	if owners := union(keep.Owners, dup.Owners); len(owners) != len(keep.Owners) {
+		set["owners"] = owners
+	}
+	return set
+}
+
+// union appends the values of b missing from a.
+func union(a []string, b []string) []string {
+	out := append([]string{}, a...)
+	have := make(map[string]bool, len(a))
+	for _, v := range a {
+		have[v] = true
+	}
+	for _, v := range b {
+		if !have[v] {
+			have[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// score rates how alike two studios are from zero to one and names the
+// fields that matched.
+func score(a Info, b Info) (float64, []string) {
+	var sc float64
+	reasons := []string{}
+
+	if sim := similarity(normalizeName(a.Name), normalizeName(b.Name)); sim > 0 {
+		sc += nameWeight * sim
+		if sim >= 0.8 {
+			reasons = append(reasons, "name")
+		}
+	}
+
+	ea, eb := normalizeEmail(a.Email), normalizeEmail(b.Email)
+	switch da, db := domain(ea), domain(eb); {
+	case ea != "" && ea == eb:
+		sc += emailWeight
+		reasons = append(reasons, "email")
+	case da != "" && da == db && !freeMail[da]:
+		sc += emailWeight / 2
+		reasons = append(reasons, "email_domain")
+	}
+
+	if ca := normalize(a.Address.Locality); ca != "" && ca == normalize(b.Address.Locality) {
+		sc += cityWeight
+		reasons = append(reasons, "city")
+	}
+
+	return sc, reasons
+}
+
+// similarity is the Dice coefficient of the letter pairs of two strings,
+// ignoring spaces.
+func similarity(a string, b string) float64 {
+	a, b = strings.ReplaceAll(a, " ", ""), strings.ReplaceAll(b, " ", "")
+	if a == "" || b == "" {
+		return 0
+	}
+	if a == b {
+		return 1
+	}
+
+	pa, pb := bigrams(a), bigrams(b)
+	if len(pa) == 0 || len(pb) == 0 {
+		return 0
+	}
+
+	counts := make(map[string]int, len(pa))
+	for _, p := range pa {
+		counts[p]++
+	}
+	var shared int
+	for _, p := range pb {
+		if counts[p] > 0 {
+			counts[p]--
+			shared++
+		}
+	}
+
+	return 2 * float64(shared) / float64(len(pa)+len(pb))
+}
+
+// bigrams splits s into its overlapping pairs of runes.
+func bigrams(s string) []string {
+	r := []rune(s)
+	if len(r) < 2 {
+		return nil
+	}
+	pairs := make([]string, len(r)-1)
+	for i := range pairs {
+		pairs[i] = string(r[i : i+2])
+	}
+	return pairs
+}
+
+// normalize lower cases s and reduces it to words of letters and digits.
+func normalize(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// normalizeName normalizes a studio name and drops its stop words.
+func normalizeName(s string) string {
+	var words []string
+	for _, w := range strings.Fields(normalize(s)) {
+		if !stopWords[w] {
+			words = append(words, w)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// normalizeEmail lower cases an email and drops any +tag from its mailbox.
+func normalizeEmail(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	at := strings.LastIndex(s, "@")
+	if at < 0 {
+		return s
+	}
+	local, host := s[:at], s[at+1:]
+	if plus := strings.Index(local, "+"); plus >= 0 {
+		local = local[:plus]
+	}
+	return local + "@" + host
+}
+
+// domain returns the part of a normalized email after the @.
+func domain(email string) string {
+	if at := strings.LastIndex(email, "@"); at >= 0 {
+		return email[at+1:]
+	}
+	return ""
+}
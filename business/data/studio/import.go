@@ -0,0 +1,306 @@
+package studio
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/nextwavedevs/drop/business/validate"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrMalformedRow is wrapped by the errors of import rows that can't be
+// decoded.
+var ErrMalformedRow = errors.New("malformed row")
+
+// RowReader yields the studios of an import one row at a time. Next returns
+// io.EOF once the rows are exhausted and an error wrapping ErrMalformedRow
+// for a row that can't be decoded, after which reading can carry on.
+type RowReader interface {
+	Next() (NewStudio, error)
+}
+
+// Import creates or updates a studio for every row read. A row is matched to
+// a live studio by its external id when it carries one and by email
+// otherwise. Matched studios take the values of the row, except that empty
+// optional fields leave the stored value alone. Rows that are malformed or
+// fail validation are reported and skipped, any other error stops the import.
+func (u Studio) Import(ctx context.Context, traceID string, rows RowReader, now time.Time) (ImportReport, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.studio.import")
+	defer span.End()
+
+	report := ImportReport{Rows: []ImportRow{}}
+	for n := 1; ; n++ {
+		ns, err := rows.Next()
+		if err == io.EOF {
+			break
+		}
+
+		row := ImportRow{Row: n}
+		if err == nil {
+			row.Status, row.ID, err = u.importRow(ctx, traceID, ns, now)
+		}
+		if err != nil {
+			switch cause := errors.Cause(err).(type) {
+			case validate.FieldErrors:
+				row.Error = "data validation error"
+				row.Fields = cause
+			default:
+				if cause != ErrMalformedRow && cause != ErrVersionMismatch {
+					return report, errors.Wrapf(err, "importing row %d", n)
+				}
+				row.Error = err.Error()
+			}
+			row.Status = RowFailed
+		}
+
+		switch row.Status {
+		case RowCreated:
+			report.Created++
+		case RowUpdated:
+			report.Updated++
+		case RowUnchanged:
+			report.Unchanged++
+		case RowFailed:
+			report.Failed++
+		}
+		report.Rows = append(report.Rows, row)
+	}
+
+	u.log.Debug("studio.Import", "trace_id", traceID)
+	return report, nil
+}
+
+// importRow upserts the studio of a single row and reports the outcome along
+// with the id of the studio.
+func (u Studio) importRow(ctx context.Context, traceID string, ns NewStudio, now time.Time) (string, string, error) {
+	if err := validate.Check(ns); err != nil {
+		return "", "", errors.Wrap(err, "validating data")
+	}
+
+	filter := bson.M{"deleted_at": nil}
+	if ns.ExternalID != "" {
+		filter["externalid"] = ns.ExternalID
+	} else {
+		filter["email"] = ns.Email
+	}
+
+	var std Info
+	if err := studioCollection.FindOne(ctx, filter).Decode(&std); err != nil {
+		if err != mongo.ErrNoDocuments {
+			return "", "", errors.Wrap(err, "selecting studio")
+		}
+
+		std, err := u.Create(ctx, traceID, ns, now)
+		if err != nil {
+			return "", "", err
+		}
+		return RowCreated, std.ID, nil
+	}
+
+	// Blank optional address fields keep what the studio already has.
+	addr := ns.Address
+	if addr.Country == std.Address.Country {
+		if len(addr.Lines) == 0 {
+			addr.Lines = std.Address.Lines
+		}
+		if addr.Region == "" {
+			addr.Region = std.Address.Region
+		}
+		if addr.PostalCode == "" {
+			addr.PostalCode = std.Address.PostalCode
+		}
+	}
+
+	us := UpdateStudio{
+		Name:    &ns.Name,
+		Email:   &ns.Email,
+		Address: &addr,
+	}
+	if ns.SocialHandle != "" {
+		us.SocialHandle = &ns.SocialHandle
+	}
+	if ns.Description != "" {
+		us.Description = &ns.Description
+	}
+	if ns.Logo != "" {
+		us.Logo = &ns.Logo
+	}
+	if len(ns.Tags) > 0 {
+		us.Tags = ns.Tags
+	}
+	if ns.ExternalID != "" {
+		us.ExternalID = &ns.ExternalID
+	}
+
+	updated, err := u.update(ctx, traceID, std, changes(editable(std), us), now)
+	if err != nil {
+		return "", "", err
+	}
+	if updated.Version == std.Version {
+		return RowUnchanged, std.ID, nil
+	}
+	return RowUpdated, std.ID, nil
+}
+
+// =============================================================================
+
+// csvFields maps the columns of a CSV import onto the fields of a studio.
+// Column names match the JSON names of the fields, with the address spread
+// over address_line1 to 3, locality, region, postal_code and country. The
+// older city and state columns fill in the locality and region, and country
+// names are turned into their codes.
+var csvFields = map[string]func(ns *NewStudio, v string){
+	"name":          func(ns *NewStudio, v string) { ns.Name = v },
+	"email":         func(ns *NewStudio, v string) { ns.Email = v },
+	"socials":       func(ns *NewStudio, v string) { ns.SocialHandle = v },
+	"description":   func(ns *NewStudio, v string) { ns.Description = v },
+	"logo":          func(ns *NewStudio, v string) { ns.Logo = v },
+	"address_line1": func(ns *NewStudio, v string) { ns.Address.Lines = setLine(ns.Address.Lines, 0, v) },
+	"address_line2": func(ns *NewStudio, v string) { ns.Address.Lines = setLine(ns.Address.Lines, 1, v) },
+	"address_line3": func(ns *NewStudio, v string) { ns.Address.Lines = setLine(ns.Address.Lines, 2, v) },
+	"locality":      func(ns *NewStudio, v string) { ns.Address.Locality = v },
+	"region":        func(ns *NewStudio, v string) { ns.Address.Region = v },
+	"postal_code":   func(ns *NewStudio, v string) { ns.Address.PostalCode = v },
+	"city":          func(ns *NewStudio, v string) { ns.Address.Locality = v },
+	"state":         func(ns *NewStudio, v string) { ns.Address.Region = v },
+	"country": func(ns *NewStudio, v string) {
+		if code, ok := validate.CountryCode(v); ok {
+			v = code
+		}
+		ns.Address.Country = v
+	},
+	"external_id": func(ns *NewStudio, v string) { ns.ExternalID = v },
+	"tags": func(ns *NewStudio, v string) {
+		ns.Tags = strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ';' })
+	},
+}
+
+// csvRows reads studios from CSV with a header row naming the columns.
+type csvRows struct {
+	r       *csv.Reader
+	columns []string
+}
+
+// CSVRows constructs a RowReader for CSV input. The first record must name
+// the columns, which may come in any order. Tags are separated by commas or
+// semicolons within their column.
+func CSVRows(r io.Reader) (RowReader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, errors.New("missing header row")
+		}
+		return nil, errors.Wrap(err, "reading header row")
+	}
+
+	seen := make(map[string]bool, len(header))
+	for i, col := range header {
+		if i == 0 {
+			col = strings.TrimPrefix(col, "\ufeff")
+		}
+		col = strings.ToLower(strings.TrimSpace(col))
+		if _, ok := csvFields[col]; !ok {
+			return nil, errors.Errorf("unknown column %q", header[i])
+		}
+		if seen[col] {
+			return nil, errors.Errorf("duplicate column %q", header[i])
+		}
+		seen[col] = true
+		header[i] = col
+	}
+
+	return &csvRows{r: cr, columns: header}, nil
+}
+
+// Next implements the RowReader interface.
+func (c *csvRows) Next() (NewStudio, error) {
+	rec, err := c.r.Read()
+	if err != nil {
+		if err == io.EOF {
+			return NewStudio{}, io.EOF
+		}
+		if pe, ok := err.(*csv.ParseError); ok {
+			return NewStudio{}, errors.Wrap(ErrMalformedRow, pe.Error())
+		}
+		return NewStudio{}, errors.Wrap(err, "reading row")
+	}
+	if len(rec) != len(c.columns) {
+		return NewStudio{}, errors.Wrapf(ErrMalformedRow, "row has %d fields, header has %d", len(rec), len(c.columns))
+	}
+
+	var ns NewStudio
+	for i, col := range c.columns {
+		csvFields[col](&ns, strings.TrimSpace(rec[i]))
+	}
+
+	// Blank address line columns leave no gaps.
+	var lines []string
+	for _, line := range ns.Address.Lines {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	ns.Address.Lines = lines
+
+	return ns, nil
+}
+
+// setLine puts v at position i of the address lines, growing them as needed.
+func setLine(lines []string, i int, v string) []string {
+	for len(lines) <= i {
+		lines = append(lines, "")
+	}
+	lines[i] = v
+	return lines
+}
+
+// ndjsonRows reads studios from newline delimited JSON.
+type ndjsonRows struct {
+	s *bufio.Scanner
+}
+
+// NDJSONRows constructs a RowReader for newline delimited JSON input with one
+// studio object per line. Blank lines are skipped.
+func NDJSONRows(r io.Reader) RowReader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	return &ndjsonRows{s: s}
+}
+
+// Next implements the RowReader interface.
+func (n *ndjsonRows) Next() (NewStudio, error) {
+	for n.s.Scan() {
+		line := bytes.TrimSpace(n.s.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.DisallowUnknownFields()
+
+		var ns NewStudio
+		if err := dec.Decode(&ns); err != nil {
+			return NewStudio{}, errors.Wrap(ErrMalformedRow, err.Error())
+		}
+		return ns, nil
+	}
+
+	if err := n.s.Err(); err != nil {
+		return NewStudio{}, errors.Wrap(err, "reading row")
+	}
+	return NewStudio{}, io.EOF
+}
@@ -0,0 +1,107 @@
+package studio
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/nextwavedevs/drop/business/data/audit"
+	"github.com/nextwavedevs/drop/business/validate"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// legacyAddress is the address of a studio saved before Address existed.
+type legacyAddress struct {
+	ID      string `bson:"_id" json:"-"`
+	City    string `json:"city"`
+	State   string `json:"state"`
+	Country string `json:"country"`
+}
+
+// MigrateAddresses moves the city, state and country of studios saved before
+// structured addresses onto an Address. Country names are turned into their
+// codes and region names into theirs where they are known. Studios whose
+// country or region can't be matched are migrated as they are and reported
+// so they can be fixed by hand. Running it again only touches studios that
+// still need it.
+func (u Studio) MigrateAddresses(ctx context.Context, traceID string, now time.Time) (AddressMigration, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.studio.migrateaddresses")
+	defer span.End()
+
+	filter := bson.M{"address": bson.M{"$exists": false}}
+	cur, err := studioCollection.Find(ctx, filter)
+	if err != nil {
+		return AddressMigration{}, errors.Wrap(err, "selecting studios")
+	}
+	defer cur.Close(ctx)
+
+	report := AddressMigration{Unresolved: []string{}}
+	for cur.Next(ctx) {
+		var old legacyAddress
+		if err := cur.Decode(&old); err != nil {
+			return report, errors.Wrap(err, "decoding studio")
+		}
+
+		addr, resolved := migrateAddress(old)
+
+		update := bson.M{
+			"$set":   bson.M{"address": addr},
+			"$unset": bson.M{"city": "", "state": "", "country": ""},
+			"$inc":   bson.M{"version": 1},
+		}
+		res, err := studioCollection.UpdateOne(ctx, bson.M{"_id": old.ID, "address": bson.M{"$exists": false}}, update)
+		if err != nil {
+			return report, errors.Wrapf(err, "migrating studio %q", old.ID)
+		}
+		if res.ModifiedCount == 0 {
+			continue
+		}
+
+		after := struct {
+			Address Address `json:"address"`
+		}{addr}
+		if err := u.audit.Record(ctx, traceID, entity, old.ID, audit.ActionUpdate, old, after, now); err != nil {
+			return report, err
+		}
+
+		report.Migrated++
+		if !resolved {
+			report.Unresolved = append(report.Unresolved, old.ID)
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return report, errors.Wrap(err, "reading studios")
+	}
+
+	u.log.Debug("studio.MigrateAddresses", "trace_id", traceID)
+	return report, nil
+}
+
+// migrateAddress builds the Address of a legacy studio and reports whether
+// its country and region were matched.
+func migrateAddress(old legacyAddress) (Address, bool) {
+	addr := Address{
+		Locality: strings.TrimSpace(old.City),
+		Region:   strings.TrimSpace(old.State),
+		Country:  strings.TrimSpace(old.Country),
+	}
+
+	code, ok := validate.CountryCode(old.Country)
+	if !ok {
+		return addr, false
+	}
+	addr.Country = code
+
+	if addr.Region == "" || !validate.KnownRegions(code) {
+		return addr, true
+	}
+	region, ok := validate.RegionCode(code, addr.Region)
+	if !ok {
+		return addr, false
+	}
+	addr.Region = region
+	return addr, true
+}
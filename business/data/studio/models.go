@@ -1,18 +1,34 @@
 package studio
 
-import "time"
+import (
+	"time"
+
+	"github.com/nextwavedevs/drop/business/validate"
+	"github.com/nextwavedevs/drop/foundation/geocode"
+)
 
 type Info struct {
-	ID           string    `bson:"_id"`
-	Name         string    `json:"name" validate:"required"`
-	Email        string    `json:"email" validate:"email,required"`
-	SocialHandle string    `json:"socials"`
-	Description  string    `json:"description"`
-	Created_at   time.Time `json:"created_at"`
-	City         string    `json:"city" validate:"required"`
-	State        string    `json:"state" validate:"required"`
-	Country      string    `json:"country" validate:"required"`
-	Updated_at   time.Time `json:"updated_at"`
+	ID           string          `bson:"_id"`
+	ExternalID   string          `json:"external_id,omitempty"`
+	Name         string          `json:"name" validate:"required"`
+	Email        string          `json:"email" validate:"email,required"`
+	SocialHandle string          `json:"socials"`
+	Description  string          `json:"description"`
+	Logo         string          `json:"logo"`
+	BrandID      string          `json:"brand_id,omitempty"`
+	Inherited    []string        `bson:"-" json:"inherited,omitempty"`
+	BrandUpdated time.Time       `bson:"-" json:"-"`
+	Created_at   time.Time       `json:"created_at"`
+	Address      Address         `json:"address"`
+	Geo          *geocode.Result `json:"geo,omitempty"`
+	Tags         []string        `json:"tags"`
+	Favorites    int             `json:"favorites"`
+	Owners       []string        `json:"owners"`
+	Version      int             `json:"version"`
+	Updated_at   time.Time       `json:"updated_at"`
+	Deleted_at   *time.Time      `json:"deleted_at,omitempty"`
+	Deleted_by   string          `json:"deleted_by,omitempty"`
+	Merged_into  string          `json:"merged_into,omitempty"`
 }
 
 // NewUser contains information needed to create a new User.
@@ -20,21 +36,108 @@ type NewStudio struct {
 	Name         string    `json:"name" validate:"required"`
 	Email        string    `json:"email" validate:"required,email"`
 	SocialHandle string    `json:"socials"`
-	City         string    `json:"city" validate:"required"`
 	Description  string    `json:"description"`
-	State        string    `json:"state" validate:"required"`
-	Country      string    `json:"country" validate:"required"`
+	Logo         string    `json:"logo" validate:"omitempty,url"`
+	Address      Address   `json:"address"`
+	Tags         []string  `json:"tags"`
+	ExternalID   string    `json:"external_id" validate:"omitempty,max=128"`
 	Created_at   time.Time `json:"created_at"`
 }
 
 // UpdateUser defines what information may be provided to modify an existing
 // User.
 type UpdateStudio struct {
-	Name         *string `json:"name"`
-	Email        *string `json:"email" validate:"omitempty,email"`
-	SocialHandle *string `json:"socials"`
-	Description  *string `json:"description"`
-	City         *string `json:"city" validate:"required"`
-	State        *string `json:"state" validate:"required"`
-	Country      *string `json:"country" validate:"required"`
+	Name         *string  `json:"name"`
+	Email        *string  `json:"email" validate:"omitempty,email"`
+	SocialHandle *string  `json:"socials"`
+	Description  *string  `json:"description"`
+	Logo         *string  `json:"logo" validate:"omitempty,clearable_url"`
+	Address      *Address `json:"address"`
+	Tags         []string `json:"tags"`
+	ExternalID   *string  `json:"external_id" validate:"omitempty,max=128"`
+}
+
+// Address is the postal address of a studio. Country is an ISO 3166-1
+// alpha-2 code such as "GB" and decides which regions and postal codes are
+// accepted.
+type Address struct {
+	Lines      []string `json:"lines" validate:"max=3,dive,required,max=100"`
+	Locality   string   `json:"locality" validate:"required,max=100"`
+	Region     string   `json:"region" validate:"omitempty,region=Country"`
+	PostalCode string   `json:"postal_code" validate:"omitempty,postcode=Country"`
+	Country    string   `json:"country" validate:"required,iso3166"`
+}
+
+// QueryFilter holds the optional criteria a studio listing can be narrowed by.
+// With MatchAll set a studio must carry every tag, otherwise any one will do.
+// Deleted studios are left out unless IncludeDeleted is set.
+type QueryFilter struct {
+	Tags           []string
+	MatchAll       bool
+	Locality       string
+	IncludeDeleted bool
+}
+
+// ExportFields lists the fields of a studio that can be exported, in their
+// default order.
+var ExportFields = []string{
+	"ID", "external_id", "name", "email", "socials", "description",
+	"logo", "brand_id", "address", "tags", "favorites", "owners", "version",
+	"created_at", "updated_at", "deleted_at", "deleted_by", "merged_into",
+}
+
+// Duplicate is a pair of live studios that look like the same place. Score
+// runs from zero to one and Reasons names the fields that matched.
+type Duplicate struct {
+	A       Info     `json:"a"`
+	B       Info     `json:"b"`
+	Score   float64  `json:"score"`
+	Reasons []string `json:"reasons"`
+}
+
+// MergeStudios names the studio to keep and the duplicate to fold into it.
+type MergeStudios struct {
+	KeepID  string `json:"keep_id" validate:"required"`
+	MergeID string `json:"merge_id" validate:"required,nefield=KeepID"`
+}
+
+// AddressMigration reports the outcome of moving studios onto structured
+// addresses. Unresolved lists the studios whose country or region could not
+// be matched and need fixing by hand.
+type AddressMigration struct {
+	Migrated   int      `json:"migrated"`
+	Unresolved []string `json:"unresolved"`
+}
+
+// TagCount represents the number of studios carrying a given tag slug.
+type TagCount struct {
+	Slug  string `bson:"_id" json:"slug"`
+	Count int    `json:"count"`
+}
+
+// Set of outcomes of an imported row.
+const (
+	RowCreated   = "created"
+	RowUpdated   = "updated"
+	RowUnchanged = "unchanged"
+	RowFailed    = "failed"
+)
+
+// ImportRow reports what happened to a single row of an import. Rows are
+// numbered from one in the order they were read.
+type ImportRow struct {
+	Row    int                  `json:"row"`
+	Status string               `json:"status"`
+	ID     string               `json:"id,omitempty"`
+	Error  string               `json:"error,omitempty"`
+	Fields validate.FieldErrors `json:"fields,omitempty"`
+}
+
+// ImportReport summarises an import along with the outcome of every row.
+type ImportReport struct {
+	Created   int         `json:"created"`
+	Updated   int         `json:"updated"`
+	Unchanged int         `json:"unchanged"`
+	Failed    int         `json:"failed"`
+	Rows      []ImportRow `json:"rows"`
 }
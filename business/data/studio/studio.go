@@ -1,14 +1,21 @@
 package studio
 
 import (
+	"bytes"
 	"context"
-	"fmt"
-	"log"
+	"encoding/json"
+	"reflect"
 	"time"
 
 	"github.com/nextwavedevs/drop/business/auth"
+	"github.com/nextwavedevs/drop/business/data/audit"
+	"github.com/nextwavedevs/drop/business/data/brand"
+	"github.com/nextwavedevs/drop/business/data/tag"
 	"github.com/nextwavedevs/drop/business/validate"
 	"github.com/nextwavedevs/drop/foundation/database"
+	"github.com/nextwavedevs/drop/foundation/geocode"
+	"github.com/nextwavedevs/drop/foundation/logger"
+	"github.com/nextwavedevs/drop/foundation/patch"
 	"github.com/pkg/errors"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -25,24 +32,52 @@ var (
 
 	// ErrForbidden occurs when a user tries to do something that is forbidden to them according to our access control policies.
 	ErrForbidden = errors.New("attempted action is not allowed")
+
+	// ErrVersionMismatch occurs when a write is made against a version of a
+	// studio that is no longer current.
+	ErrVersionMismatch = errors.New("version does not match")
 )
 
-// Studio manages the set of API's for user access.
+// entity names studios in the audit trail.
+const entity = "studio"
+
+// Studio manages the set of API's for studio access.
 type Studio struct {
-	log *log.Logger
-	db  *mongo.Client
+	log      *logger.Logger
+	db       *mongo.Client
+	tag      tag.Tag
+	audit    audit.Audit
+	brand    brand.Brand
+	geocoder geocode.Geocoder
 }
 
 // New constructs a User for api access.
-func New(log *log.Logger, db *mongo.Client) Studio {
-	return Studio{
-		log: log,
-		db:  db,
+func New(log *logger.Logger, db *mongo.Client, options ...func(u *Studio)) Studio {
+	u := Studio{
+		log:   log,
+		db:    db,
+		tag:   tag.New(log, db),
+		audit: audit.New(log, db),
+		brand: brand.New(log, db),
+	}
+	for _, option := range options {
+		option(&u)
 	}
+	return u
 }
 
-var studioCollection *mongo.Collection = database.OpenCollection(database.Client, "studio") // get collection "users" from db() which returns *mongo.Client
+// WithGeocoder locates studios from their city, state and country when they
+// are created or their address changes. Without one studios have no
+// coordinates.
+func WithGeocoder(g geocode.Geocoder) func(u *Studio) {
+	return func(u *Studio) {
+		u.geocoder = g
+	}
+}
 
+var studioCollection *mongo.Collection = database.OpenCollection(database.Client, "studio")
+
+// Create inserts a new studio into the database.
 func (u Studio) Create(ctx context.Context, traceID string, ns NewStudio, now time.Time) (Info, error) {
 
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.studio.create")
@@ -52,74 +87,201 @@ func (u Studio) Create(ctx context.Context, traceID string, ns NewStudio, now ti
 		return Info{}, errors.Wrap(err, "validating data")
 	}
 
+	tags := tag.NormalizeSlugs(ns.Tags)
+	if err := u.tag.CheckSlugs(ctx, traceID, tags); err != nil {
+		return Info{}, errors.Wrap(err, "checking tags")
+	}
+
 	std := Info{
 		ID:           validate.GenerateID(),
 		Name:         ns.Name,
 		Email:        ns.Email,
 		SocialHandle: ns.SocialHandle,
-		City:         ns.City,
 		Description:  ns.Description,
-		State:        ns.State,
-		Country:      ns.Country,
+		Logo:         ns.Logo,
+		Address:      ns.Address,
+		Tags:         tags,
+		ExternalID:   ns.ExternalID,
+		Version:      1,
 		Created_at:   now.UTC(),
 	}
-
-	insertResult, err := studioCollection.InsertOne(ctx, std)
+	geo, err := u.locate(ctx, traceID, std.Address)
 	if err != nil {
-		log.Fatal(err)
+		u.log.Warn("studio.Create", "trace_id", traceID, "error", err)
 	}
+	std.Geo = geo
 
-	fmt.Println("Inserted a single document: ", insertResult)
+	if _, err := studioCollection.InsertOne(ctx, std); err != nil {
+		return Info{}, errors.Wrap(err, "inserting studio")
+	}
+
+	if err := u.audit.Record(ctx, traceID, entity, std.ID, audit.ActionCreate, nil, std, now); err != nil {
+		return Info{}, err
+	}
+
+	u.log.Debug("studio.Create", "trace_id", traceID)
 	return std, nil
 }
 
-// Update replaces a user document in the database.
-func (u Studio) Update(ctx context.Context, traceID string, studioID string, us UpdateStudio, now time.Time) error {
+// Update replaces a studio document in the database. Only the fields that
+// are provided are written. The claims must belong to an admin, an owner of
+// the studio or an admin of its brand. The write only succeeds against the
+// given version of the studio and returns the result.
+func (u Studio) Update(ctx context.Context, traceID string, claims auth.Claims, studioID string, us UpdateStudio, version int, now time.Time) (Info, error) {
 
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.studio.update")
 	defer span.End()
 
 	if err := validate.CheckID(studioID); err != nil {
-		return ErrInvalidID
+		return Info{}, ErrInvalidID
 	}
 	if err := validate.Check(us); err != nil {
-		return errors.Wrap(err, "validating data")
+		return Info{}, errors.Wrap(err, "validating data")
+	}
+
+	std, err := u.QueryByID(ctx, traceID, studioID, false)
+	if err != nil {
+		return Info{}, errors.Wrap(err, "updating studio")
+	}
+	if err := u.checkOwner(ctx, traceID, claims, std); err != nil {
+		return Info{}, err
+	}
+	if std.Version != version {
+		return Info{}, ErrVersionMismatch
 	}
 
-	std, err := u.QueryByID(ctx, traceID, studioID)
+	std, err = u.update(ctx, traceID, std, us, now)
 	if err != nil {
-		return errors.Wrap(err, "updating user")
+		return Info{}, err
 	}
 
-	filter := bson.D{{Key: "name", Value: us.Name}} // converting value to BSON type
-	after := options.After                // for returning updated document
-	returnOpt := options.FindOneAndUpdateOptions{
+	u.log.Debug("studio.Update", "trace_id", traceID)
+	return std, nil
+}
+
+// Patch applies a partial update to a studio. The editable fields of the
+// studio are rendered as an UpdateStudio document which apply rewrites, the
+// result is validated and only the fields that changed are written. The
+// write only succeeds against the given version of the studio and is limited
+// to the same callers as Update.
+func (u Studio) Patch(ctx context.Context, traceID string, claims auth.Claims, studioID string, apply func(doc []byte) ([]byte, error), version int, now time.Time) (Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.studio.patch")
+	defer span.End()
+
+	if err := validate.CheckID(studioID); err != nil {
+		return Info{}, ErrInvalidID
+	}
 
-		ReturnDocument: &after,
+	std, err := u.QueryByID(ctx, traceID, studioID, false)
+	if err != nil {
+		return Info{}, errors.Wrap(err, "patching studio")
+	}
+	if err := u.checkOwner(ctx, traceID, claims, std); err != nil {
+		return Info{}, err
+	}
+	if std.Version != version {
+		return Info{}, ErrVersionMismatch
 	}
-	update := bson.M{
-			"$set": bson.M{
-			"name": us.Name,
-			"email": us.Email,
-			"socials": us.SocialHandle,
-			"description": us.Description,
-			"city": us.City,
-			"state": us.State,
-			"country": us.Country,
-			},
-		}
-	updateResult := studioCollection.FindOneAndUpdate(ctx, filter, update, &returnOpt)
+
+	cur := editable(std)
+	doc, err := json.Marshal(cur)
+	if err != nil {
+		return Info{}, errors.Wrap(err, "encoding studio")
+	}
+	doc, err = apply(doc)
+	if err != nil {
+		return Info{}, errors.Wrap(err, "applying patch")
+	}
+
+	var us UpdateStudio
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&us); err != nil {
+		return Info{}, errors.Wrapf(patch.ErrInvalid, "decoding patched studio: %v", err)
+	}
+	if err := validate.Check(us); err != nil {
+		return Info{}, errors.Wrap(err, "validating data")
+	}
+
+	std, err = u.update(ctx, traceID, std, changes(cur, us), now)
+	if err != nil {
+		return Info{}, err
+	}
+
+	u.log.Debug("studio.Patch", "trace_id", traceID)
+	return std, nil
+}
+
+// update writes the provided fields of us to the studio, conditional on the
+// studio still being at the version it was read at. Nothing is written when
+// no fields are provided.
+func (u Studio) update(ctx context.Context, traceID string, std Info, us UpdateStudio, now time.Time) (Info, error) {
+	set := bson.M{}
+	for key, value := range map[string]*string{
+		"name":         us.Name,
+		"email":        us.Email,
+		"socialhandle": us.SocialHandle,
+		"description":  us.Description,
+		"logo":         us.Logo,
+		"externalid":   us.ExternalID,
+	} {
+		if value != nil {
+			set[key] = *value
+		}
+	}
+	if us.Address != nil {
+		set["address"] = *us.Address
+	}
+	if us.Tags != nil {
+		tags := tag.NormalizeSlugs(us.Tags)
+		if err := u.tag.CheckSlugs(ctx, traceID, tags); err != nil {
+			return Info{}, errors.Wrap(err, "checking tags")
+		}
+		set["tags"] = tags
+	}
+	if len(set) == 0 {
+		return std, nil
+	}
+	set["updated_at"] = now.UTC()
+
+	update := bson.M{"$set": set, "$inc": bson.M{"version": 1}}
+
+	// Locate the studio again when its address changes. The coordinates
+	// already held are kept while the geocoder is failing.
+	if us.Address != nil {
+		geo, err := u.locate(ctx, traceID, *us.Address)
+		switch {
+		case err != nil:
+			u.log.Warn("studio.Update", "trace_id", traceID, "error", err)
+		case geo != nil:
+			set["geo"] = geo
+		default:
+			update["$unset"] = bson.M{"geo": ""}
+		}
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
 
 	var result Info
-	_ = updateResult.Decode(&result)
+	if err := studioCollection.FindOneAndUpdate(ctx, versionFilter(std.ID, std.Version), update, opts).Decode(&result); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return Info{}, ErrVersionMismatch
+		}
+		return Info{}, errors.Wrapf(err, "updating studio %q", std.ID)
+	}
 
-	u.log.Printf("%s: %s", traceID, "studio.Update")
-	fmt.Println("updated studio with id: ",std.ID)
-	return nil
+	if err := u.audit.Record(ctx, traceID, entity, std.ID, audit.ActionUpdate, std, result, now); err != nil {
+		return Info{}, err
+	}
+
+	return result, nil
 }
 
-// Delete removes a user from the database.
-func (u Studio) Delete(ctx context.Context, traceID string, claims auth.Claims, studioID string) error {
+// Delete archives a studio. The document is kept with its deletion time and
+// the id of the user who removed it until it is restored or purged. The
+// write only succeeds against the given version of the studio.
+func (u Studio) Delete(ctx context.Context, traceID string, claims auth.Claims, studioID string, version int, now time.Time) error {
 
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.studio.delete")
 	defer span.End()
@@ -133,19 +295,115 @@ func (u Studio) Delete(ctx context.Context, traceID string, claims auth.Claims,
 		return ErrForbidden
 	}
 
-	opts := options.Delete().SetCollation(&options.Collation{}) // to specify language-specific rules for string comparison, such as rules for lettercase
-	res, err := studioCollection.DeleteOne(ctx, bson.D{{Key:"_id", Value: studioID}}, opts)
-	if err != nil {
-		log.Fatal(err)
+	update := bson.M{
+		"$set": bson.M{"deleted_at": now.UTC(), "deleted_by": claims.Subject},
+		"$inc": bson.M{"version": 1},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+
+	var before Info
+	if err := studioCollection.FindOneAndUpdate(ctx, versionFilter(studioID, version), update, opts).Decode(&before); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return missing(ctx, studioID)
+		}
+		return errors.Wrapf(err, "deleting studio %q", studioID)
 	}
-	fmt.Printf("deleted %v documents\n", res.DeletedCount)
-	u.log.Printf("%s: %s", traceID, "studio.Delete")
+
+	std := before
+	deleted := now.UTC()
+	std.Deleted_at, std.Deleted_by = &deleted, claims.Subject
+	std.Version++
+	if err := u.audit.Record(ctx, traceID, entity, studioID, audit.ActionDelete, before, std, now); err != nil {
+		return err
+	}
+
+	u.log.Debug("studio.Delete", "trace_id", traceID)
 
 	return nil
 }
 
-// Query retrieves a list of existing users from the database.
-func (u Studio) Query(ctx context.Context, traceID string, pageNumber int, rowsPerPage int) ([]*Info, error) {
+// Restore brings back a studio archived by Delete. Studios merged into
+// another can't be restored.
+func (u Studio) Restore(ctx context.Context, traceID string, studioID string, now time.Time) (Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.studio.restore")
+	defer span.End()
+
+	if err := validate.CheckID(studioID); err != nil {
+		return Info{}, ErrInvalidID
+	}
+
+	filter := bson.M{"_id": studioID, "deleted_at": bson.M{"$ne": nil}, "merged_into": bson.M{"$in": bson.A{"", nil}}}
+	update := bson.M{
+		"$set":   bson.M{"updated_at": now.UTC()},
+		"$unset": bson.M{"deleted_at": "", "deleted_by": ""},
+		"$inc":   bson.M{"version": 1},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+
+	var before Info
+	if err := studioCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&before); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, errors.Wrapf(err, "restoring studio %q", studioID)
+	}
+
+	std := before
+	std.Updated_at = now.UTC()
+	std.Deleted_at, std.Deleted_by = nil, ""
+	std.Version++
+	if err := u.audit.Record(ctx, traceID, entity, studioID, audit.ActionRestore, before, std, now); err != nil {
+		return Info{}, err
+	}
+
+	u.log.Debug("studio.Restore", "trace_id", traceID)
+
+	return std, nil
+}
+
+// Purge permanently removes the studios that were deleted before the given
+// time and reports how many were removed. Merged studios are kept so their
+// ids keep redirecting.
+func (u Studio) Purge(ctx context.Context, traceID string, before time.Time, now time.Time) (int64, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.studio.purge")
+	defer span.End()
+
+	filter := bson.M{"deleted_at": bson.M{"$lt": before.UTC()}, "merged_into": bson.M{"$in": bson.A{"", nil}}}
+	cur, err := studioCollection.Find(ctx, filter)
+	if err != nil {
+		return 0, errors.Wrap(err, "selecting deleted studios")
+	}
+
+	var purged []Info
+	if err := cur.All(ctx, &purged); err != nil {
+		return 0, errors.Wrap(err, "decoding deleted studios")
+	}
+
+	var count int64
+	for _, std := range purged {
+		res, err := studioCollection.DeleteOne(ctx, bson.M{"_id": std.ID, "deleted_at": std.Deleted_at})
+		if err != nil {
+			return count, errors.Wrapf(err, "purging studio %q", std.ID)
+		}
+		if res.DeletedCount == 0 {
+			continue
+		}
+		count++
+
+		if err := u.audit.Record(ctx, traceID, entity, std.ID, audit.ActionPurge, std, nil, now); err != nil {
+			return count, err
+		}
+	}
+
+	u.log.Debug("studio.Purge", "trace_id", traceID)
+
+	return count, nil
+}
+
+// Query retrieves a page of existing studios from the database.
+func (u Studio) Query(ctx context.Context, traceID string, pageNumber int, rowsPerPage int, qf QueryFilter) ([]*Info, error) {
 
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.studio.query")
 	defer span.End()
@@ -161,33 +419,36 @@ func (u Studio) Query(ctx context.Context, traceID string, pageNumber int, rowsP
 	// Pass these options to the Find method
 	findOptionsOffset := options.Find()
 	findOptionPage := options.Find()
-	findOptionsOffset.SetLimit(int64(data.Offset))
+	findOptionsOffset.SetSkip(int64(data.Offset))
 	findOptionPage.SetLimit(int64(data.RowsPerPage))
 
 	var results []*Info                                   //slice for multiple documents
-	cur, err := studioCollection.Find(ctx, bson.D{{}},findOptionsOffset,findOptionPage) //returns a *mongo.Cursor
+	cur, err := studioCollection.Find(ctx, qf.document(),findOptionsOffset,findOptionPage) //returns a *mongo.Cursor
 	if err != nil {
-		fmt.Println(err)
+		return nil, errors.Wrap(err, "selecting studios")
 	}
+	defer cur.Close(ctx)
 	for cur.Next(ctx) { //Next() gets the next document for corresponding cursor
 
 		var elem Info
 		err := cur.Decode(&elem)
 		if err != nil {
-			log.Fatal(err)
+			return nil, errors.Wrap(err, "decoding studio")
 		}
 
 		results = append(results, &elem) // appending document pointed by Next()
 	}
-	cur.Close(ctx) // close the cursor once stream of documents has exhausted
-	fmt.Printf("Found multiple documents (array of pointers): %+v\n", results)
-	u.log.Printf("%s: %s", traceID, "studio.Query")
+	if err := cur.Err(); err != nil {
+		return nil, errors.Wrap(err, "reading studios")
+	}
+	u.log.Debug("studio.Query", "trace_id", traceID)
 
 	return results, nil
 }
 
-// QueryByID gets the specified user from the database.
-func (u Studio) QueryByID(ctx context.Context, traceID string, studioID string) (Info, error) {
+// QueryByID gets the specified studio from the database. A deleted studio is
+// reported as not found unless includeDeleted is set.
+func (u Studio) QueryByID(ctx context.Context, traceID string, studioID string, includeDeleted bool) (Info, error) {
 
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.studio.querybyid")
 	defer span.End()
@@ -196,20 +457,27 @@ func (u Studio) QueryByID(ctx context.Context, traceID string, studioID string)
 		return Info{}, ErrInvalidID
 	}
 
+	filter := bson.M{"_id": studioID}
+	if !includeDeleted {
+		filter["deleted_at"] = nil
+	}
+
 	var result Info //  an unordered representation of a BSON document which is a Map
-	err := studioCollection.FindOne(ctx, bson.D{{Key:"_id",Value: studioID}}).Decode(&result)
+	err := studioCollection.FindOne(ctx, filter).Decode(&result)
 	if err != nil {
-
-		fmt.Println(err)
-
+		if err == mongo.ErrNoDocuments {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, errors.Wrapf(err, "selecting studio %q", studioID)
 	}
-	u.log.Printf("%s: %s", traceID, "studio.QueryByID")
+	u.log.Debug("studio.QueryByID", "trace_id", traceID)
 
 	return result, nil
 }
 
-// Query retrieves a list of existing users from the database.
-func (u Studio) QueryByLocation(ctx context.Context, traceID string, pageNumber int, rowsPerPage int, city string) ([]*Info, error) {
+// QueryByLocation retrieves a page of the existing studios in a city from the
+// database.
+func (u Studio) QueryByLocation(ctx context.Context, traceID string, pageNumber int, rowsPerPage int, city string, qf QueryFilter) ([]*Info, error) {
 
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.studio.querybylocation")
 	defer span.End()
@@ -225,27 +493,435 @@ func (u Studio) QueryByLocation(ctx context.Context, traceID string, pageNumber
 	// Pass these options to the Find method
 	findOptionsOffset := options.Find()
 	findOptionPage := options.Find()
-	findOptionsOffset.SetLimit(int64(data.Offset))
+	findOptionsOffset.SetSkip(int64(data.Offset))
 	findOptionPage.SetLimit(int64(data.RowsPerPage))
 
+	filter := qf.document()
+	filter["address.locality"] = city
+
 	var results []*Info //slice for multiple documents
-	cur, err := studioCollection.Find(ctx, bson.D{{Key:"city",Value: city}},findOptionsOffset,findOptionPage) //returns a *mongo.Cursor
+	cur, err := studioCollection.Find(ctx, filter,findOptionsOffset,findOptionPage) //returns a *mongo.Cursor
 	if err != nil {
-		fmt.Println(err)
+		return nil, errors.Wrap(err, "selecting studios")
 	}
+	defer cur.Close(ctx)
 	for cur.Next(ctx) { //Next() gets the next document for corresponding cursor
 
 		var elem Info
 		err := cur.Decode(&elem)
 		if err != nil {
-			log.Fatal(err)
+			return nil, errors.Wrap(err, "decoding studio")
 		}
 
 		results = append(results, &elem) // appending document pointed by Next()
 	}
-	cur.Close(ctx) // close the cursor once stream of documents has exhausted
-	fmt.Printf("Found multiple documents (array of pointers): %+v\n", results)
-	u.log.Printf("%s: %s", traceID, "studio.QueryByLocation")
+	if err := cur.Err(); err != nil {
+		return nil, errors.Wrap(err, "reading studios")
+	}
+	u.log.Debug("studio.QueryByLocation", "trace_id", traceID)
 
 	return results, nil
-}
\ No newline at end of file
+}
+
+// SetTags replaces the set of taxonomy tags assigned to a studio. It is
+// limited to the same callers as Update.
+func (u Studio) SetTags(ctx context.Context, traceID string, claims auth.Claims, studioID string, tags []string, now time.Time) ([]string, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.studio.settags")
+	defer span.End()
+
+	if err := validate.CheckID(studioID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	if err := u.CheckOwner(ctx, traceID, claims, studioID); err != nil {
+		return nil, err
+	}
+
+	slugs := tag.NormalizeSlugs(tags)
+	if err := u.tag.CheckSlugs(ctx, traceID, slugs); err != nil {
+		return nil, errors.Wrap(err, "checking tags")
+	}
+
+	filter := bson.M{"_id": studioID, "deleted_at": nil}
+	update := bson.M{"$set": bson.M{"tags": slugs, "updated_at": now.UTC()}, "$inc": bson.M{"version": 1}}
+	if err := u.set(ctx, traceID, studioID, filter, update, now); err != nil {
+		return nil, errors.Wrap(err, "setting tags")
+	}
+
+	u.log.Debug("studio.SetTags", "trace_id", traceID)
+	return slugs, nil
+}
+
+// RemoveTag detaches a tag slug from every studio carrying it. It is used
+// when a tag is deleted from the taxonomy.
+func (u Studio) RemoveTag(ctx context.Context, traceID string, slug string, now time.Time) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.studio.removetag")
+	defer span.End()
+
+	update := bson.M{"$pull": bson.M{"tags": slug}, "$set": bson.M{"updated_at": now.UTC()}, "$inc": bson.M{"version": 1}}
+	if _, err := u.setMany(ctx, traceID, bson.M{"tags": slug}, update, now); err != nil {
+		return errors.Wrapf(err, "removing tag %q", slug)
+	}
+
+	u.log.Debug("studio.RemoveTag", "trace_id", traceID)
+	return nil
+}
+
+// CountTags returns how many live studios carry each tag slug, most used
+// first.
+func (u Studio) CountTags(ctx context.Context, traceID string) ([]TagCount, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.studio.counttags")
+	defer span.End()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"deleted_at": nil}}},
+		{{Key: "$unwind", Value: "$tags"}},
+		{{Key: "$group", Value: bson.M{"_id": "$tags", "count": bson.M{"$sum": 1}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+	}
+
+	cur, err := studioCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, errors.Wrap(err, "counting tags")
+	}
+
+	counts := []TagCount{}
+	if err := cur.All(ctx, &counts); err != nil {
+		return nil, errors.Wrap(err, "decoding tag counts")
+	}
+
+	u.log.Debug("studio.CountTags", "trace_id", traceID)
+	return counts, nil
+}
+
+// document converts the filter into a Mongo query document.
+func (qf QueryFilter) document() bson.M {
+	filter := bson.M{}
+	if !qf.IncludeDeleted {
+		filter["deleted_at"] = nil
+	}
+	if qf.Locality != "" {
+		filter["address.locality"] = qf.Locality
+	}
+	if len(qf.Tags) > 0 {
+		op := "$in"
+		if qf.MatchAll {
+			op = "$all"
+		}
+		filter["tags"] = bson.M{op: qf.Tags}
+	}
+	return filter
+}
+
+// Export streams every studio matching the filter to fn in id order without
+// holding them in memory. It stops at the first error returned by fn.
+func (u Studio) Export(ctx context.Context, traceID string, qf QueryFilter, fn func(std Info) error) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.studio.export")
+	defer span.End()
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	cur, err := studioCollection.Find(ctx, qf.document(), opts)
+	if err != nil {
+		return errors.Wrap(err, "selecting studios")
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var std Info
+		if err := cur.Decode(&std); err != nil {
+			return errors.Wrap(err, "decoding studio")
+		}
+		if err := fn(std); err != nil {
+			return err
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return errors.Wrap(err, "reading studios")
+	}
+
+	u.log.Debug("studio.Export", "trace_id", traceID)
+	return nil
+}
+
+// QueryByIDs retrieves the set of studios matching the provided ids keyed by
+// their id. Unknown and deleted ids are left out of the result.
+func (u Studio) QueryByIDs(ctx context.Context, traceID string, studioIDs []string) (map[string]Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.studio.querybyids")
+	defer span.End()
+
+	cur, err := studioCollection.Find(ctx, bson.M{"_id": bson.M{"$in": studioIDs}, "deleted_at": nil})
+	if err != nil {
+		return nil, errors.Wrap(err, "selecting studios")
+	}
+
+	var found []Info
+	if err := cur.All(ctx, &found); err != nil {
+		return nil, errors.Wrap(err, "decoding studios")
+	}
+
+	studios := make(map[string]Info, len(found))
+	for _, std := range found {
+		studios[std.ID] = std
+	}
+
+	u.log.Debug("studio.QueryByIDs", "trace_id", traceID)
+	return studios, nil
+}
+
+// AdjustFavorites atomically moves the favourite counter of a studio by
+// delta. The counter is not an edit of the studio, so updated_at is left
+// alone, but the version moves as on every write.
+func (u Studio) AdjustFavorites(ctx context.Context, traceID string, studioID string, delta int, now time.Time) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.studio.adjustfavorites")
+	defer span.End()
+
+	update := bson.M{"$inc": bson.M{"favorites": delta, "version": 1}}
+	if err := u.set(ctx, traceID, studioID, bson.M{"_id": studioID}, update, now); err != nil {
+		if err == ErrNotFound {
+			return ErrNotFound
+		}
+		return errors.Wrapf(err, "adjusting favorites for %q", studioID)
+	}
+
+	u.log.Debug("studio.AdjustFavorites", "trace_id", traceID)
+	return nil
+}
+
+// SetFavorites sets the favourite counter of a studio to a count taken from
+// the favourites themselves, such as after they were moved in bulk.
+func (u Studio) SetFavorites(ctx context.Context, traceID string, studioID string, count int, now time.Time) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.studio.setfavorites")
+	defer span.End()
+
+	update := bson.M{"$set": bson.M{"favorites": count}, "$inc": bson.M{"version": 1}}
+	if err := u.set(ctx, traceID, studioID, bson.M{"_id": studioID, "favorites": bson.M{"$ne": count}}, update, now); err != nil {
+		if err == ErrNotFound {
+			return nil
+		}
+		return errors.Wrapf(err, "setting favorites for %q", studioID)
+	}
+
+	u.log.Debug("studio.SetFavorites", "trace_id", traceID)
+	return nil
+}
+
+// SetOwners replaces the set of users allowed to manage a studio.
+func (u Studio) SetOwners(ctx context.Context, traceID string, studioID string, owners []string, now time.Time) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.studio.setowners")
+	defer span.End()
+
+	if err := validate.CheckID(studioID); err != nil {
+		return ErrInvalidID
+	}
+	for _, id := range owners {
+		if err := validate.CheckID(id); err != nil {
+			return ErrInvalidID
+		}
+	}
+	if owners == nil {
+		owners = []string{}
+	}
+
+	filter := bson.M{"_id": studioID, "deleted_at": nil}
+	update := bson.M{"$set": bson.M{"owners": owners, "updated_at": now.UTC()}, "$inc": bson.M{"version": 1}}
+	if err := u.set(ctx, traceID, studioID, filter, update, now); err != nil {
+		return errors.Wrap(err, "setting owners")
+	}
+
+	u.log.Debug("studio.SetOwners", "trace_id", traceID)
+	return nil
+}
+
+// set applies an update to a single studio and records it in the audit
+// trail.
+func (u Studio) set(ctx context.Context, traceID string, studioID string, filter bson.M, update bson.M, now time.Time) error {
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+
+	var before Info
+	if err := studioCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&before); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	var after Info
+	if err := studioCollection.FindOne(ctx, bson.M{"_id": studioID}).Decode(&after); err != nil {
+		return errors.Wrapf(err, "selecting studio %q", studioID)
+	}
+
+	return u.audit.Record(ctx, traceID, entity, studioID, audit.ActionUpdate, before, after, now)
+}
+
+// setMany applies an update to each studio matching the filter, recording
+// every one changed in the audit trail, and reports how many were changed.
+// The studios are selected first so each gets its own event; those that
+// stop matching in between are skipped.
+func (u Studio) setMany(ctx context.Context, traceID string, filter bson.M, update bson.M, now time.Time) (int64, error) {
+	cur, err := studioCollection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, errors.Wrap(err, "selecting studios")
+	}
+
+	var ids []struct {
+		ID string `bson:"_id"`
+	}
+	if err := cur.All(ctx, &ids); err != nil {
+		return 0, errors.Wrap(err, "decoding studios")
+	}
+
+	var n int64
+	for _, id := range ids {
+		f := bson.M{"_id": id.ID}
+		for k, v := range filter {
+			f[k] = v
+		}
+		if err := u.set(ctx, traceID, id.ID, f, update, now); err != nil {
+			if err == ErrNotFound {
+				continue
+			}
+			return n, errors.Wrapf(err, "updating studio %q", id.ID)
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+// locate looks up the coordinates of an address. Nothing is returned when
+// no geocoder is configured or the address can't be placed. An error means
+// the geocoder failed and says nothing about the address; callers log it
+// rather than failing the write.
+func (u Studio) locate(ctx context.Context, traceID string, addr Address) (*geocode.Result, error) {
+	if u.geocoder == nil {
+		return nil, nil
+	}
+
+	q := geocode.Query{City: addr.Locality, State: addr.Region, Country: addr.Country}
+	res, err := u.geocoder.Geocode(ctx, q)
+	if err != nil {
+		if errors.Cause(err) == geocode.ErrNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "locating address")
+	}
+
+	return &res, nil
+}
+
+// editable renders the fields of a studio that can be updated.
+func editable(std Info) UpdateStudio {
+	return UpdateStudio{
+		Name:         &std.Name,
+		Email:        &std.Email,
+		SocialHandle: &std.SocialHandle,
+		Description:  &std.Description,
+		Logo:         &std.Logo,
+		Address:      &std.Address,
+		Tags:         std.Tags,
+		ExternalID:   &std.ExternalID,
+	}
+}
+
+// changes drops the fields of us that hold the same value as cur.
+func changes(cur UpdateStudio, us UpdateStudio) UpdateStudio {
+	for _, f := range []struct{ cur, patched **string }{
+		{&cur.Name, &us.Name},
+		{&cur.Email, &us.Email},
+		{&cur.SocialHandle, &us.SocialHandle},
+		{&cur.Description, &us.Description},
+		{&cur.Logo, &us.Logo},
+		{&cur.ExternalID, &us.ExternalID},
+	} {
+		if *f.patched != nil && *f.cur != nil && **f.patched == **f.cur {
+			*f.patched = nil
+		}
+	}
+	if us.Address != nil && cur.Address != nil && sameAddress(*us.Address, *cur.Address) {
+		us.Address = nil
+	}
+	if us.Tags != nil && reflect.DeepEqual(tag.NormalizeSlugs(us.Tags), tag.NormalizeSlugs(cur.Tags)) {
+		us.Tags = nil
+	}
+	return us
+}
+
+// sameAddress reports whether two addresses hold the same values, treating
+// missing and empty lines alike.
+func sameAddress(a Address, b Address) bool {
+	if len(a.Lines) == 0 && len(b.Lines) == 0 {
+		a.Lines, b.Lines = nil, nil
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// versionFilter matches the live studio with the given id at the given
+// version. Studios written before versioning was introduced have no version
+// and are treated as version zero.
+func versionFilter(studioID string, version int) bson.M {
+	filter := bson.M{"_id": studioID, "deleted_at": nil, "version": version}
+	if version == 0 {
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	}
+	return filter
+}
+
+// missing works out why a versioned write matched nothing: either the studio
+// is gone or its version moved on.
+func missing(ctx context.Context, studioID string) error {
+	n, err := studioCollection.CountDocuments(ctx, bson.M{"_id": studioID, "deleted_at": nil})
+	if err != nil {
+		return errors.Wrapf(err, "selecting studio %q", studioID)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return ErrVersionMismatch
+}
+
+// CheckOwner verifies the claims belong to an admin, to one of the owners
+// of the specified studio or to an admin of its brand.
+func (u Studio) CheckOwner(ctx context.Context, traceID string, claims auth.Claims, studioID string) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.studio.checkowner")
+	defer span.End()
+
+	std, err := u.QueryByID(ctx, traceID, studioID, false)
+	if err != nil {
+		return err
+	}
+
+	return u.checkOwner(ctx, traceID, claims, std)
+}
+
+// checkOwner verifies the claims may manage a studio that has already been
+// read.
+func (u Studio) checkOwner(ctx context.Context, traceID string, claims auth.Claims, std Info) error {
+	if claims.Authorized(auth.RoleAdmin) {
+		return nil
+	}
+	for _, owner := range std.Owners {
+		if owner == claims.Subject {
+			return nil
+		}
+	}
+	if std.BrandID != "" {
+		switch err := u.brand.CheckAdmin(ctx, traceID, claims, std.BrandID); errors.Cause(err) {
+		case nil:
+			return nil
+		case brand.ErrForbidden, brand.ErrNotFound, brand.ErrInvalidID:
+		default:
+			return err
+		}
+	}
+
+	return ErrForbidden
+}
@@ -0,0 +1,40 @@
+package tag
+
+import "time"
+
+// Info represents a single entry in the studio taxonomy. Studios reference
+// tags by their slug.
+type Info struct {
+	ID          string    `bson:"_id"`
+	Name        string    `json:"name"`
+	Slug        string    `json:"slug"`
+	Category    string    `json:"category"`
+	Description string    `json:"description"`
+	Created_at  time.Time `json:"created_at"`
+	Updated_at  time.Time `json:"updated_at"`
+}
+
+// NewTag contains information needed to create a new Tag. When Slug is
+// empty it is derived from the Name.
+type NewTag struct {
+	Name        string `json:"name" validate:"required,max=64"`
+	Slug        string `json:"slug" validate:"omitempty,max=64"`
+	Category    string `json:"category" validate:"required,max=64"`
+	Description string `json:"description"`
+}
+
+// UpdateTag defines what information may be provided to modify an existing
+// Tag. The slug is immutable once created since studios reference it.
+type UpdateTag struct {
+	Name        *string `json:"name" validate:"omitempty,max=64"`
+	Category    *string `json:"category" validate:"omitempty,max=64"`
+	Description *string `json:"description"`
+}
+
+// Count represents the number of studios a tag has been assigned to.
+type Count struct {
+	Slug     string `json:"slug"`
+	Name     string `json:"name"`
+	Category string `json:"category"`
+	Count    int    `json:"count"`
+}
@@ -0,0 +1,276 @@
+// Package tag manages the admin curated taxonomy of amenities, styles and
+// other labels that can be assigned to studios.
+package tag
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/nextwavedevs/drop/business/validate"
+	"github.com/nextwavedevs/drop/foundation/database"
+	"github.com/nextwavedevs/drop/foundation/logger"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// ErrNotFound is used when a specific Tag is requested but does not exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrInvalidID occurs when an ID is not in a valid form.
+	ErrInvalidID = errors.New("ID is not in its proper form")
+
+	// ErrSlugExists occurs when a tag is created with a slug already in use.
+	ErrSlugExists = errors.New("slug already in use")
+)
+
+// Tag manages the set of API's for tag access.
+type Tag struct {
+	log *logger.Logger
+	db  *mongo.Client
+}
+
+// New constructs a Tag for api access.
+func New(log *logger.Logger, db *mongo.Client) Tag {
+	return Tag{
+		log: log,
+		db:  db,
+	}
+}
+
+var tagCollection *mongo.Collection = database.OpenCollection(database.Client, "tag")
+
+// Create inserts a new tag into the database.
+func (t Tag) Create(ctx context.Context, traceID string, nt NewTag, now time.Time) (Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.tag.create")
+	defer span.End()
+
+	if err := validate.Check(nt); err != nil {
+		return Info{}, errors.Wrap(err, "validating data")
+	}
+
+	slug := Slugify(nt.Slug)
+	if slug == "" {
+		slug = Slugify(nt.Name)
+	}
+	if slug == "" {
+		return Info{}, validate.FieldErrors{{Field: "slug", Error: "slug must contain letters or digits"}}
+	}
+
+	n, err := tagCollection.CountDocuments(ctx, bson.D{{Key: "slug", Value: slug}})
+	if err != nil {
+		return Info{}, errors.Wrap(err, "checking slug")
+	}
+	if n > 0 {
+		return Info{}, ErrSlugExists
+	}
+
+	tg := Info{
+		ID:          validate.GenerateID(),
+		Name:        nt.Name,
+		Slug:        slug,
+		Category:    Slugify(nt.Category),
+		Description: nt.Description,
+		Created_at:  now.UTC(),
+		Updated_at:  now.UTC(),
+	}
+
+	if _, err := tagCollection.InsertOne(ctx, tg); err != nil {
+		return Info{}, errors.Wrap(err, "inserting tag")
+	}
+
+	t.log.Debug("tag.Create", "trace_id", traceID)
+	return tg, nil
+}
+
+// Update modifies the name, category or description of a tag.
+func (t Tag) Update(ctx context.Context, traceID string, tagID string, ut UpdateTag, now time.Time) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.tag.update")
+	defer span.End()
+
+	if err := validate.CheckID(tagID); err != nil {
+		return ErrInvalidID
+	}
+	if err := validate.Check(ut); err != nil {
+		return errors.Wrap(err, "validating data")
+	}
+
+	set := bson.M{"updated_at": now.UTC()}
+	if ut.Name != nil {
+		set["name"] = *ut.Name
+	}
+	if ut.Category != nil {
+		set["category"] = Slugify(*ut.Category)
+	}
+	if ut.Description != nil {
+		set["description"] = *ut.Description
+	}
+
+	res, err := tagCollection.UpdateOne(ctx, bson.D{{Key: "_id", Value: tagID}}, bson.M{"$set": set})
+	if err != nil {
+		return errors.Wrap(err, "updating tag")
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	t.log.Debug("tag.Update", "trace_id", traceID)
+	return nil
+}
+
+// Delete removes a tag from the taxonomy and returns the removed tag so the
+// caller can detach its slug from any studios.
+func (t Tag) Delete(ctx context.Context, traceID string, tagID string) (Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.tag.delete")
+	defer span.End()
+
+	if err := validate.CheckID(tagID); err != nil {
+		return Info{}, ErrInvalidID
+	}
+
+	var tg Info
+	if err := tagCollection.FindOneAndDelete(ctx, bson.D{{Key: "_id", Value: tagID}}).Decode(&tg); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, errors.Wrap(err, "deleting tag")
+	}
+
+	t.log.Debug("tag.Delete", "trace_id", traceID)
+	return tg, nil
+}
+
+// Query retrieves the taxonomy, optionally restricted to a single category.
+func (t Tag) Query(ctx context.Context, traceID string, category string) ([]Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.tag.query")
+	defer span.End()
+
+	filter := bson.D{}
+	if category != "" {
+		filter = bson.D{{Key: "category", Value: Slugify(category)}}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "category", Value: 1}, {Key: "name", Value: 1}})
+	cur, err := tagCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying tags")
+	}
+
+	tags := []Info{}
+	if err := cur.All(ctx, &tags); err != nil {
+		return nil, errors.Wrap(err, "decoding tags")
+	}
+
+	t.log.Debug("tag.Query", "trace_id", traceID)
+	return tags, nil
+}
+
+// QueryByID gets the specified tag from the database.
+func (t Tag) QueryByID(ctx context.Context, traceID string, tagID string) (Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.tag.querybyid")
+	defer span.End()
+
+	if err := validate.CheckID(tagID); err != nil {
+		return Info{}, ErrInvalidID
+	}
+
+	var tg Info
+	if err := tagCollection.FindOne(ctx, bson.D{{Key: "_id", Value: tagID}}).Decode(&tg); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, errors.Wrapf(err, "selecting tag %q", tagID)
+	}
+
+	t.log.Debug("tag.QueryByID", "trace_id", traceID)
+	return tg, nil
+}
+
+// CheckSlugs verifies every provided slug exists in the taxonomy. Unknown
+// slugs are reported as field errors against the tags field.
+func (t Tag) CheckSlugs(ctx context.Context, traceID string, slugs []string) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.tag.checkslugs")
+	defer span.End()
+
+	if len(slugs) == 0 {
+		return nil
+	}
+
+	cur, err := tagCollection.Find(ctx, bson.M{"slug": bson.M{"$in": slugs}})
+	if err != nil {
+		return errors.Wrap(err, "querying tags")
+	}
+	var found []Info
+	if err := cur.All(ctx, &found); err != nil {
+		return errors.Wrap(err, "decoding tags")
+	}
+
+	known := make(map[string]bool, len(found))
+	for _, tg := range found {
+		known[tg.Slug] = true
+	}
+
+	var unknown []string
+	for _, slug := range slugs {
+		if !known[slug] {
+			unknown = append(unknown, slug)
+		}
+	}
+	if len(unknown) > 0 {
+		return validate.FieldErrors{{
+			Field: "tags",
+			Error: fmt.Sprintf("unknown tags: %s", strings.Join(unknown, ", ")),
+		}}
+	}
+
+	t.log.Debug("tag.CheckSlugs", "trace_id", traceID)
+	return nil
+}
+
+// =============================================================================
+
+// Slugify converts a display name into the lowercase, dash separated form
+// used to reference tags in URLs and studio documents.
+func Slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(s)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+			dash = false
+		case b.Len() > 0 && !dash:
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// NormalizeSlugs slugifies a list of tags, dropping empties and duplicates
+// while preserving order.
+func NormalizeSlugs(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	slugs := make([]string, 0, len(tags))
+	for _, t := range tags {
+		slug := Slugify(t)
+		if slug == "" || seen[slug] {
+			continue
+		}
+		seen[slug] = true
+		slugs = append(slugs, slug)
+	}
+	return slugs
+}
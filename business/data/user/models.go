@@ -11,10 +11,12 @@ type Info struct {
 	Name         string         `json:"name" validate:"required,min=2,max=100"`
 	Email        string         `json:"email" validate:"email,required"`
 	Roles        pq.StringArray `json:"roles"`
-	Password     string         `json:"password"`
 	PasswordHash []byte         `json:"password_hash"`
+	Version      int            `json:"version"`
 	Created_at   time.Time      `json:"created_at"`
 	Updated_at   time.Time      `json:"updated_at"`
+	Deleted_at   *time.Time     `json:"deleted_at,omitempty"`
+	Deleted_by   string         `json:"deleted_by,omitempty"`
 }
 
 // NewUser contains information needed to create a new User.
@@ -35,3 +37,10 @@ type UpdateUser struct {
 	Password        *string  `json:"password"`
 	PasswordConfirm *string  `json:"password_confirm" validate:"omitempty,eqfield=Password"`
 }
+
+// ExportFields lists the fields of a user that can be exported, in their
+// default order. Passwords and their hashes are never exported.
+var ExportFields = []string{
+	"ID", "name", "email", "roles", "version",
+	"created_at", "updated_at", "deleted_at", "deleted_by",
+}
@@ -1,15 +1,19 @@
 package user
 
 import (
+	"bytes"
 	"context"
-	"fmt"
-	"log"
+	"encoding/json"
+	"reflect"
 	"time"
 
 	"github.com/dgrijalva/jwt-go/v4"
 	"github.com/nextwavedevs/drop/business/auth"
+	"github.com/nextwavedevs/drop/business/data/audit"
 	"github.com/nextwavedevs/drop/business/validate"
 	"github.com/nextwavedevs/drop/foundation/database"
+	"github.com/nextwavedevs/drop/foundation/logger"
+	"github.com/nextwavedevs/drop/foundation/patch"
 	"github.com/pkg/errors"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -31,19 +35,31 @@ var (
 
 	// ErrForbidden occurs when a user tries to do something that is forbidden to them according to our access control policies.
 	ErrForbidden = errors.New("attempted action is not allowed")
+
+	// ErrVersionMismatch occurs when a write is made against a version of a
+	// user that is no longer current.
+	ErrVersionMismatch = errors.New("version does not match")
 )
 
+// entity names users in the audit trail.
+const entity = "user"
+
+// secrets lists the fields whose values are kept out of the audit trail.
+var secrets = []string{"password", "password_hash"}
+
 // User manages the set of API's for user access.
 type User struct {
-	log *log.Logger
-	db  *mongo.Client
+	log   *logger.Logger
+	db    *mongo.Client
+	audit audit.Audit
 }
 
 // New constructs a User for api access.
-func New(log *log.Logger, db *mongo.Client) User {
+func New(log *logger.Logger, db *mongo.Client) User {
 	return User{
-		log: log,
-		db:  db,
+		log:   log,
+		db:    db,
+		audit: audit.New(log, db),
 	}
 }
 
@@ -69,77 +85,159 @@ func (u User) Create(ctx context.Context, traceID string, nu NewUser, now time.T
 		Name:         nu.Name,
 		Email:        nu.Email,
 		PasswordHash: hash,
-		Password:     nu.Password,
 		Roles:        nu.Roles,
+		Version:      1,
 		Created_at:   now.UTC(),
 		Updated_at:   now.UTC(),
 	}
 
-	insertResult, err := userCollection.InsertOne(ctx, usr)
-	if err != nil {
-		log.Fatal(err)
+	if _, err := userCollection.InsertOne(ctx, usr); err != nil {
+		return Info{}, errors.Wrap(err, "inserting user")
+	}
+
+	if err := u.audit.Record(ctx, traceID, entity, usr.ID, audit.ActionCreate, nil, usr, now, secrets...); err != nil {
+		return Info{}, err
 	}
 
-	fmt.Println("Inserted a single document: ", insertResult)
-	u.log.Printf("%s: %s", traceID, "user.Create")
+	u.log.Debug("user.Create", "trace_id", traceID)
 	return usr, nil
 }
 
-// Update replaces a user document in the database.
-func (u User) Update(ctx context.Context, traceID string, claims auth.Claims, userID string, uu UpdateUser, now time.Time) error {
+// Update replaces a user document in the database. Only the fields that
+// are provided are written. The write only succeeds against the given
+// version of the user and returns the result.
+func (u User) Update(ctx context.Context, traceID string, claims auth.Claims, userID string, uu UpdateUser, version int, now time.Time) (Info, error) {
 
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.update")
 	defer span.End()
 
 	if err := validate.CheckID(userID); err != nil {
-		return ErrInvalidID
+		return Info{}, ErrInvalidID
 	}
 	if err := validate.Check(uu); err != nil {
-		return errors.Wrap(err, "validating data")
+		return Info{}, errors.Wrap(err, "validating data")
+	}
+
+	usr, err := u.QueryByID(ctx, traceID, claims, userID, false)
+	if err != nil {
+		return Info{}, errors.Wrap(err, "updating user")
+	}
+	if usr.Version != version {
+		return Info{}, ErrVersionMismatch
+	}
+
+	usr, err = u.update(ctx, traceID, usr, uu, now)
+	if err != nil {
+		return Info{}, err
+	}
+
+	u.log.Debug("user.Update", "trace_id", traceID)
+
+	return usr, nil
+}
+
+// Patch applies a partial update to a user. The editable fields of the user
+// are rendered as an UpdateUser document which apply rewrites, the result is
+// validated and only the fields that changed are written. A password can be
+// set by adding password and password_confirm. The write only succeeds
+// against the given version of the user.
+func (u User) Patch(ctx context.Context, traceID string, claims auth.Claims, userID string, apply func(doc []byte) ([]byte, error), version int, now time.Time) (Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.patch")
+	defer span.End()
+
+	if err := validate.CheckID(userID); err != nil {
+		return Info{}, ErrInvalidID
+	}
+
+	usr, err := u.QueryByID(ctx, traceID, claims, userID, false)
+	if err != nil {
+		return Info{}, errors.Wrap(err, "patching user")
+	}
+	if usr.Version != version {
+		return Info{}, ErrVersionMismatch
+	}
+
+	cur := editable(usr)
+	doc, err := json.Marshal(cur)
+	if err != nil {
+		return Info{}, errors.Wrap(err, "encoding user")
+	}
+	doc, err = apply(doc)
+	if err != nil {
+		return Info{}, errors.Wrap(err, "applying patch")
+	}
+
+	var uu UpdateUser
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&uu); err != nil {
+		return Info{}, errors.Wrapf(patch.ErrInvalid, "decoding patched user: %v", err)
+	}
+	if err := validate.Check(uu); err != nil {
+		return Info{}, errors.Wrap(err, "validating data")
 	}
 
-	usr, err := u.QueryByID(ctx, traceID, claims, userID)
+	usr, err = u.update(ctx, traceID, usr, changes(cur, uu), now)
 	if err != nil {
-		return errors.Wrap(err, "updating user")
+		return Info{}, err
 	}
 
+	u.log.Debug("user.Patch", "trace_id", traceID)
+
+	return usr, nil
+}
+
+// update writes the provided fields of uu to the user, conditional on the
+// user still being at the version it was read at. Nothing is written when no
+// fields are provided.
+func (u User) update(ctx context.Context, traceID string, usr Info, uu UpdateUser, now time.Time) (Info, error) {
+	set := bson.M{}
+	if uu.Name != nil {
+		set["name"] = *uu.Name
+	}
+	if uu.Email != nil {
+		set["email"] = *uu.Email
+	}
+	if uu.Roles != nil {
+		set["roles"] = uu.Roles
+	}
 	if uu.Password != nil {
 		pw, err := bcrypt.GenerateFromPassword([]byte(*uu.Password), bcrypt.DefaultCost)
 		if err != nil {
-			return errors.Wrap(err, "generating password hash")
+			return Info{}, errors.Wrap(err, "generating password hash")
 		}
-		usr.PasswordHash = pw
+		set["passwordhash"] = pw
 	}
-	usr.Updated_at = now
-
-	filter := bson.D{{Key: "name", Value: uu.Name}} // converting value to BSON type
-	after := options.After                // for returning updated document
-	returnOpt := options.FindOneAndUpdateOptions{
-
-		ReturnDocument: &after,
+	if len(set) == 0 {
+		return usr, nil
 	}
-	update := bson.M{
-			"$set": bson.M{
-			"name": *uu.Name,
-			"email": *uu.Email,
-			"roles": uu.Roles,
-			"password": *uu.Password,
-			"password_hash": usr.PasswordHash,
-			},
-		}
-	updateResult := userCollection.FindOneAndUpdate(ctx, filter, update, &returnOpt)
+	set["updated_at"] = now.UTC()
 
-	usr.Updated_at = now
+	// Only the hash of a password is kept. The unset clears plaintext
+	// passwords written by earlier versions.
+	update := bson.M{"$set": set, "$unset": bson.M{"password": ""}, "$inc": bson.M{"version": 1}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
 
 	var result Info
-	_ = updateResult.Decode(&result)
-	u.log.Printf("%s: %s", traceID, "user.Update")
+	if err := userCollection.FindOneAndUpdate(ctx, versionFilter(usr.ID, usr.Version), update, opts).Decode(&result); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return Info{}, ErrVersionMismatch
+		}
+		return Info{}, errors.Wrapf(err, "updating user %q", usr.ID)
+	}
 
-	return nil
+	if err := u.audit.Record(ctx, traceID, entity, usr.ID, audit.ActionUpdate, usr, result, now, secrets...); err != nil {
+		return Info{}, err
+	}
+
+	return result, nil
 }
 
-// Delete removes a user from the database.
-func (u User) Delete(ctx context.Context, traceID string, claims auth.Claims, userID string) error {
+// Delete archives a user. The document is kept with its deletion time and
+// the id of the user who removed it until it is restored or purged. The
+// write only succeeds against the given version of the user.
+func (u User) Delete(ctx context.Context, traceID string, claims auth.Claims, userID string, version int, now time.Time) error {
 
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.delete")
 	defer span.End()
@@ -153,61 +251,181 @@ func (u User) Delete(ctx context.Context, traceID string, claims auth.Claims, us
 		return ErrForbidden
 	}
 
-	opts := options.Delete().SetCollation(&options.Collation{}) // to specify language-specific rules for string comparison, such as rules for lettercase
-	res, err := userCollection.DeleteOne(ctx, bson.D{{Key:"_id", Value: userID}}, opts)
-	if err != nil {
-		log.Fatal(err)
+	update := bson.M{
+		"$set": bson.M{"deleted_at": now.UTC(), "deleted_by": claims.Subject},
+		"$inc": bson.M{"version": 1},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+
+	var before Info
+	if err := userCollection.FindOneAndUpdate(ctx, versionFilter(userID, version), update, opts).Decode(&before); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return missing(ctx, userID)
+		}
+		return errors.Wrapf(err, "deleting user %q", userID)
 	}
-	fmt.Printf("deleted %v documents\n", res.DeletedCount)
-	u.log.Printf("%s: %s", traceID, "user.Delete")
+
+	usr := before
+	deleted := now.UTC()
+	usr.Deleted_at, usr.Deleted_by = &deleted, claims.Subject
+	usr.Version++
+	if err := u.audit.Record(ctx, traceID, entity, userID, audit.ActionDelete, before, usr, now, secrets...); err != nil {
+		return err
+	}
+
+	u.log.Debug("user.Delete", "trace_id", traceID)
 
 	return nil
 }
 
-// Query retrieves a list of existing users from the database.
-func (u User) Query(ctx context.Context, traceID string, pageNumber int, rowsPerPage int) ([]*Info, error) {
+// Restore brings back a user archived by Delete.
+func (u User) Restore(ctx context.Context, traceID string, userID string, now time.Time) (Info, error) {
 
-	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.query")
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.restore")
 	defer span.End()
 
-	data := struct {
-		Offset      int `db:"offset"`
-		RowsPerPage int `db:"rows_per_page"`
-	}{
-		Offset:      (pageNumber - 1) * rowsPerPage,
-		RowsPerPage: rowsPerPage,
+	if err := validate.CheckID(userID); err != nil {
+		return Info{}, ErrInvalidID
+	}
+
+	filter := bson.M{"_id": userID, "deleted_at": bson.M{"$ne": nil}}
+	update := bson.M{
+		"$set":   bson.M{"updated_at": now.UTC()},
+		"$unset": bson.M{"deleted_at": "", "deleted_by": ""},
+		"$inc":   bson.M{"version": 1},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+
+	var before Info
+	if err := userCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&before); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, errors.Wrapf(err, "restoring user %q", userID)
+	}
+
+	usr := before
+	usr.Updated_at = now.UTC()
+	usr.Deleted_at, usr.Deleted_by = nil, ""
+	usr.Version++
+	if err := u.audit.Record(ctx, traceID, entity, userID, audit.ActionRestore, before, usr, now, secrets...); err != nil {
+		return Info{}, err
 	}
 
-	// Pass these options to the Find method
-	findOptionsOffset := options.Find()
-	findOptionPage := options.Find()
-	findOptionsOffset.SetLimit(int64(data.Offset))
-	findOptionPage.SetLimit(int64(data.RowsPerPage))
+	u.log.Debug("user.Restore", "trace_id", traceID)
+
+	return usr, nil
+}
+
+// Purge permanently removes the users that were deleted before the given
+// time and reports how many were removed.
+func (u User) Purge(ctx context.Context, traceID string, before time.Time, now time.Time) (int64, error) {
 
-	var results []*Info                                   //slice for multiple documents
-	cur, err := userCollection.Find(ctx, bson.D{{}},findOptionsOffset,findOptionPage) //returns a *mongo.Cursor
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.purge")
+	defer span.End()
+
+	cur, err := userCollection.Find(ctx, bson.M{"deleted_at": bson.M{"$lt": before.UTC()}})
 	if err != nil {
-		fmt.Println(err)
+		return 0, errors.Wrap(err, "selecting deleted users")
+	}
+
+	var purged []Info
+	if err := cur.All(ctx, &purged); err != nil {
+		return 0, errors.Wrap(err, "decoding deleted users")
 	}
-	for cur.Next(ctx) { //Next() gets the next document for corresponding cursor
 
-		var elem Info
-		err := cur.Decode(&elem)
+	var count int64
+	for _, usr := range purged {
+		res, err := userCollection.DeleteOne(ctx, bson.M{"_id": usr.ID, "deleted_at": usr.Deleted_at})
 		if err != nil {
-			log.Fatal(err)
+			return count, errors.Wrapf(err, "purging user %q", usr.ID)
+		}
+		if res.DeletedCount == 0 {
+			continue
 		}
+		count++
+
+		if err := u.audit.Record(ctx, traceID, entity, usr.ID, audit.ActionPurge, usr, nil, now, secrets...); err != nil {
+			return count, err
+		}
+	}
+
+	u.log.Debug("user.Purge", "trace_id", traceID)
+
+	return count, nil
+}
+
+// Query retrieves a list of existing users from the database. Deleted users
+// are only listed when includeDeleted is set.
+func (u User) Query(ctx context.Context, traceID string, pageNumber int, rowsPerPage int, includeDeleted bool) ([]*Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.query")
+	defer span.End()
+
+	opts := options.Find().
+		SetSkip(int64((pageNumber - 1) * rowsPerPage)).
+		SetLimit(int64(rowsPerPage))
+
+	filter := bson.M{}
+	if !includeDeleted {
+		filter["deleted_at"] = nil
+	}
+
+	cur, err := userCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "selecting users")
+	}
 
-		results = append(results, &elem) // appending document pointed by Next()
+	results := []*Info{}
+	if err := cur.All(ctx, &results); err != nil {
+		return nil, errors.Wrap(err, "decoding users")
 	}
-	cur.Close(ctx) // close the cursor once stream of documents has exhausted
-	fmt.Printf("Found multiple documents (array of pointers): %+v\n", results)
-	u.log.Printf("%s: %s", traceID, "user.Query")
+
+	u.log.Debug("user.Query", "trace_id", traceID)
 
 	return results, nil
 }
 
-// QueryByID gets the specified user from the database.
-func (u User) QueryByID(ctx context.Context, traceID string, claims auth.Claims, userID string) (Info, error) {
+// Export streams every user to fn in id order without holding them in
+// memory. Deleted users are only included when includeDeleted is set. It
+// stops at the first error returned by fn.
+func (u User) Export(ctx context.Context, traceID string, includeDeleted bool, fn func(usr Info) error) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.export")
+	defer span.End()
+
+	filter := bson.M{}
+	if !includeDeleted {
+		filter["deleted_at"] = nil
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	cur, err := userCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return errors.Wrap(err, "selecting users")
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var usr Info
+		if err := cur.Decode(&usr); err != nil {
+			return errors.Wrap(err, "decoding user")
+		}
+		if err := fn(usr); err != nil {
+			return err
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return errors.Wrap(err, "reading users")
+	}
+
+	u.log.Debug("user.Export", "trace_id", traceID)
+	return nil
+}
+
+// QueryByID gets the specified user from the database. A deleted user is
+// reported as not found unless includeDeleted is set.
+func (u User) QueryByID(ctx context.Context, traceID string, claims auth.Claims, userID string, includeDeleted bool) (Info, error) {
 
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.querybyid")
 	defer span.End()
@@ -221,43 +439,97 @@ func (u User) QueryByID(ctx context.Context, traceID string, claims auth.Claims,
 		return Info{}, ErrForbidden
 	}
 
-	var result Info //  an unordered representation of a BSON document which is a Map
-	err := userCollection.FindOne(ctx, bson.D{{Key:"_id",Value: userID}}).Decode(&result)
+	filter := bson.M{"_id": userID}
+	if !includeDeleted {
+		filter["deleted_at"] = nil
+	}
+
+	var result Info
+	if err := userCollection.FindOne(ctx, filter).Decode(&result); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, errors.Wrapf(err, "selecting user %q", userID)
+	}
+	u.log.Debug("user.QueryByID", "trace_id", traceID)
+
+	return result, nil
+}
+
+// ScrubPasswords removes the plaintext passwords earlier versions stored
+// next to the hash, recording each user changed in the audit trail. It
+// reports how many users were changed.
+func (u User) ScrubPasswords(ctx context.Context, traceID string, now time.Time) (int64, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.scrubpasswords")
+	defer span.End()
+
+	filter := bson.M{"password": bson.M{"$exists": true}}
+	cur, err := userCollection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
 	if err != nil {
+		return 0, errors.Wrap(err, "selecting users")
+	}
 
-		fmt.Println(err)
+	var ids []struct {
+		ID string `bson:"_id"`
+	}
+	if err := cur.All(ctx, &ids); err != nil {
+		return 0, errors.Wrap(err, "decoding users")
+	}
 
+	// The password is no longer part of Info, so the fields changed are
+	// recorded on their own.
+	type scrub struct {
+		Password string `bson:"password" json:"password,omitempty"`
+		Version  int    `bson:"version" json:"version"`
 	}
-	u.log.Printf("%s: %s", traceID, "user.QueryByID")
 
-	return result, nil
+	var n int64
+	update := bson.M{"$unset": bson.M{"password": ""}, "$inc": bson.M{"version": 1}}
+	for _, id := range ids {
+		var before scrub
+		err := userCollection.FindOneAndUpdate(ctx, bson.M{"_id": id.ID, "password": bson.M{"$exists": true}}, update).Decode(&before)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				continue
+			}
+			return n, errors.Wrapf(err, "scrubbing password of user %q", id.ID)
+		}
+
+		after := scrub{Version: before.Version + 1}
+		if err := u.audit.Record(ctx, traceID, entity, id.ID, audit.ActionUpdate, before, after, now, secrets...); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	u.log.Debug("user.ScrubPasswords", "trace_id", traceID)
+	return n, nil
 }
 
 // Authenticate finds a user by their email and verifies their password. On
 // success it returns a Claims User representing this user. The claims can be
-// used to generate a token for future authentication.
+// used to generate a token for future authentication. Deleted users can't
+// authenticate.
 func (u User) Authenticate(ctx context.Context, traceID string, now time.Time, email, password string) (auth.Claims, error) {
 
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.authenticate")
 	defer span.End()
 
-	data := struct {
-		Email string `db:"email"`
-	}{
-		Email: email,
-	}
-
 	var usr Info
-	err := userCollection.FindOne(ctx, bson.D{{Key:"email",Value: data.Email}}).Decode(&usr)
+	err := userCollection.FindOne(ctx, bson.M{"email": email, "deleted_at": nil}).Decode(&usr)
 	if err != nil {
-		fmt.Println(err)
+		if err == mongo.ErrNoDocuments {
+			return auth.Claims{}, ErrAuthenticationFailure
+		}
+		return auth.Claims{}, errors.Wrapf(err, "selecting user %q", email)
 	}
-	u.log.Printf("%s: %s", traceID, "user.Authenticate")
-	
+	u.log.Debug("user.Authenticate", "trace_id", traceID)
+
 	// Compare the provided password with the saved hash. Use the bcrypt
 	// comparison function so it is cryptographically secure.
 	if err := bcrypt.CompareHashAndPassword(usr.PasswordHash, []byte(password)); err != nil {
-		return auth.Claims{}, database.ErrAuthenticationFailure
+		return auth.Claims{}, ErrAuthenticationFailure
 	}
 
 	// If we are this far the request is valid. Create some claims for the user
@@ -273,4 +545,52 @@ func (u User) Authenticate(ctx context.Context, traceID string, now time.Time, e
 	}
 
 	return claims, nil
-}
\ No newline at end of file
+}
+
+// editable renders the fields of a user that can be updated. Passwords are
+// never rendered.
+func editable(usr Info) UpdateUser {
+	return UpdateUser{
+		Name:  &usr.Name,
+		Email: &usr.Email,
+		Roles: []string(usr.Roles),
+	}
+}
+
+// changes drops the fields of uu that hold the same value as cur.
+func changes(cur UpdateUser, uu UpdateUser) UpdateUser {
+	if uu.Name != nil && *uu.Name == *cur.Name {
+		uu.Name = nil
+	}
+	if uu.Email != nil && *uu.Email == *cur.Email {
+		uu.Email = nil
+	}
+	if uu.Roles != nil && reflect.DeepEqual(uu.Roles, cur.Roles) {
+		uu.Roles = nil
+	}
+	return uu
+}
+
+// versionFilter matches the live user with the given id at the given
+// version. Users written before versioning was introduced have no version
+// and are treated as version zero.
+func versionFilter(userID string, version int) bson.M {
+	filter := bson.M{"_id": userID, "deleted_at": nil, "version": version}
+	if version == 0 {
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	}
+	return filter
+}
+
+// missing works out why a versioned write matched nothing: either the user
+// is gone or its version moved on.
+func missing(ctx context.Context, userID string) error {
+	n, err := userCollection.CountDocuments(ctx, bson.M{"_id": userID, "deleted_at": nil})
+	if err != nil {
+		return errors.Wrapf(err, "selecting user %q", userID)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return ErrVersionMismatch
+}
@@ -44,6 +44,11 @@ func Authenticate(a *auth.Auth) web.Middleware {
 			// Add claims to the context so they can be retrieved later.
 			ctx = context.WithValue(ctx, auth.Key, claims)
 
+			// Record the user so the request is logged against them.
+			if v, ok := ctx.Value(web.KeyValues).(*web.Values); ok {
+				v.User = claims.Subject
+			}
+
 			// Call the next handler.
 			return handler(ctx, w, r)
 		}
@@ -51,7 +56,9 @@ func Authenticate(a *auth.Auth) web.Middleware {
 		return h
 	}
 
-	return m
+	return web.Describe(m, func(rt *web.Route) {
+		rt.Authenticated(web.AuthRequired)
+	})
 }
 
 // Authorize validates that an authenticated user has at least one role from a
@@ -86,5 +93,55 @@ func Authorize(roles ...string) web.Middleware {
 		return h
 	}
 
-	return m
+	return web.Describe(m, func(rt *web.Route) {
+		rt.Authorized(roles...)
+	})
+}
+
+// Identify attaches the claims of a valid JWT from the `Authorization` header
+// when one is supplied but lets anonymous requests through, so public routes
+// can offer more to authenticated users. A malformed or invalid token is
+// still rejected.
+func Identify(a *auth.Auth) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+			ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.mid.identify")
+			defer span.End()
+
+			authStr := r.Header.Get("authorization")
+			if authStr == "" {
+				return handler(ctx, w, r)
+			}
+
+			// Expecting: bearer <token>
+			parts := strings.Split(authStr, " ")
+			if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+				err := errors.New("expected authorization header format: bearer <token>")
+				return validate.NewRequestError(err, http.StatusUnauthorized)
+			}
+
+			claims, err := a.ValidateToken(parts[1])
+			if err != nil {
+				return validate.NewRequestError(err, http.StatusUnauthorized)
+			}
+
+			ctx = context.WithValue(ctx, auth.Key, claims)
+			if v, ok := ctx.Value(web.KeyValues).(*web.Values); ok {
+				v.User = claims.Subject
+			}
+
+			return handler(ctx, w, r)
+		}
+
+		return h
+	}
+
+	return web.Describe(m, func(rt *web.Route) {
+		rt.Authenticated(web.AuthOptional)
+	})
 }
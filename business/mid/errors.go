@@ -2,10 +2,11 @@ package mid
 
 import (
 	"context"
-	"log"
+	"encoding/json"
 	"net/http"
 
 	"github.com/nextwavedevs/drop/business/validate"
+	"github.com/nextwavedevs/drop/foundation/logger"
 	"github.com/nextwavedevs/drop/foundation/web"
 	"github.com/pkg/errors"
 	"go.opentelemetry.io/otel/trace"
@@ -13,8 +14,10 @@ import (
 
 // Errors handles errors coming out of the call chain. It detects normal
 // application errors which are used to respond to the client in a uniform way.
-// Unexpected errors (status >= 500) are logged.
-func Errors(log *log.Logger) web.Middleware {
+// Unexpected errors (status >= 500) are logged as errors and the rest as
+// warnings. Errors raised after a response was committed, such as a stream
+// failing partway, are only logged.
+func Errors(log *logger.Logger) web.Middleware {
 
 	// This is the actual middleware function to be executed.
 	m := func(handler web.Handler) web.Handler {
@@ -35,11 +38,9 @@ func Errors(log *log.Logger) web.Middleware {
 			// Run the next handler and catch any propagated error.
 			if err := handler(ctx, w, r); err != nil {
 
-				// Log the error.
-				log.Printf("%s: ERROR: %v", v.TraceID, err)
-
 				// Build out the error response.
 				var er validate.ErrorResponse
+				var fields validate.FieldErrors
 				var status int
 				switch act := errors.Cause(err).(type) {
 				case validate.FieldErrors:
@@ -47,6 +48,7 @@ func Errors(log *log.Logger) web.Middleware {
 						Error:  "data validation error",
 						Fields: act.Error(),
 					}
+					fields = act
 					status = http.StatusBadRequest
 				case *validate.RequestError:
 					er = validate.ErrorResponse{
@@ -60,9 +62,29 @@ func Errors(log *log.Logger) web.Middleware {
 					status = http.StatusInternalServerError
 				}
 
-				// Respond with the error back to the client.
-				if err := web.Respond(ctx, w, er, status); err != nil {
-					return err
+				// Log the error.
+				entry := log.WithContext(ctx).With("route", v.Route, "user", v.User, "status", status, "error", err)
+				if status >= http.StatusInternalServerError {
+					entry.Error("request failed")
+				} else {
+					entry.Warn("request rejected")
+				}
+
+				// Respond with the error back to the client, as problem
+				// details for clients that prefer them.
+				switch {
+				case v.StatusCode != 0:
+					// A status has already been written, such as by a
+					// stream that failed partway, so the response can
+					// only be cut short.
+				case web.Negotiate(r, "application/json", validate.ProblemType) == validate.ProblemType:
+					if err := respondProblem(ctx, w, v.TraceID, er.Error, fields, status); err != nil {
+						return err
+					}
+				default:
+					if err := web.Respond(ctx, w, er, status); err != nil {
+						return err
+					}
 				}
 
 				// If we receive the shutdown err we need to return it
@@ -81,3 +103,26 @@ func Errors(log *log.Logger) web.Middleware {
 
 	return m
 }
+
+// respondProblem sends an error as RFC 7807 problem details.
+func respondProblem(ctx context.Context, w http.ResponseWriter, traceID string, detail string, fields validate.FieldErrors, status int) error {
+	p := validate.Problem{
+		Type:          "about:blank",
+		Title:         http.StatusText(status),
+		Status:        status,
+		Detail:        detail,
+		Instance:      traceID,
+		InvalidParams: fields,
+	}
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	// The format of the error depends on the Accept header, so caches must
+	// key on it as they do for other responses.
+	w.Header().Add("Vary", "Accept")
+
+	return web.RespondRaw(ctx, w, data, validate.ProblemType, status)
+}
@@ -0,0 +1,122 @@
+package mid
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/nextwavedevs/drop/business/validate"
+	"github.com/nextwavedevs/drop/foundation/idempotency"
+	"github.com/nextwavedevs/drop/foundation/logger"
+	"github.com/nextwavedevs/drop/foundation/web"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxIdempotencyKey is the longest Idempotency-Key accepted.
+const maxIdempotencyKey = 255
+
+// Idempotency lets clients safely retry a request by sending the same
+// Idempotency-Key header. The first successful response is stored for ttl
+// and replayed for retries with an Idempotent-Replayed header. Keys are
+// scoped to the user when the claims are in the context, so this must run
+// after Authenticate or Identify, and to the client's address otherwise.
+// Reusing a key for a different request, or while the first is still being
+// handled, is refused with 409. Failed requests are not stored so they can
+// be retried. Requests without the header are handled as usual.
+func Idempotency(log *logger.Logger, store idempotency.Store, ttl time.Duration) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+			ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.mid.idempotency")
+			defer span.End()
+
+			// If the context is missing this value, request the service
+			// to be shutdown gracefully.
+			v, ok := ctx.Value(web.KeyValues).(*web.Values)
+			if !ok {
+				return web.NewShutdownError("web value missing from context")
+			}
+
+			key := r.Header.Get("Idempotency-Key")
+			if key == "" {
+				return handler(ctx, w, r)
+			}
+			if len(key) > maxIdempotencyKey {
+				return validate.NewRequestError(errors.New("idempotency key is too long"), http.StatusBadRequest)
+			}
+
+			// Read the body to fingerprint the request and put it back for
+			// the handler.
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				return errors.Wrap(err, "reading body")
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			// Scope the key so clients can't replay each other's responses.
+			key = BySubject(ctx, r) + ":" + key
+
+			sum := sha256.New()
+			sum.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+			sum.Write(body)
+			fingerprint := hex.EncodeToString(sum.Sum(nil))
+
+			res, err := store.Begin(ctx, key, fingerprint, ttl, v.Now)
+			switch {
+			case err == idempotency.ErrInProgress || err == idempotency.ErrMismatch:
+				return validate.NewRequestError(err, http.StatusConflict)
+			case err != nil:
+				return errors.Wrap(err, "claiming idempotency key")
+			case res != nil:
+				return replay(w, v, res)
+			}
+
+			rec := idempotency.NewRecorder(w)
+			if err := handler(ctx, rec, r); err != nil {
+				if err := store.Release(ctx, key); err != nil {
+					log.WithContext(ctx).Error("idempotency release", "error", err)
+				}
+				return err
+			}
+
+			if err := store.Complete(ctx, key, rec.Response()); err != nil {
+				log.WithContext(ctx).Error("idempotency complete", "error", err)
+			}
+
+			return nil
+		}
+
+		return h
+	}
+
+	return web.Describe(m, func(rt *web.Route) {
+		rt.Fails(http.StatusConflict)
+	})
+}
+
+// replay sends a stored response back to the client.
+func replay(w http.ResponseWriter, v *web.Values, res *idempotency.Response) error {
+	v.StatusCode = res.Status
+
+	h := w.Header()
+	for k, vs := range res.Header {
+		h[k] = vs
+	}
+	h.Set("Idempotent-Replayed", "true")
+	w.WriteHeader(res.Status)
+
+	if _, err := w.Write(res.Body); err != nil {
+		return err
+	}
+
+	return nil
+}
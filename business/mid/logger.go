@@ -2,17 +2,18 @@ package mid
 
 import (
 	"context"
-	"log"
 	"net/http"
 	"time"
 
+	"github.com/nextwavedevs/drop/foundation/logger"
 	"github.com/nextwavedevs/drop/foundation/web"
 	"go.opentelemetry.io/otel/trace"
 )
 
-// Logger writes some information about the request to the logs in the
-// format: TraceID : (200) GET /foo -> IP ADDR (latency)
-func Logger(log *log.Logger) web.Middleware {
+// Logger writes an entry when a request starts and another when it
+// completes, carrying the trace and span IDs, the route, the user, the
+// status and the latency in milliseconds.
+func Logger(log *logger.Logger) web.Middleware {
 
 	// This is the actual middleware function to be executed.
 	m := func(handler web.Handler) web.Handler {
@@ -30,18 +31,26 @@ func Logger(log *log.Logger) web.Middleware {
 				return web.NewShutdownError("web value missing from context")
 			}
 
-			log.Printf("%s: started: %s %s -> %s",
-				v.TraceID,
-				r.Method, r.URL.Path, r.RemoteAddr,
+			log := log.WithContext(ctx)
+
+			log.Debug("request started",
+				"method", r.Method,
+				"route", v.Route,
+				"path", r.URL.Path,
+				"remote", r.RemoteAddr,
 			)
 
 			// Call the next handler.
 			err := handler(ctx, w, r)
 
-			log.Printf("%s: completed: %s %s -> %s (%d) (%s)",
-				v.TraceID,
-				r.Method, r.URL.Path, r.RemoteAddr,
-				v.StatusCode, time.Since(v.Now),
+			log.Info("request completed",
+				"method", r.Method,
+				"route", v.Route,
+				"path", r.URL.Path,
+				"remote", r.RemoteAddr,
+				"user", v.User,
+				"status", v.StatusCode,
+				"latency_ms", float64(time.Since(v.Now).Microseconds())/1000,
 			)
 
 			// Return the error so it can be handled further up the chain.
@@ -52,4 +61,4 @@ func Logger(log *log.Logger) web.Middleware {
 	}
 
 	return m
-}
\ No newline at end of file
+}
@@ -5,8 +5,11 @@ import (
 	"expvar"
 	"net/http"
 	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/nextwavedevs/drop/foundation/metrics"
 	"github.com/nextwavedevs/drop/foundation/web"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -22,7 +25,20 @@ var m = struct {
 	err: expvar.NewInt("errors"),
 }
 
-// Metrics updates program counters.
+// pm contains the request metrics served in the Prometheus format.
+var pm = struct {
+	requests *metrics.Counter
+	latency  *metrics.Histogram
+	inFlight *metrics.Gauge
+}{
+	requests: metrics.Default.NewCounter("http_requests_total", "Number of requests handled by route, method and status.", "route", "method", "status"),
+	latency:  metrics.Default.NewHistogram("http_request_duration_seconds", "Latency of requests by route, method and status.", metrics.DefBuckets, "route", "method", "status"),
+	inFlight: metrics.Default.NewGauge("http_requests_in_flight", "Number of requests being handled by route and method.", "route", "method"),
+}
+
+// Metrics updates program counters and records the count, latency and
+// status of requests by route template and method. It must run outside
+// Errors so the status sent to the client is known.
 func Metrics() web.Middleware {
 
 	// This is the actual middleware function to be executed.
@@ -40,19 +56,39 @@ func Metrics() web.Middleware {
 				return handler(ctx, w, r)
 			}
 
+			// If the context is missing this value, request the service
+			// to be shutdown gracefully.
+			v, ok := ctx.Value(web.KeyValues).(*web.Values)
+			if !ok {
+				return web.NewShutdownError("web value missing from context")
+			}
+
+			pm.inFlight.Inc(v.Route, r.Method)
+			start := time.Now()
+
 			// Call the next handler.
 			err := handler(ctx, w, r)
 
+			pm.inFlight.Dec(v.Route, r.Method)
+
+			status := v.StatusCode
+			if err != nil && status == 0 {
+				status = http.StatusInternalServerError
+			}
+			code := strconv.Itoa(status)
+			pm.requests.Inc(v.Route, r.Method, code)
+			pm.latency.Observe(time.Since(start).Seconds(), v.Route, r.Method, code)
+
 			// Increment the request counter.
 			m.req.Add(1)
 
-			// Update the count for the number of active goroutines every 100 requests.
+			// Update the count for the number of active goroutines every 5000 requests.
 			if m.req.Value()%5000 == 0 {
 				m.gr.Set(int64(runtime.NumGoroutine()))
 			}
 
-			// Increment the errors counter if an error occurred on this request.
-			if err != nil {
+			// Increment the errors counter if the request failed.
+			if err != nil || status >= http.StatusBadRequest {
 				m.err.Add(1)
 			}
 
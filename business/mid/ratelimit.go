@@ -0,0 +1,100 @@
+package mid
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nextwavedevs/drop/business/auth"
+	"github.com/nextwavedevs/drop/business/validate"
+	"github.com/nextwavedevs/drop/foundation/logger"
+	"github.com/nextwavedevs/drop/foundation/ratelimit"
+	"github.com/nextwavedevs/drop/foundation/web"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RateKey identifies the client a request is counted against.
+type RateKey func(ctx context.Context, r *http.Request) string
+
+// ByIP counts requests against the address of the client, as worked out by
+// the App from the proxies it trusts.
+func ByIP(ctx context.Context, r *http.Request) string {
+	if v, ok := ctx.Value(web.KeyValues).(*web.Values); ok && v.ClientIP != "" {
+		return "ip:" + v.ClientIP
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// BySubject counts requests against the authenticated user, or the address
+// of the client for anonymous requests. The claims are only there once
+// Authenticate or Identify has run, so it must be used in the middleware of
+// a route after them and not in the App's middleware.
+func BySubject(ctx context.Context, r *http.Request) string {
+	if claims, ok := ctx.Value(auth.Key).(auth.Claims); ok && claims.Subject != "" {
+		return "sub:" + claims.Subject
+	}
+	return ByIP(ctx, r)
+}
+
+// RateLimit limits the requests a client makes to the routes of a group.
+// Each group has its own buckets so a client exhausting one group can still
+// use the others. The outcome is reported in RateLimit-Limit,
+// RateLimit-Remaining and RateLimit-Reset headers; refused requests get 429
+// with Retry-After. Requests are let through when the store fails.
+func RateLimit(log *logger.Logger, store ratelimit.Store, group string, limit ratelimit.Limit, key RateKey) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+			ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.mid.ratelimit")
+			defer span.End()
+
+			// If the context is missing this value, request the service
+			// to be shutdown gracefully.
+			v, ok := ctx.Value(web.KeyValues).(*web.Values)
+			if !ok {
+				return web.NewShutdownError("web value missing from context")
+			}
+
+			res, err := store.Take(ctx, group+":"+key(ctx, r), limit, v.Now)
+			if err != nil {
+				log.WithContext(ctx).Error("rate limit", "group", group, "error", err)
+				return handler(ctx, w, r)
+			}
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("RateLimit-Reset", ceilSeconds(res.Reset))
+
+			if !res.Allowed {
+				w.Header().Set("Retry-After", ceilSeconds(res.RetryAfter))
+				return validate.NewRequestError(errors.New("rate limit exceeded"), http.StatusTooManyRequests)
+			}
+
+			return handler(ctx, w, r)
+		}
+
+		return h
+	}
+
+	return web.Describe(m, func(rt *web.Route) {
+		rt.Fails(http.StatusTooManyRequests)
+	})
+}
+
+// ceilSeconds renders a duration as whole seconds, rounding up.
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,162 @@
+package validate
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+
+	ut "github.com/go-playground/universal-translator"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+// postcodes holds the postal code formats of the countries whose codes are
+// checked. Codes are upper cased before they are matched.
+var postcodes = map[string]*regexp.Regexp{
+	"AU": regexp.MustCompile(`^\d{4}$`),
+	"BR": regexp.MustCompile(`^\d{5}-?\d{3}$`),
+	"CA": regexp.MustCompile(`^[A-Z]\d[A-Z] ?\d[A-Z]\d$`),
+	"DE": regexp.MustCompile(`^\d{5}$`),
+	"DK": regexp.MustCompile(`^\d{4}$`),
+	"ES": regexp.MustCompile(`^\d{5}$`),
+	"FR": regexp.MustCompile(`^\d{5}$`),
+	"GB": regexp.MustCompile(`^([A-Z]{1,2}\d[A-Z\d]? ?\d[A-Z]{2}|GIR ?0AA)$`),
+	"IE": regexp.MustCompile(`^[A-Z]\d[\dW] ?[A-Z\d]{4}$`),
+	"IN": regexp.MustCompile(`^\d{6}$`),
+	"IT": regexp.MustCompile(`^\d{5}$`),
+	"JP": regexp.MustCompile(`^\d{3}-?\d{4}$`),
+	"KE": regexp.MustCompile(`^\d{5}$`),
+	"MX": regexp.MustCompile(`^\d{5}$`),
+	"NG": regexp.MustCompile(`^\d{6}$`),
+	"NL": regexp.MustCompile(`^\d{4} ?[A-Z]{2}$`),
+	"NZ": regexp.MustCompile(`^\d{4}$`),
+	"PT": regexp.MustCompile(`^\d{4}-\d{3}$`),
+	"SE": regexp.MustCompile(`^\d{3} ?\d{2}$`),
+	"SG": regexp.MustCompile(`^\d{6}$`),
+	"US": regexp.MustCompile(`^\d{5}(-\d{4})?$`),
+	"ZA": regexp.MustCompile(`^\d{4}$`),
+}
+
+// anyPostcode is the loose format accepted for countries not listed in
+// postcodes.
+var anyPostcode = regexp.MustCompile(`^[A-Z\d][A-Z\d -]{1,9}$`)
+
+// registerAddress adds the address tags and their messages to the validator.
+//
+//	iso3166        the field is an ISO 3166-1 alpha-2 country code
+//	postcode=Field the field is a postal code of the country held in Field
+//	region=Field   the field is a region of the country held in Field
+func registerAddress(lang ut.Translator) {
+	for _, t := range []struct {
+		tag string
+		fn  validator.Func
+		msg string
+	}{
+		{"iso3166", isCountry, "{0} must be an ISO 3166 country code"},
+		{"postcode", isPostcode, "{0} is not a postal code of the country"},
+		{"region", isRegion, "{0} is not a region of the country"},
+	} {
+		t := t
+		validate.RegisterValidation(t.tag, t.fn)
+		validate.RegisterTranslation(t.tag, lang, func(ut ut.Translator) error {
+			return ut.Add(t.tag, t.msg, true)
+		}, func(ut ut.Translator, fe validator.FieldError) string {
+			msg, err := ut.T(fe.Tag(), fe.Field())
+			if err != nil {
+				return fe.(error).Error()
+			}
+			return msg
+		})
+	}
+}
+
+// CountryCode resolves a country code, name or common alias to its ISO
+// 3166-1 alpha-2 code.
+func CountryCode(s string) (string, bool) {
+	if code := strings.ToUpper(strings.TrimSpace(s)); len(code) == 2 {
+		if _, ok := countries[code]; ok {
+			return code, true
+		}
+	}
+
+	name := fold(s)
+	if code, ok := countryAliases[name]; ok {
+		return code, true
+	}
+	for code, n := range countries {
+		if fold(n) == name {
+			return code, true
+		}
+	}
+	return "", false
+}
+
+// KnownRegions reports whether the regions of a country are checked.
+func KnownRegions(country string) bool {
+	_, ok := regions[country]
+	return ok
+}
+
+// RegionCode resolves a region code or name to its ISO 3166-2 code, without
+// the country prefix. It reports false for countries whose regions are not
+// known.
+func RegionCode(country string, s string) (string, bool) {
+	known, ok := regions[country]
+	if !ok {
+		return "", false
+	}
+
+	if code := strings.ToUpper(strings.TrimSpace(s)); code != "" {
+		if _, ok := known[code]; ok {
+			return code, true
+		}
+	}
+
+	name := fold(s)
+	for code, n := range known {
+		if fold(n) == name {
+			return code, true
+		}
+	}
+	return "", false
+}
+
+// isCountry implements the iso3166 tag.
+func isCountry(fl validator.FieldLevel) bool {
+	_, ok := countries[fl.Field().String()]
+	return ok
+}
+
+// isPostcode implements the postcode tag.
+func isPostcode(fl validator.FieldLevel) bool {
+	re, ok := postcodes[sibling(fl)]
+	if !ok {
+		re = anyPostcode
+	}
+	return re.MatchString(strings.ToUpper(strings.TrimSpace(fl.Field().String())))
+}
+
+// isRegion implements the region tag. Any region is accepted for countries
+// whose regions are not known.
+func isRegion(fl validator.FieldLevel) bool {
+	country := sibling(fl)
+	if !KnownRegions(country) {
+		return true
+	}
+	_, ok := RegionCode(country, fl.Field().String())
+	return ok
+}
+
+// sibling returns the value of the string field named by the tag parameter
+// in the struct holding the field being checked.
+func sibling(fl validator.FieldLevel) string {
+	f := reflect.Indirect(fl.Parent()).FieldByName(fl.Param())
+	if f.Kind() != reflect.String {
+		return ""
+	}
+	return f.String()
+}
+
+// fold lower cases a name and collapses its white space for comparing.
+func fold(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
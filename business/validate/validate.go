@@ -1,12 +1,12 @@
 package validate
 
 import (
-	"encoding/json"
 	"errors"
 	"reflect"
 	"strings"
 
 	"github.com/google/uuid"
+	"github.com/nextwavedevs/drop/foundation/web"
 	en "github.com/go-playground/locales/en"
 	ut "github.com/go-playground/universal-translator"
 	validator "gopkg.in/go-playground/validator.v9"
@@ -35,14 +35,39 @@ func init() {
 	lang, _ := translator.GetTranslator("en")
 	en_translations.RegisterDefaultTranslations(validate, lang)
 
-	// Use JSON tag names for errors instead of Go struct names.
+	// Register the country aware address checks.
+	registerAddress(lang)
+
+	// Let optional URLs sent as pointers be cleared with an empty string.
+	validate.RegisterAlias("clearable_url", "len=0|url")
+	validate.RegisterTranslation("clearable_url", lang, func(ut ut.Translator) error {
+		return ut.Add("clearable_url", "{0} must be a valid URL or empty", true)
+	}, func(ut ut.Translator, fe validator.FieldError) string {
+		msg, err := ut.T(fe.Tag(), fe.Field())
+		if err != nil {
+			return fe.(error).Error()
+		}
+		return msg
+	})
+
+	// Use JSON tag names for errors instead of Go struct names, or the
+	// parameter names of values bound from the query string or path.
 	validate.RegisterTagNameFunc(func(fld reflect.StructField) string {
 		name := strings.SplitN(fld.Tag.Get("json"), ",", 2)[0]
 		if name == "-" {
 			return ""
 		}
+		if name == "" {
+			name = fld.Tag.Get("query")
+		}
+		if name == "" {
+			name = fld.Tag.Get("param")
+		}
 		return name
 	})
+
+	// Check the values bound by web.DecodeQuery like any other.
+	web.SetQueryValidator(Check)
 }
 
 // =============================================================================
@@ -100,40 +125,34 @@ type ErrorResponse struct {
 	Fields string `json:"fields,omitempty"`
 }
 
-// RequestError is used to pass an error during the request through the
-// application with web specific context.
-type RequestError struct {
-	Err    error
-	Status int
-	Fields error
+// ProblemType is the media type of Problem responses.
+const ProblemType = "application/problem+json"
+
+// Problem is the RFC 7807 form of API responses from failures, sent to
+// clients that ask for it. Instance holds the trace ID of the request and
+// InvalidParams the fields that failed validation.
+type Problem struct {
+	Type          string      `json:"type"`
+	Title         string      `json:"title"`
+	Status        int         `json:"status"`
+	Detail        string      `json:"detail,omitempty"`
+	Instance      string      `json:"instance,omitempty"`
+	InvalidParams FieldErrors `json:"invalid-params,omitempty"`
 }
 
+// RequestError is used to pass an error during the request through the
+// application with web specific context. It lives in the web package so the
+// framework can raise it too.
+type RequestError = web.RequestError
+
 // NewRequestError wraps a provided error with an HTTP status code. This
 // function should be used when handlers encounter expected errors.
 func NewRequestError(err error, status int) error {
-	return &RequestError{err, status, nil}
-}
-
-// Error implements the error interface. It uses the default message of the
-// wrapped error. This is what will be shown in the services' logs.
-func (err *RequestError) Error() string {
-	return err.Err.Error()
+	return web.NewRequestError(err, status)
 }
 
 // FieldError is used to indicate an error with a specific request field.
-type FieldError struct {
-	Field string `json:"field"`
-	Error string `json:"error"`
-}
+type FieldError = web.FieldError
 
 // FieldErrors represents a collection of field errors.
-type FieldErrors []FieldError
-
-// Error implments the error interface.
-func (fe FieldErrors) Error() string {
-	d, err := json.Marshal(fe)
-	if err != nil {
-		return err.Error()
-	}
-	return string(d)
-}
+type FieldErrors = web.FieldErrors
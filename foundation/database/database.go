@@ -3,7 +3,6 @@ package database
 import (
 	"context"
 	"errors"
-	"fmt"
 	"log"
 	"time"
 
@@ -22,7 +21,7 @@ var (
 //DBinstance func
 func DBinstance() *mongo.Client {
 
-	client, err := mongo.NewClient(options.Client().ApplyURI("mongodb://mongo:27017"))
+	client, err := mongo.NewClient(options.Client().ApplyURI("mongodb://mongo:27017").SetMonitor(monitor))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -34,7 +33,6 @@ func DBinstance() *mongo.Client {
 	if err != nil {
 		log.Fatal(err)
 	}
-	fmt.Println("Connected to MongoDB!")
 
 	return client
 }
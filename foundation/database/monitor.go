@@ -0,0 +1,33 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/nextwavedevs/drop/foundation/metrics"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// commandDuration is the latency of the commands sent to MongoDB.
+var commandDuration = metrics.Default.NewHistogram(
+	"mongo_command_duration_seconds",
+	"Latency of MongoDB commands by command and outcome.",
+	metrics.DefBuckets,
+	"command", "status",
+)
+
+// monitor records the latency of every command the client sends.
+var monitor = &event.CommandMonitor{
+	Succeeded: func(ctx context.Context, evt *event.CommandSucceededEvent) {
+		observeCommand(evt.CommandFinishedEvent, "ok")
+	},
+	Failed: func(ctx context.Context, evt *event.CommandFailedEvent) {
+		observeCommand(evt.CommandFinishedEvent, "error")
+	},
+}
+
+// observeCommand records a finished command.
+func observeCommand(evt event.CommandFinishedEvent, status string) {
+	d := time.Duration(evt.DurationNanos)
+	commandDuration.Observe(d.Seconds(), evt.CommandName, status)
+}
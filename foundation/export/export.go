@@ -0,0 +1,218 @@
+// Package export streams records as CSV, NDJSON or a JSON array with a
+// selectable set of fields, writing each record as it arrives.
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Set of supported export formats.
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+	FormatJSON   = "json"
+)
+
+// ErrInvalid occurs when an export is asked for in an unknown format or with
+// fields that can't be exported.
+var ErrInvalid = errors.New("invalid export")
+
+// Encoder holds the format and fields of an export.
+type Encoder struct {
+	format string
+	fields []string
+}
+
+// NewEncoder constructs an Encoder for the format. Fields selects and orders
+// the fields written, each of which must be one of allowed. Without fields
+// every allowed field is written.
+func NewEncoder(format string, fields []string, allowed []string) (Encoder, error) {
+	switch format {
+	case FormatCSV, FormatNDJSON, FormatJSON:
+	default:
+		return Encoder{}, errors.Wrapf(ErrInvalid, "unknown format %q", format)
+	}
+
+	if len(fields) == 0 {
+		return Encoder{format: format, fields: allowed}, nil
+	}
+
+	ok := make(map[string]bool, len(allowed))
+	for _, f := range allowed {
+		ok[f] = true
+	}
+	for _, f := range fields {
+		if !ok[f] {
+			return Encoder{}, errors.Wrapf(ErrInvalid, "unknown field %q", f)
+		}
+	}
+
+	return Encoder{format: format, fields: fields}, nil
+}
+
+// ContentType returns the media type of the encoded output.
+func (e Encoder) ContentType() string {
+	switch e.format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	}
+	return "application/json"
+}
+
+// Extension returns the file extension of the encoded output.
+func (e Encoder) Extension() string {
+	return "." + e.format
+}
+
+// NewWriter constructs a Writer encoding records to w. Nothing is written
+// until the first record or Close.
+func (e Encoder) NewWriter(w io.Writer) *Writer {
+	ew := Writer{Encoder: e, w: w}
+	if e.format == FormatCSV {
+		ew.csv = csv.NewWriter(w)
+	}
+	return &ew
+}
+
+// =============================================================================
+
+// Writer encodes records one at a time.
+type Writer struct {
+	Encoder
+	w       io.Writer
+	csv     *csv.Writer
+	count   int
+	started bool
+}
+
+// Write encodes a record. Records are rendered as JSON first so field names
+// and values match the rest of the API. In CSV lists are joined with
+// semicolons and objects are written as JSON.
+func (w *Writer) Write(record interface{}) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrap(err, "encoding record")
+	}
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return errors.Wrap(err, "decoding record")
+	}
+
+	if err := w.begin(); err != nil {
+		return err
+	}
+	w.count++
+
+	switch w.format {
+	case FormatCSV:
+		row := make([]string, len(w.fields))
+		for i, f := range w.fields {
+			row[i] = csvValue(values[f])
+		}
+		return w.csv.Write(row)
+
+	case FormatNDJSON:
+		_, err := w.w.Write(append(object(w.fields, values), '\n'))
+		return err
+	}
+
+	if w.count > 1 {
+		if _, err := io.WriteString(w.w, ","); err != nil {
+			return err
+		}
+	}
+	_, err = w.w.Write(object(w.fields, values))
+	return err
+}
+
+// Close completes the output. It must be called once every record has been
+// written.
+func (w *Writer) Close() error {
+	if err := w.begin(); err != nil {
+		return err
+	}
+
+	switch w.format {
+	case FormatCSV:
+		w.csv.Flush()
+		return w.csv.Error()
+	case FormatJSON:
+		_, err := io.WriteString(w.w, "]\n")
+		return err
+	}
+	return nil
+}
+
+// begin writes the CSV header or opening bracket ahead of the first record.
+func (w *Writer) begin() error {
+	if w.started {
+		return nil
+	}
+	w.started = true
+
+	switch w.format {
+	case FormatCSV:
+		return w.csv.Write(w.fields)
+	case FormatJSON:
+		if _, err := io.WriteString(w.w, "["); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// object renders the selected fields of a record as a JSON object, keeping
+// the order of the fields.
+func object(fields []string, values map[string]json.RawMessage) []byte {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		name, _ := json.Marshal(f)
+		b.Write(name)
+		b.WriteByte(':')
+		if v, ok := values[f]; ok {
+			b.Write(v)
+		} else {
+			b.WriteString("null")
+		}
+	}
+	b.WriteByte('}')
+	return b.Bytes()
+}
+
+// csvValue renders a JSON value as a CSV field.
+func csvValue(raw json.RawMessage) string {
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return ""
+	}
+
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case []interface{}:
+		var items []json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return string(raw)
+		}
+		parts := make([]string, len(items))
+		for i, item := range items {
+			parts[i] = csvValue(item)
+		}
+		return strings.Join(parts, ";")
+	}
+	return string(raw)
+}
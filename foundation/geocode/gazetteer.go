@@ -0,0 +1,187 @@
+package geocode
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/csv"
+	"io"
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// bundled is the small gazetteer of major cities shipped with the binary.
+//
+//go:embed gazetteer.csv
+var bundled []byte
+
+// gazetteerHeader is the set of columns a gazetteer file starts with.
+var gazetteerHeader = []string{"city", "state", "state_code", "country", "country_code", "lat", "lng"}
+
+// countryAliases maps common alternative country names to their codes.
+var countryAliases = map[string]string{
+	"usa":                      "us",
+	"united states of america": "us",
+	"america":                  "us",
+	"uk":                       "gb",
+	"great britain":            "gb",
+	"britain":                  "gb",
+	"england":                  "gb",
+	"scotland":                 "gb",
+	"wales":                    "gb",
+}
+
+// place is a single entry of a gazetteer.
+type place struct {
+	state       string
+	stateCode   string
+	country     string
+	countryCode string
+	lat         float64
+	lng         float64
+}
+
+// Gazetteer locates addresses from a table of known places without calling
+// out to any service.
+type Gazetteer struct {
+	places map[string][]place
+}
+
+// Bundled constructs a Gazetteer from the table shipped with the binary.
+func Bundled() (*Gazetteer, error) {
+	return LoadGazetteer(bytes.NewReader(bundled))
+}
+
+// OpenGazetteer constructs a Gazetteer from the CSV file at path.
+func OpenGazetteer(path string) (*Gazetteer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening gazetteer")
+	}
+	defer f.Close()
+
+	return LoadGazetteer(f)
+}
+
+// LoadGazetteer constructs a Gazetteer from CSV with the columns city,
+// state, state_code, country, country_code, lat and lng, in that order and
+// under a header row.
+func LoadGazetteer(r io.Reader) (*Gazetteer, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(gazetteerHeader)
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading gazetteer header")
+	}
+	for i, col := range gazetteerHeader {
+		if normalize(header[i]) != normalize(col) {
+			return nil, errors.Errorf("gazetteer column %d is %q, expected %q", i+1, header[i], col)
+		}
+	}
+
+	g := Gazetteer{places: make(map[string][]place)}
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "reading gazetteer")
+		}
+
+		lat, err := strconv.ParseFloat(rec[5], 64)
+		if err != nil || lat < -90 || lat > 90 {
+			return nil, errors.Errorf("gazetteer line %d: invalid lat %q", line, rec[5])
+		}
+		lng, err := strconv.ParseFloat(rec[6], 64)
+		if err != nil || lng < -180 || lng > 180 {
+			return nil, errors.Errorf("gazetteer line %d: invalid lng %q", line, rec[6])
+		}
+
+		city := normalize(rec[0])
+		if city == "" {
+			return nil, errors.Errorf("gazetteer line %d: city is required", line)
+		}
+		g.places[city] = append(g.places[city], place{
+			state:       normalize(rec[1]),
+			stateCode:   normalize(rec[2]),
+			country:     normalize(rec[3]),
+			countryCode: normalize(rec[4]),
+			lat:         lat,
+			lng:         lng,
+		})
+	}
+
+	return &g, nil
+}
+
+// Geocode implements the Geocoder interface. An exact match on city, state
+// and country is fully confident. Matches that leave the state or country
+// open, or that could be one of several places, are less so.
+func (g *Gazetteer) Geocode(ctx context.Context, q Query) (Result, error) {
+	candidates := g.places[normalize(q.City)]
+	if len(candidates) == 0 {
+		return Result{}, ErrNotFound
+	}
+
+	confidence := 1.0
+
+	if country := normalize(q.Country); country != "" {
+		if code, ok := countryAliases[country]; ok {
+			country = code
+		}
+		candidates = filter(candidates, func(p place) bool {
+			return p.country == country || p.countryCode == country
+		})
+		if len(candidates) == 0 {
+			return Result{}, ErrNotFound
+		}
+	} else {
+		confidence -= 0.2
+	}
+
+	if state := normalize(q.State); state != "" {
+		matched := filter(candidates, func(p place) bool {
+			return p.state == state || p.stateCode == state
+		})
+		if len(matched) > 0 {
+			candidates = matched
+		} else {
+			confidence -= 0.4
+		}
+	} else {
+		confidence -= 0.2
+	}
+
+	if len(candidates) > 1 {
+		confidence -= 0.4
+	}
+
+	confidence = math.Round(confidence*100) / 100
+
+	p := candidates[0]
+	res := Result{
+		Lat:        p.lat,
+		Lng:        p.lng,
+		Confidence: confidence,
+		Low:        confidence < LowConfidence,
+		Source:     "gazetteer",
+	}
+
+	return res, nil
+}
+
+// filter returns the places matching fn.
+func filter(places []place, fn func(p place) bool) []place {
+	var out []place
+	for _, p := range places {
+		if fn(p) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
@@ -0,0 +1,176 @@
+// Package geocode turns addresses into coordinates. Lookups can be made
+// against a gazetteer of known places, an HTTP geocoding service or a chain
+// of both, and cached.
+package geocode
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNotFound is returned when an address can't be placed.
+var ErrNotFound = errors.New("address not found")
+
+// LowConfidence is the confidence below which a result is flagged as a
+// doubtful match worth checking by hand.
+const LowConfidence = 0.7
+
+// Query is the address to look up. Only City is required.
+type Query struct {
+	City    string
+	State   string
+	Country string
+}
+
+// key renders the query in a normalized form for comparing and caching.
+func (q Query) key() string {
+	return normalize(q.City) + "|" + normalize(q.State) + "|" + normalize(q.Country)
+}
+
+// Result is the location of an address. Confidence runs from zero to one
+// and Low is set when it falls below LowConfidence. Source names the
+// geocoder that found it.
+type Result struct {
+	Lat        float64 `json:"lat"`
+	Lng        float64 `json:"lng"`
+	Confidence float64 `json:"confidence"`
+	Low        bool    `json:"low_confidence"`
+	Source     string  `json:"source"`
+}
+
+// Geocoder is the behaviour required to locate an address.
+type Geocoder interface {
+	Geocode(ctx context.Context, q Query) (Result, error)
+}
+
+// Chain asks each geocoder in turn and returns the first confident result.
+// When every result is low confidence the best of them is returned.
+type Chain []Geocoder
+
+// Geocode implements the Geocoder interface.
+func (c Chain) Geocode(ctx context.Context, q Query) (Result, error) {
+	var best Result
+	var found bool
+	var lastErr error
+
+	for _, g := range c {
+		res, err := g.Geocode(ctx, q)
+		if err != nil {
+			if errors.Cause(err) != ErrNotFound {
+				lastErr = err
+			}
+			continue
+		}
+		if !res.Low {
+			return res, nil
+		}
+		if !found || res.Confidence > best.Confidence {
+			best, found = res, true
+		}
+	}
+
+	switch {
+	case found:
+		return best, nil
+	case lastErr != nil:
+		return Result{}, lastErr
+	}
+	return Result{}, ErrNotFound
+}
+
+// Cache remembers the answers of another geocoder for a while, including
+// addresses that could not be found. Errors are not cached.
+type Cache struct {
+	geocoder Geocoder
+	ttl      time.Duration
+	size     int
+
+	mu      sync.Mutex
+	entries map[string]entry
+}
+
+// entry is a cached answer.
+type entry struct {
+	res     Result
+	err     error
+	expires time.Time
+}
+
+// NewCache constructs a Cache in front of the geocoder holding up to size
+// answers for ttl each.
+func NewCache(g Geocoder, ttl time.Duration, size int) *Cache {
+	return &Cache{
+		geocoder: g,
+		ttl:      ttl,
+		size:     size,
+		entries:  make(map[string]entry),
+	}
+}
+
+// Geocode implements the Geocoder interface.
+func (c *Cache) Geocode(ctx context.Context, q Query) (Result, error) {
+	key := q.key()
+	now := time.Now()
+
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		return e.res, e.err
+	}
+
+	res, err := c.geocoder.Geocode(ctx, q)
+	if err != nil && errors.Cause(err) != ErrNotFound {
+		return Result{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= c.size {
+		c.evict(now)
+	}
+	c.entries[key] = entry{res: res, err: err, expires: now.Add(c.ttl)}
+
+	return res, err
+}
+
+// evict makes room for a new entry by dropping expired ones, or an arbitrary
+// one when none have expired.
+func (c *Cache) evict(now time.Time) {
+	for key, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, key)
+		}
+	}
+	for key := range c.entries {
+		if len(c.entries) < c.size {
+			return
+		}
+		delete(c.entries, key)
+	}
+}
+
+// accents folds the accented letters common in place names.
+var accents = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ä", "a", "ã", "a", "å", "a",
+	"é", "e", "è", "e", "ê", "e", "ë", "e",
+	"í", "i", "ì", "i", "î", "i", "ï", "i",
+	"ó", "o", "ò", "o", "ô", "o", "ö", "o", "õ", "o",
+	"ú", "u", "ù", "u", "û", "u", "ü", "u",
+	"ç", "c", "ñ", "n",
+)
+
+// normalize lower cases a place name, folds its accents and reduces it to
+// words of letters and digits.
+func normalize(s string) string {
+	s = accents.Replace(strings.ToLower(s))
+	return strings.Join(strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
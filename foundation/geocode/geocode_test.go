@@ -0,0 +1,119 @@
+package geocode_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nextwavedevs/drop/foundation/geocode"
+	"github.com/pkg/errors"
+)
+
+// stub is a geocoder giving a fixed answer and counting its calls.
+type stub struct {
+	res   geocode.Result
+	err   error
+	calls int
+}
+
+func (s *stub) Geocode(ctx context.Context, q geocode.Query) (geocode.Result, error) {
+	s.calls++
+	return s.res, s.err
+}
+
+// TestChain checks the first confident answer wins and failures are only
+// reported when nothing placed the address.
+func TestChain(t *testing.T) {
+	down := errors.New("service down")
+	sure := geocode.Result{Lat: 1, Confidence: 0.9, Source: "sure"}
+	weak := geocode.Result{Lat: 2, Confidence: 0.5, Low: true, Source: "weak"}
+	weaker := geocode.Result{Lat: 3, Confidence: 0.3, Low: true, Source: "weaker"}
+
+	tt := []struct {
+		name    string
+		chain   []*stub
+		want    geocode.Result
+		wantErr error
+		calls   []int
+	}{
+		{"first confident", []*stub{{res: sure}, {res: weak}}, sure, nil, []int{1, 0}},
+		{"skips low", []*stub{{res: weak}, {res: sure}}, sure, nil, []int{1, 1}},
+		{"best of low", []*stub{{res: weaker}, {res: weak}}, weak, nil, []int{1, 1}},
+		{"skips not found", []*stub{{err: geocode.ErrNotFound}, {res: sure}}, sure, nil, []int{1, 1}},
+		{"skips failure", []*stub{{err: down}, {res: weak}}, weak, nil, []int{1, 1}},
+		{"not found", []*stub{{err: geocode.ErrNotFound}, {err: geocode.ErrNotFound}}, geocode.Result{}, geocode.ErrNotFound, []int{1, 1}},
+		{"failure wins over not found", []*stub{{err: down}, {err: geocode.ErrNotFound}}, geocode.Result{}, down, []int{1, 1}},
+		{"empty", nil, geocode.Result{}, geocode.ErrNotFound, nil},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var c geocode.Chain
+			for _, s := range tc.chain {
+				c = append(c, s)
+			}
+
+			res, err := c.Geocode(context.Background(), geocode.Query{City: "x"})
+			if errors.Cause(err) != tc.wantErr {
+				t.Fatalf("got error %v, want %v", err, tc.wantErr)
+			}
+			if res != tc.want {
+				t.Fatalf("got %+v, want %+v", res, tc.want)
+			}
+			for i, s := range tc.chain {
+				if s.calls != tc.calls[i] {
+					t.Errorf("geocoder %d: got %d calls, want %d", i, s.calls, tc.calls[i])
+				}
+			}
+		})
+	}
+}
+
+// TestCache checks answers, including misses, are remembered until they
+// expire while failures are not.
+func TestCache(t *testing.T) {
+	res := geocode.Result{Lat: 1, Confidence: 0.9}
+
+	tt := []struct {
+		name  string
+		stub  stub
+		ttl   time.Duration
+		calls int
+	}{
+		{"result cached", stub{res: res}, time.Hour, 1},
+		{"not found cached", stub{err: geocode.ErrNotFound}, time.Hour, 1},
+		{"failure not cached", stub{err: errors.New("service down")}, time.Hour, 2},
+		{"expired", stub{res: res}, -time.Second, 2},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c := geocode.NewCache(&tc.stub, tc.ttl, 10)
+			q := geocode.Query{City: "London", Country: "GB"}
+
+			first, err1 := c.Geocode(context.Background(), q)
+			second, err2 := c.Geocode(context.Background(), geocode.Query{City: " london ", Country: "gb"})
+
+			if tc.stub.calls != tc.calls {
+				t.Fatalf("got %d calls, want %d", tc.stub.calls, tc.calls)
+			}
+			if first != second || errors.Cause(err1) != errors.Cause(err2) {
+				t.Fatalf("got %+v, %v then %+v, %v", first, err1, second, err2)
+			}
+		})
+	}
+
+	t.Run("evicts when full", func(t *testing.T) {
+		s := stub{res: res}
+		c := geocode.NewCache(&s, time.Hour, 1)
+
+		for _, city := range []string{"London", "Paris", "London"} {
+			if _, err := c.Geocode(context.Background(), geocode.Query{City: city}); err != nil {
+				t.Fatalf("geocoding %s: %v", city, err)
+			}
+		}
+		if s.calls != 3 {
+			t.Fatalf("got %d calls, want %d", s.calls, 3)
+		}
+	})
+}
@@ -0,0 +1,112 @@
+package geocode
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// HTTP locates addresses with a geocoding service speaking the Nominatim
+// search API. The base URL is configurable so any compatible service, or a
+// local stub, can be used.
+type HTTP struct {
+	baseURL   string
+	client    *http.Client
+	userAgent string
+}
+
+// NewHTTP constructs an HTTP geocoder calling the service at baseURL. The
+// user agent identifies the caller as public services ask.
+func NewHTTP(baseURL string, client *http.Client, userAgent string) *HTTP {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTP{
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		client:    client,
+		userAgent: userAgent,
+	}
+}
+
+// match is a single place returned by the service. Coordinates come back
+// as strings.
+type match struct {
+	Lat        string  `json:"lat"`
+	Lon        string  `json:"lon"`
+	Importance float64 `json:"importance"`
+}
+
+// Geocode implements the Geocoder interface. The confidence is the
+// importance the service gives its best match, lowered when it returns
+// several matches of similar importance.
+func (h *HTTP) Geocode(ctx context.Context, q Query) (Result, error) {
+	v := url.Values{}
+	v.Set("format", "jsonv2")
+	v.Set("limit", "3")
+	v.Set("city", q.City)
+	if q.State != "" {
+		v.Set("state", q.State)
+	}
+	if q.Country != "" {
+		v.Set("country", q.Country)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.baseURL+"/search?"+v.Encode(), nil)
+	if err != nil {
+		return Result{}, errors.Wrap(err, "building request")
+	}
+	req.Header.Set("Accept", "application/json")
+	if h.userAgent != "" {
+		req.Header.Set("User-Agent", h.userAgent)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return Result{}, errors.Wrap(err, "calling geocoder")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Result{}, errors.Errorf("geocoder responded %s", resp.Status)
+	}
+
+	var matches []match
+	if err := json.NewDecoder(resp.Body).Decode(&matches); err != nil {
+		return Result{}, errors.Wrap(err, "decoding geocoder response")
+	}
+	if len(matches) == 0 {
+		return Result{}, ErrNotFound
+	}
+
+	best := matches[0]
+	lat, err := strconv.ParseFloat(best.Lat, 64)
+	if err != nil {
+		return Result{}, errors.Wrapf(err, "parsing lat %q", best.Lat)
+	}
+	lng, err := strconv.ParseFloat(best.Lon, 64)
+	if err != nil {
+		return Result{}, errors.Wrapf(err, "parsing lon %q", best.Lon)
+	}
+
+	confidence := math.Min(math.Max(best.Importance, 0), 1)
+	if len(matches) > 1 && best.Importance-matches[1].Importance < 0.1 {
+		confidence /= 2
+	}
+	confidence = math.Round(confidence*100) / 100
+
+	res := Result{
+		Lat:        lat,
+		Lng:        lng,
+		Confidence: confidence,
+		Low:        confidence < LowConfidence,
+		Source:     "http",
+	}
+
+	return res, nil
+}
@@ -0,0 +1,73 @@
+package geocode_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nextwavedevs/drop/foundation/geocode"
+	"github.com/pkg/errors"
+)
+
+// TestHTTP checks responses of the geocoding service are turned into results.
+func TestHTTP(t *testing.T) {
+	tt := []struct {
+		name     string
+		status   int
+		body     string
+		want     geocode.Result
+		notFound bool
+		wantErr  bool
+	}{
+		{"confident", http.StatusOK, `[{"lat":"51.5","lon":"-0.12","importance":0.9}]`, geocode.Result{Lat: 51.5, Lng: -0.12, Confidence: 0.9, Source: "http"}, false, false},
+		{"close runner up", http.StatusOK, `[{"lat":"51.5","lon":"-0.12","importance":0.9},{"lat":"42.98","lon":"-81.24","importance":0.85}]`, geocode.Result{Lat: 51.5, Lng: -0.12, Confidence: 0.45, Low: true, Source: "http"}, false, false},
+		{"distant runner up", http.StatusOK, `[{"lat":"51.5","lon":"-0.12","importance":0.9},{"lat":"42.98","lon":"-81.24","importance":0.5}]`, geocode.Result{Lat: 51.5, Lng: -0.12, Confidence: 0.9, Source: "http"}, false, false},
+		{"importance clamped", http.StatusOK, `[{"lat":"1","lon":"2","importance":1.4}]`, geocode.Result{Lat: 1, Lng: 2, Confidence: 1, Source: "http"}, false, false},
+		{"no matches", http.StatusOK, `[]`, geocode.Result{}, true, false},
+		{"server error", http.StatusInternalServerError, ``, geocode.Result{}, false, true},
+		{"bad body", http.StatusOK, `{`, geocode.Result{}, false, true},
+		{"bad lat", http.StatusOK, `[{"lat":"north","lon":"2","importance":1}]`, geocode.Result{}, false, true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var got *http.Request
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.body))
+			}))
+			defer srv.Close()
+
+			h := geocode.NewHTTP(srv.URL+"/", srv.Client(), "drop-test")
+			res, err := h.Geocode(context.Background(), geocode.Query{City: "London", Country: "GB"})
+
+			switch {
+			case tc.notFound:
+				if errors.Cause(err) != geocode.ErrNotFound {
+					t.Fatalf("got error %v, want %v", err, geocode.ErrNotFound)
+				}
+			case tc.wantErr:
+				if err == nil || errors.Cause(err) == geocode.ErrNotFound {
+					t.Fatalf("got error %v, want a failure", err)
+				}
+			case err != nil:
+				t.Fatalf("geocoding: %v", err)
+			case res != tc.want:
+				t.Fatalf("got %+v, want %+v", res, tc.want)
+			}
+
+			if got.URL.Path != "/search" {
+				t.Errorf("got path %q, want %q", got.URL.Path, "/search")
+			}
+			q := got.URL.Query()
+			if _, ok := q["state"]; ok || q.Get("city") != "London" || q.Get("country") != "GB" {
+				t.Errorf("got query %q", got.URL.RawQuery)
+			}
+			if ua := got.Header.Get("User-Agent"); ua != "drop-test" {
+				t.Errorf("got user agent %q, want %q", ua, "drop-test")
+			}
+		})
+	}
+}
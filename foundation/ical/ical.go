@@ -0,0 +1,489 @@
+// Package ical encodes calendars in the RFC 5545 iCalendar format so events
+// can be subscribed to from calendar applications.
+package ical
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nextwavedevs/drop/foundation/rrule"
+	"github.com/pkg/errors"
+)
+
+// ContentType is the media type of an encoded calendar.
+const ContentType = "text/calendar; charset=utf-8"
+
+// horizon is how many years past the later of its start and the time of the
+// feed a recurring event's time zone is described for. Rules the zone still
+// follows at the end are written as RRULEs so they hold beyond it too.
+const horizon = 2
+
+// cycle is how many years, a full cycle of weekdays and leap years, a yearly
+// rule is checked against the zone past the end of the span before it is
+// written as an RRULE.
+const cycle = 28
+
+// Set of event statuses defined by RFC 5545.
+const (
+	StatusTentative = "TENTATIVE"
+	StatusConfirmed = "CONFIRMED"
+	StatusCancelled = "CANCELLED"
+)
+
+// Calendar is a named collection of events.
+type Calendar struct {
+	ProdID string
+	Name   string
+	Events []Event
+}
+
+// Event is a single VEVENT. UID must be stable across encodings so calendar
+// applications update an event rather than duplicate it. When TZID is set
+// Start, End and ExDates are written as local times in that zone together
+// with a matching VTIMEZONE, otherwise they are written in UTC.
+type Event struct {
+	UID          string
+	Summary      string
+	Description  string
+	Location     string
+	Status       string
+	Start        time.Time
+	End          time.Time
+	TZID         string
+	RRule        string
+	ExDates      []time.Time
+	Created      time.Time
+	LastModified time.Time
+}
+
+// Encode writes the calendar to w. Stamp is used as the DTSTAMP of every
+// event.
+func (c Calendar) Encode(w io.Writer, stamp time.Time) error {
+	var b bytes.Buffer
+	line := func(name string, value string) {
+		writeLine(&b, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", c.ProdID)
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	if c.Name != "" {
+		line("X-WR-CALNAME", escape(c.Name))
+	}
+
+	zones, err := c.timezones(stamp)
+	if err != nil {
+		return err
+	}
+	for _, z := range zones {
+		z.encode(&b)
+	}
+
+	for _, e := range c.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", e.UID)
+		line("DTSTAMP", utc(stamp))
+		writeLine(&b, "DTSTART"+e.timeValue(e.Start))
+		if !e.End.IsZero() {
+			writeLine(&b, "DTEND"+e.timeValue(e.End))
+		}
+		if e.RRule != "" {
+			line("RRULE", strings.TrimPrefix(e.RRule, "RRULE:"))
+		}
+		for _, ex := range e.ExDates {
+			writeLine(&b, "EXDATE"+e.timeValue(ex))
+		}
+		line("SUMMARY", escape(e.Summary))
+		if e.Description != "" {
+			line("DESCRIPTION", escape(e.Description))
+		}
+		if e.Location != "" {
+			line("LOCATION", escape(e.Location))
+		}
+		if e.Status != "" {
+			line("STATUS", e.Status)
+		}
+		if !e.Created.IsZero() {
+			line("CREATED", utc(e.Created))
+		}
+		if !e.LastModified.IsZero() {
+			line("LAST-MODIFIED", utc(e.LastModified))
+		}
+		line("END", "VEVENT")
+	}
+
+	line("END", "VCALENDAR")
+
+	_, err = w.Write(b.Bytes())
+	return err
+}
+
+// timeValue formats a property value, including the TZID parameter when the
+// event carries a time zone.
+func (e Event) timeValue(t time.Time) string {
+	if e.TZID == "" {
+		return ":" + utc(t)
+	}
+	loc, err := time.LoadLocation(e.TZID)
+	if err != nil {
+		return ":" + utc(t)
+	}
+	return ";TZID=" + e.TZID + ":" + t.In(loc).Format("20060102T150405")
+}
+
+// timezones builds a VTIMEZONE for every zone referenced by the events,
+// covering the span of time the events occupy. Recurring events are covered
+// up to the horizon past now.
+func (c Calendar) timezones(now time.Time) ([]timezone, error) {
+	spans := make(map[string][2]time.Time)
+	for _, e := range c.Events {
+		if e.TZID == "" {
+			continue
+		}
+		from, to := e.Start, e.End
+		if e.RRule != "" || to.IsZero() {
+			to = e.Start
+			if now.After(to) {
+				to = now
+			}
+			to = to.AddDate(horizon, 0, 0)
+		}
+		span, ok := spans[e.TZID]
+		if !ok || from.Before(span[0]) {
+			span[0] = from
+		}
+		if !ok || to.After(span[1]) {
+			span[1] = to
+		}
+		spans[e.TZID] = span
+	}
+
+	names := make([]string, 0, len(spans))
+	for name := range spans {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	zones := make([]timezone, 0, len(names))
+	for _, name := range names {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "loading timezone %q", name)
+		}
+		span := spans[name]
+		zones = append(zones, newTimezone(name, loc, span[0].AddDate(-1, 0, 0), span[1]))
+	}
+
+	return zones, nil
+}
+
+// =============================================================================
+
+// transition is a change of UTC offset within a time zone. When rrule is set
+// the change repeats every year by that rule from at onwards.
+type transition struct {
+	at         time.Time
+	name       string
+	offsetFrom int
+	offsetTo   int
+	daylight   bool
+	rrule      string
+}
+
+// timezone is a VTIMEZONE component derived from the Go time zone database.
+type timezone struct {
+	tzid        string
+	transitions []transition
+}
+
+// newTimezone finds the offset transitions of loc between from and to. Past
+// transitions are emitted as their own STANDARD or DAYLIGHT observances,
+// which keeps them exact, while the yearly rules the zone follows at the end
+// of the span become observances with an RRULE so clients apply them to
+// every later year.
+func newTimezone(tzid string, loc *time.Location, from time.Time, to time.Time) timezone {
+	z := timezone{tzid: tzid}
+
+	name, offset := from.In(loc).Zone()
+	standard := offset
+	var found []transition
+
+	for t, end := from, to.AddDate(cycle, 0, 0); t.Before(end); {
+		next := t.Add(24 * time.Hour)
+		_, nextOffset := next.In(loc).Zone()
+		if nextOffset != offset {
+			at := bisect(loc, t, next, offset)
+			newName, _ := at.In(loc).Zone()
+			found = append(found, transition{
+				at:         at,
+				name:       newName,
+				offsetFrom: offset,
+				offsetTo:   nextOffset,
+			})
+			if nextOffset < standard {
+				standard = nextOffset
+			}
+			offset = nextOffset
+		}
+		t = next
+	}
+
+	for i := range found {
+		found[i].daylight = found[i].offsetTo > standard
+	}
+
+	// Without rules holding past the span only the transitions within it
+	// are needed.
+	if found = recurring(found, to); len(found) > 0 && found[len(found)-1].rrule == "" {
+		n := len(found)
+		for n > 0 && !found[n-1].at.Before(to) {
+			n--
+		}
+		found = found[:n]
+	}
+
+	if len(found) == 0 {
+		_, offset := from.In(loc).Zone()
+		z.transitions = []transition{{
+			at:         time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC),
+			name:       name,
+			offsetFrom: offset,
+			offsetTo:   offset,
+		}}
+		return z
+	}
+
+	z.transitions = found
+	return z
+}
+
+// yearly is a transition rule of the form RRULE:FREQ=YEARLY;BYMONTH=m;
+// BYDAY=nWD at a fixed local time, the form zones use for daylight saving.
+type yearly struct {
+	month      time.Month
+	weekday    time.Weekday
+	n          int
+	clock      int
+	name       string
+	offsetFrom int
+	offsetTo   int
+}
+
+// ordinals returns the local onset of a transition along with the ordinal of
+// its weekday within the month counted from the start and from the end.
+func ordinals(t transition) (time.Time, int, int) {
+	local := t.at.In(time.FixedZone("", t.offsetFrom))
+	last := time.Date(local.Year(), local.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	return local, (local.Day()-1)/7 + 1, -((last-local.Day())/7 + 1)
+}
+
+// rules returns the yearly rules a transition could be an instance of.
+func rules(t transition) []yearly {
+	local, first, last := ordinals(t)
+	h, m, s := local.Clock()
+	r := yearly{
+		month:      local.Month(),
+		weekday:    local.Weekday(),
+		clock:      h*3600 + m*60 + s,
+		name:       t.name,
+		offsetFrom: t.offsetFrom,
+		offsetTo:   t.offsetTo,
+	}
+
+	byLast := r
+	r.n, byLast.n = first, last
+	return []yearly{byLast, r}
+}
+
+// matches reports whether the transition is an instance of the rule.
+func (r yearly) matches(t transition) bool {
+	local, first, last := ordinals(t)
+	h, m, s := local.Clock()
+	if local.Month() != r.month || local.Weekday() != r.weekday || h*3600+m*60+s != r.clock {
+		return false
+	}
+	if t.name != r.name || t.offsetFrom != r.offsetFrom || t.offsetTo != r.offsetTo {
+		return false
+	}
+	return r.n == first || r.n == last
+}
+
+// String formats the rule as the value of an RRULE property.
+func (r yearly) String() string {
+	rule := rrule.Rule{
+		Freq:      rrule.Yearly,
+		ByMonth:   []time.Month{r.month},
+		ByDay:     []rrule.Day{{Weekday: r.weekday, N: r.n}},
+		WeekStart: time.Monday,
+	}
+	return rule.String()
+}
+
+// recurring replaces the transitions at the end of the list that follow a
+// yearly rule for both the standard and the daylight observance with one
+// observance of each carrying the rule. The rules must hold from before end
+// to the last transition. The list is returned as it is when the zone
+// doesn't keep to such rules, such as when it no longer observes daylight
+// saving.
+func recurring(found []transition, end time.Time) []transition {
+	start := 0
+	var rule [2]yearly
+
+	for kind, daylight := range []bool{false, true} {
+		var idx []int
+		for i := len(found) - 1; i >= 0; i-- {
+			if found[i].daylight == daylight {
+				idx = append(idx, i)
+			}
+		}
+		if len(idx) < 2 {
+			return found
+		}
+
+		// Pick the rule that the most recent transitions keep to.
+		best := 0
+		for _, r := range rules(found[idx[0]]) {
+			n := 0
+			for n < len(idx) && r.matches(found[idx[n]]) {
+				n++
+			}
+			if n > best {
+				best, rule[kind] = n, r
+			}
+		}
+		if best < 2 || !found[idx[best-1]].at.Before(end) {
+			return found
+		}
+
+		if idx[best-1] > start {
+			start = idx[best-1]
+		}
+	}
+
+	// Both rules hold from start on; each begins at its first transition
+	// from there.
+	out := append([]transition(nil), found[:start]...)
+	for i := start; i < len(found); i++ {
+		if found[i].daylight != found[start].daylight {
+			first := found[start]
+			first.rrule = rule[kindOf(first)].String()
+			second := found[i]
+			second.rrule = rule[kindOf(second)].String()
+			return append(out, first, second)
+		}
+	}
+	return found
+}
+
+// kindOf indexes the rules of recurring by the kind of observance.
+func kindOf(t transition) int {
+	if t.daylight {
+		return 1
+	}
+	return 0
+}
+
+// bisect finds the first instant in (lo, hi] whose offset differs from the
+// offset at lo, to the second.
+func bisect(loc *time.Location, lo time.Time, hi time.Time, offset int) time.Time {
+	for hi.Sub(lo) > time.Second {
+		mid := lo.Add(hi.Sub(lo) / 2)
+		if _, o := mid.In(loc).Zone(); o == offset {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return hi.Truncate(time.Second)
+}
+
+// encode writes the VTIMEZONE component.
+func (z timezone) encode(b *bytes.Buffer) {
+	writeLine(b, "BEGIN:VTIMEZONE")
+	writeLine(b, "TZID:"+z.tzid)
+	for _, t := range z.transitions {
+		kind := "STANDARD"
+		if t.daylight {
+			kind = "DAYLIGHT"
+		}
+
+		// DTSTART is the local time of the onset in the offset being left.
+		local := t.at.In(time.FixedZone("", t.offsetFrom))
+
+		writeLine(b, "BEGIN:"+kind)
+		writeLine(b, "DTSTART:"+local.Format("20060102T150405"))
+		writeLine(b, "TZOFFSETFROM:"+offset(t.offsetFrom))
+		writeLine(b, "TZOFFSETTO:"+offset(t.offsetTo))
+		if t.rrule != "" {
+			writeLine(b, "RRULE:"+t.rrule)
+		}
+		if t.name != "" {
+			writeLine(b, "TZNAME:"+escape(t.name))
+		}
+		writeLine(b, "END:"+kind)
+	}
+	writeLine(b, "END:VTIMEZONE")
+}
+
+// =============================================================================
+
+// writeLine writes a content line terminated by CRLF, folding it so no line
+// is longer than 75 octets without splitting a UTF-8 sequence.
+func writeLine(b *bytes.Buffer, s string) {
+	const limit = 75
+
+	first := true
+	for len(s) > 0 {
+		max := limit
+		if !first {
+			max = limit - 1
+			b.WriteByte(' ')
+		}
+		if len(s) <= max {
+			b.WriteString(s)
+			break
+		}
+		cut := max
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n")
+		s = s[cut:]
+		first = false
+	}
+	b.WriteString("\r\n")
+}
+
+// escape escapes TEXT values as required by RFC 5545 section 3.3.11.
+func escape(s string) string {
+	r := strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	)
+	return r.Replace(s)
+}
+
+// utc formats a time in the UTC date-time form.
+func utc(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// offset formats a UTC offset in seconds as +HHMM.
+func offset(seconds int) string {
+	sign := '+'
+	if seconds < 0 {
+		sign = '-'
+		seconds = -seconds
+	}
+	return fmt.Sprintf("%c%02d%02d", sign, seconds/3600, (seconds%3600)/60)
+}
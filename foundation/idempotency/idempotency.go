@@ -0,0 +1,179 @@
+// Package idempotency remembers the response to a request made with an
+// idempotency key so a client retrying the request gets the same response
+// instead of repeating its effects.
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrInProgress is returned when a request with the key is still being
+// handled.
+var ErrInProgress = errors.New("request with this key is in progress")
+
+// ErrMismatch is returned when a key is reused for a different request.
+var ErrMismatch = errors.New("key was used for a different request")
+
+// Response is the response stored for a key.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Store holds the responses for keys. Begin must be atomic for a key so two
+// replicas never both handle the same request.
+type Store interface {
+
+	// Begin claims key for the request identified by fingerprint until ttl
+	// has passed. It returns the stored response when the request was
+	// already handled, ErrInProgress when it is still being handled and
+	// ErrMismatch when the key was claimed by another request. A nil
+	// response and error means the caller must handle the request.
+	Begin(ctx context.Context, key string, fingerprint string, ttl time.Duration, now time.Time) (*Response, error)
+
+	// Complete stores the response to the request that claimed key.
+	Complete(ctx context.Context, key string, res Response) error
+
+	// Release gives up the claim on key so the request can be retried.
+	Release(ctx context.Context, key string) error
+}
+
+// =============================================================================
+
+// Recorder is a http.ResponseWriter that passes the response through to the
+// client while keeping a copy of it.
+type Recorder struct {
+	w      http.ResponseWriter
+	header http.Header
+	status int
+	body   []byte
+}
+
+// NewRecorder constructs a Recorder writing to w. Only the headers set
+// through the Recorder are kept.
+func NewRecorder(w http.ResponseWriter) *Recorder {
+	return &Recorder{
+		w:      w,
+		header: make(http.Header),
+	}
+}
+
+// Header implements http.ResponseWriter.
+func (rec *Recorder) Header() http.Header {
+	return rec.header
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (rec *Recorder) WriteHeader(status int) {
+	if rec.status != 0 {
+		return
+	}
+	rec.status = status
+
+	h := rec.w.Header()
+	for k, vs := range rec.header {
+		h[k] = vs
+	}
+	rec.w.WriteHeader(status)
+}
+
+// Write implements http.ResponseWriter.
+func (rec *Recorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+	rec.body = append(rec.body, b...)
+	return rec.w.Write(b)
+}
+
+// Response returns the copy of the response written so far.
+func (rec *Recorder) Response() Response {
+	return Response{
+		Status: rec.status,
+		Header: rec.header.Clone(),
+		Body:   rec.body,
+	}
+}
+
+// =============================================================================
+
+// entry is the state of a key in a Memory store.
+type entry struct {
+	fingerprint string
+	expires     time.Time
+	res         *Response
+}
+
+// Memory is a Store kept in the memory of a single process. Expired keys are
+// dropped once the store holds more than its size.
+type Memory struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*entry
+}
+
+// NewMemory constructs a Memory store that starts dropping expired keys once
+// it holds size of them.
+func NewMemory(size int) *Memory {
+	return &Memory{
+		size:    size,
+		entries: make(map[string]*entry),
+	}
+}
+
+// Begin implements Store.
+func (m *Memory) Begin(ctx context.Context, key string, fingerprint string, ttl time.Duration, now time.Time) (*Response, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e, exists := m.entries[key]; exists && e.expires.After(now) {
+		switch {
+		case e.fingerprint != fingerprint:
+			return nil, ErrMismatch
+		case e.res == nil:
+			return nil, ErrInProgress
+		}
+		return e.res, nil
+	}
+
+	if len(m.entries) >= m.size {
+		m.sweep(now)
+	}
+	m.entries[key] = &entry{fingerprint: fingerprint, expires: now.Add(ttl)}
+
+	return nil, nil
+}
+
+// Complete implements Store.
+func (m *Memory) Complete(ctx context.Context, key string, res Response) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e, exists := m.entries[key]; exists {
+		e.res = &res
+	}
+	return nil
+}
+
+// Release implements Store.
+func (m *Memory) Release(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.entries, key)
+	return nil
+}
+
+// sweep drops the keys that have expired by now.
+func (m *Memory) sweep(now time.Time) {
+	for key, e := range m.entries {
+		if !e.expires.After(now) {
+			delete(m.entries, key)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+// Package logger provides a leveled logger writing one JSON object per
+// line so log pipelines can parse every entry. The level can be changed
+// while the program runs.
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Level is the severity of a log entry.
+type Level int32
+
+// Set of levels, least severe first.
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+// String returns the name of the level.
+func (lvl Level) String() string {
+	switch lvl {
+	case DebugLevel:
+		return "debug"
+	case InfoLevel:
+		return "info"
+	case WarnLevel:
+		return "warn"
+	case ErrorLevel:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int32(lvl))
+}
+
+// ParseLevel reads a level from its name.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return DebugLevel, nil
+	case "info":
+		return InfoLevel, nil
+	case "warn", "warning":
+		return WarnLevel, nil
+	case "error":
+		return ErrorLevel, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", s)
+}
+
+// Logger writes entries at or above its level as JSON lines. Loggers made
+// from one another with With share their output and level.
+type Logger struct {
+	mu      *sync.Mutex
+	out     io.Writer
+	level   *int32
+	service string
+	fields  []interface{}
+}
+
+// New constructs a Logger writing entries for the named service to out.
+func New(out io.Writer, service string, level Level) *Logger {
+	lvl := int32(level)
+	return &Logger{
+		mu:      &sync.Mutex{},
+		out:     out,
+		level:   &lvl,
+		service: service,
+	}
+}
+
+// With returns a Logger adding the key and value pairs to every entry.
+func (l *Logger) With(kv ...interface{}) *Logger {
+	nl := *l
+	nl.fields = append(append([]interface{}(nil), l.fields...), kv...)
+	return &nl
+}
+
+// WithContext returns a Logger adding the trace and span IDs of the span in
+// ctx to every entry.
+func (l *Logger) WithContext(ctx context.Context) *Logger {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return l
+	}
+	return l.With("trace_id", sc.TraceID().String(), "span_id", sc.SpanID().String())
+}
+
+// Level returns the level entries must reach to be written.
+func (l *Logger) Level() Level {
+	return Level(atomic.LoadInt32(l.level))
+}
+
+// SetLevel changes the level entries must reach to be written.
+func (l *Logger) SetLevel(level Level) {
+	atomic.StoreInt32(l.level, int32(level))
+}
+
+// Enabled reports whether entries at level are written.
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.Level()
+}
+
+// Debug writes an entry for diagnosing problems.
+func (l *Logger) Debug(msg string, kv ...interface{}) {
+	l.write(DebugLevel, msg, kv)
+}
+
+// Info writes an entry about the normal running of the program.
+func (l *Logger) Info(msg string, kv ...interface{}) {
+	l.write(InfoLevel, msg, kv)
+}
+
+// Warn writes an entry about something unexpected that was handled.
+func (l *Logger) Warn(msg string, kv ...interface{}) {
+	l.write(WarnLevel, msg, kv)
+}
+
+// Error writes an entry about a failure.
+func (l *Logger) Error(msg string, kv ...interface{}) {
+	l.write(ErrorLevel, msg, kv)
+}
+
+// Std returns a standard library logger writing each line as an entry at
+// level, for packages that only accept a *log.Logger.
+func (l *Logger) Std(level Level) *log.Logger {
+	return log.New(stdWriter{l, level}, "", 0)
+}
+
+// write encodes an entry with the fields of the Logger followed by kv.
+func (l *Logger) write(level Level, msg string, kv []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(`{"ts":`)
+	encode(&buf, time.Now().UTC().Format(time.RFC3339Nano))
+	buf.WriteString(`,"level":`)
+	encode(&buf, level.String())
+	if l.service != "" {
+		buf.WriteString(`,"service":`)
+		encode(&buf, l.service)
+	}
+	buf.WriteString(`,"msg":`)
+	encode(&buf, msg)
+	writeFields(&buf, l.fields)
+	writeFields(&buf, kv)
+	buf.WriteString("}\n")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(buf.Bytes())
+}
+
+// writeFields appends key and value pairs to an entry. A key without a value
+// is given a null one.
+func writeFields(buf *bytes.Buffer, kv []interface{}) {
+	for i := 0; i < len(kv); i += 2 {
+		buf.WriteByte(',')
+		encode(buf, fmt.Sprint(kv[i]))
+		buf.WriteByte(':')
+
+		var v interface{}
+		if i+1 < len(kv) {
+			v = kv[i+1]
+		}
+		encode(buf, v)
+	}
+}
+
+// encode appends a value as JSON. Errors and Stringers are written as their
+// text and values that can't be marshaled as their formatted form.
+func encode(buf *bytes.Buffer, v interface{}) {
+	switch vv := v.(type) {
+	case error:
+		v = vv.Error()
+	case time.Duration:
+		v = vv.String()
+	case fmt.Stringer:
+		v = vv.String()
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprintf("%+v", v))
+	}
+	buf.Write(data)
+}
+
+// stdWriter turns the lines of a standard library logger into entries.
+type stdWriter struct {
+	log   *Logger
+	level Level
+}
+
+// Write implements io.Writer.
+func (w stdWriter) Write(p []byte) (int, error) {
+	w.log.write(w.level, strings.TrimSpace(string(p)), nil)
+	return len(p), nil
+}
+
+// =============================================================================
+
+// levelBody is the body read and written by LevelHandler.
+type levelBody struct {
+	Level string `json:"level"`
+}
+
+// LevelHandler serves the level of the Logger. GET returns it and PUT sets
+// it from a body such as {"level":"debug"}.
+func (l *Logger) LevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var lb levelBody
+			if err := json.NewDecoder(r.Body).Decode(&lb); err != nil {
+				http.Error(w, "body must be {\"level\":\"debug|info|warn|error\"}", http.StatusBadRequest)
+				return
+			}
+			level, err := ParseLevel(lb.Level)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			l.SetLevel(level)
+			l.Info("log level changed", "level", level.String())
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(levelBody{Level: l.Level().String()})
+	})
+}
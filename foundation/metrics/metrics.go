@@ -0,0 +1,351 @@
+// Package metrics provides counters, gauges and histograms with labels and
+// serves them in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are the upper bounds, in seconds, of histogram buckets suited
+// to request latencies.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Default is the registry the program's metrics are kept in unless they are
+// given their own.
+var Default = NewRegistry()
+
+// family is a set of metrics written under one name.
+type family interface {
+	write(w *bufio.Writer)
+}
+
+// Registry holds the metrics served together by its Handler.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]family
+}
+
+// NewRegistry constructs an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		families: make(map[string]family),
+	}
+}
+
+// register adds a family under name. Names must be unique in a Registry.
+func (reg *Registry) register(name string, f family) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if _, exists := reg.families[name]; exists {
+		panic(fmt.Sprintf("metrics: %s registered twice", name))
+	}
+	reg.families[name] = f
+}
+
+// NewCounter registers a counter partitioned by the named labels.
+func (reg *Registry) NewCounter(name string, help string, labels ...string) *Counter {
+	c := Counter{vec: newVec(name, help, "counter", labels)}
+	reg.register(name, &c)
+	return &c
+}
+
+// NewGauge registers a gauge partitioned by the named labels.
+func (reg *Registry) NewGauge(name string, help string, labels ...string) *Gauge {
+	g := Gauge{vec: newVec(name, help, "gauge", labels)}
+	reg.register(name, &g)
+	return &g
+}
+
+// NewHistogram registers a histogram with the given bucket upper bounds,
+// partitioned by the named labels.
+func (reg *Registry) NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	bounds := append([]float64(nil), buckets...)
+	sort.Float64s(bounds)
+
+	h := Histogram{vec: newVec(name, help, "histogram", labels), buckets: bounds}
+	reg.register(name, &h)
+	return &h
+}
+
+// Handler serves every metric in the Registry, sorted by name.
+func (reg *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reg.mu.Lock()
+		names := make([]string, 0, len(reg.families))
+		for name := range reg.families {
+			names = append(names, name)
+		}
+		families := make([]family, len(names))
+		sort.Strings(names)
+		for i, name := range names {
+			families[i] = reg.families[name]
+		}
+		reg.mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		bw := bufio.NewWriter(w)
+		for _, f := range families {
+			f.write(bw)
+		}
+		bw.Flush()
+	})
+}
+
+// =============================================================================
+
+// series is the state of a metric for one set of label values.
+type series struct {
+	values []string
+	value  float64
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// vec holds the series of a metric keyed by their label values.
+type vec struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+// newVec constructs a vec for a metric of the given kind.
+func newVec(name string, help string, kind string, labels []string) vec {
+	return vec{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		series: make(map[string]*series),
+	}
+}
+
+// get returns the series for the label values, creating it when needed. The
+// caller must hold mu.
+func (v *vec) get(values []string) *series {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		v.series[key] = s
+	}
+	return s
+}
+
+// sorted returns the series ordered by their label values. The caller must
+// hold mu.
+func (v *vec) sorted() []*series {
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	list := make([]*series, len(keys))
+	for i, key := range keys {
+		list[i] = v.series[key]
+	}
+	return list
+}
+
+// writeHeader writes the HELP and TYPE lines of the metric.
+func (v *vec) writeHeader(w *bufio.Writer) {
+	writeHeader(w, v.name, v.help, v.kind)
+}
+
+// =============================================================================
+
+// Counter is a value that only goes up, such as a number of requests.
+type Counter struct {
+	vec
+}
+
+// Inc adds one to the series for the label values.
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds n, which must not be negative, to the series for the label
+// values.
+func (c *Counter) Add(n float64, values ...string) {
+	if n < 0 {
+		panic(fmt.Sprintf("metrics: counter %s can't decrease", c.name))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.get(values).value += n
+}
+
+// write implements family.
+func (c *Counter) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.writeHeader(w)
+	for _, s := range c.sorted() {
+		writeSample(w, c.name, c.labels, s.values, "", "", s.value)
+	}
+}
+
+// Gauge is a value that goes up and down, such as a number of requests in
+// flight.
+type Gauge struct {
+	vec
+}
+
+// Set sets the series for the label values to n.
+func (g *Gauge) Set(n float64, values ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.get(values).value = n
+}
+
+// Add adds n, which may be negative, to the series for the label values.
+func (g *Gauge) Add(n float64, values ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.get(values).value += n
+}
+
+// Inc adds one to the series for the label values.
+func (g *Gauge) Inc(values ...string) {
+	g.Add(1, values...)
+}
+
+// Dec takes one from the series for the label values.
+func (g *Gauge) Dec(values ...string) {
+	g.Add(-1, values...)
+}
+
+// write implements family.
+func (g *Gauge) write(w *bufio.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.writeHeader(w)
+	for _, s := range g.sorted() {
+		writeSample(w, g.name, g.labels, s.values, "", "", s.value)
+	}
+}
+
+// Histogram counts observations, such as request latencies, in buckets and
+// keeps their sum.
+type Histogram struct {
+	vec
+	buckets []float64
+}
+
+// Observe records v in the series for the label values.
+func (h *Histogram) Observe(v float64, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.get(values)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(h.buckets))
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += v
+}
+
+// write implements family. Bucket counts are written cumulatively as the
+// format requires.
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.writeHeader(w)
+	for _, s := range h.sorted() {
+		var cum uint64
+		for i, bound := range h.buckets {
+			cum += s.counts[i]
+			writeSample(w, h.name+"_bucket", h.labels, s.values, "le", formatFloat(bound), float64(cum))
+		}
+		writeSample(w, h.name+"_bucket", h.labels, s.values, "le", "+Inf", float64(s.count))
+		writeSample(w, h.name+"_sum", h.labels, s.values, "", "", s.sum)
+		writeSample(w, h.name+"_count", h.labels, s.values, "", "", float64(s.count))
+	}
+}
+
+// =============================================================================
+
+// writeHeader writes the HELP and TYPE lines of a metric.
+func writeHeader(w *bufio.Writer, name string, help string, kind string) {
+	help = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeSample writes one sample line. An extra label, such as a histogram's
+// le, is added after the others when extraName is set.
+func writeSample(w *bufio.Writer, name string, labels []string, values []string, extraName string, extraValue string, v float64) {
+	w.WriteString(name)
+
+	if len(labels) > 0 || extraName != "" {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			writeLabel(w, label, values[i])
+		}
+		if extraName != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			writeLabel(w, extraName, extraValue)
+		}
+		w.WriteByte('}')
+	}
+
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+// labelEscaper escapes label values as the format requires.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writeLabel writes a label pair.
+func writeLabel(w *bufio.Writer, name string, value string) {
+	w.WriteString(name)
+	w.WriteString(`="`)
+	labelEscaper.WriteString(w, value)
+	w.WriteByte('"')
+}
+
+// formatFloat formats a sample value.
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
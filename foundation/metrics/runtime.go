@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"bufio"
+	"runtime"
+	"runtime/pprof"
+	"time"
+)
+
+// RegisterRuntime registers the Go runtime metrics: goroutines, threads,
+// memory and garbage collection. They are read when the metrics are served.
+func (reg *Registry) RegisterRuntime() {
+	reg.register("go", runtimeFamily{start: time.Now()})
+}
+
+// runtimeFamily writes the Go runtime metrics.
+type runtimeFamily struct {
+	start time.Time
+}
+
+// write implements family.
+func (rf runtimeFamily) write(w *bufio.Writer) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	gauge := func(name string, help string, v float64) {
+		writeHeader(w, name, help, "gauge")
+		writeSample(w, name, nil, nil, "", "", v)
+	}
+	counter := func(name string, help string, v float64) {
+		writeHeader(w, name, help, "counter")
+		writeSample(w, name, nil, nil, "", "", v)
+	}
+
+	gauge("go_goroutines", "Number of goroutines that currently exist.", float64(runtime.NumGoroutine()))
+	gauge("go_threads", "Number of OS threads created.", float64(pprof.Lookup("threadcreate").Count()))
+
+	writeHeader(w, "go_info", "Information about the Go environment.", "gauge")
+	writeSample(w, "go_info", []string{"version"}, []string{runtime.Version()}, "", "", 1)
+
+	gauge("go_memstats_alloc_bytes", "Bytes of allocated heap objects.", float64(ms.Alloc))
+	counter("go_memstats_alloc_bytes_total", "Cumulative bytes allocated for heap objects.", float64(ms.TotalAlloc))
+	gauge("go_memstats_sys_bytes", "Bytes of memory obtained from the OS.", float64(ms.Sys))
+	gauge("go_memstats_heap_inuse_bytes", "Bytes in in-use heap spans.", float64(ms.HeapInuse))
+	gauge("go_memstats_heap_idle_bytes", "Bytes in idle heap spans.", float64(ms.HeapIdle))
+	gauge("go_memstats_heap_objects", "Number of allocated heap objects.", float64(ms.HeapObjects))
+	counter("go_memstats_mallocs_total", "Cumulative count of heap objects allocated.", float64(ms.Mallocs))
+	counter("go_memstats_frees_total", "Cumulative count of heap objects freed.", float64(ms.Frees))
+	gauge("go_memstats_stack_inuse_bytes", "Bytes in stack spans.", float64(ms.StackInuse))
+	gauge("go_memstats_next_gc_bytes", "Heap size target of the next garbage collection.", float64(ms.NextGC))
+	gauge("go_memstats_last_gc_time_seconds", "Time of the last garbage collection in seconds since the epoch.", float64(ms.LastGC)/1e9)
+	counter("go_gc_cycles_total", "Number of completed garbage collection cycles.", float64(ms.NumGC))
+	counter("go_gc_pause_seconds_total", "Cumulative time the program was paused by garbage collection.", float64(ms.PauseTotalNs)/1e9)
+
+	gauge("process_start_time_seconds", "Time the process started in seconds since the epoch.", float64(rf.start.Unix()))
+}
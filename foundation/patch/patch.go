@@ -0,0 +1,365 @@
+// Package patch applies JSON Merge Patch (RFC 7396) and JSON Patch
+// (RFC 6902) documents to JSON documents.
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Media types of the supported patch formats.
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+var (
+	// ErrInvalid occurs when a patch is malformed or can't be applied to
+	// the document, such as an operation on a path that does not exist.
+	ErrInvalid = errors.New("invalid patch")
+
+	// ErrTestFailed occurs when a JSON Patch test operation does not hold.
+	ErrTestFailed = errors.New("patch test failed")
+)
+
+// Merge applies a JSON Merge Patch to doc. Members of the patch replace those
+// of the document, objects are merged recursively and null members remove
+// the member from the document.
+func Merge(doc []byte, patch []byte) ([]byte, error) {
+	var d interface{}
+	if err := json.Unmarshal(doc, &d); err != nil {
+		return nil, errors.Wrap(err, "decoding document")
+	}
+
+	var p interface{}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, errors.Wrapf(ErrInvalid, "decoding merge patch: %v", err)
+	}
+
+	return json.Marshal(merge(d, p))
+}
+
+// merge is the MergePatch function of RFC 7396 section 2.
+func merge(target interface{}, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = merge(t[k], v)
+	}
+	return t
+}
+
+// operation is a single JSON Patch operation.
+type operation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Apply applies a JSON Patch to doc. The operations are applied in order and
+// the patch fails as a whole if any one of them does.
+func Apply(doc []byte, patch []byte) ([]byte, error) {
+	var d interface{}
+	if err := json.Unmarshal(doc, &d); err != nil {
+		return nil, errors.Wrap(err, "decoding document")
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(patch))
+	dec.DisallowUnknownFields()
+	var ops []operation
+	if err := dec.Decode(&ops); err != nil {
+		return nil, errors.Wrapf(ErrInvalid, "decoding json patch: %v", err)
+	}
+
+	for i, op := range ops {
+		var err error
+		if d, err = op.apply(d); err != nil {
+			return nil, errors.Wrapf(err, "operation %d", i)
+		}
+	}
+
+	return json.Marshal(d)
+}
+
+// apply performs the operation against the document and returns the result.
+func (o operation) apply(doc interface{}) (interface{}, error) {
+	if o.Path == nil {
+		return nil, errors.Wrapf(ErrInvalid, "%s: missing path", o.Op)
+	}
+	path, err := parsePointer(*o.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch o.Op {
+	case "add", "replace", "test":
+		value, err := o.value()
+		if err != nil {
+			return nil, err
+		}
+		switch o.Op {
+		case "add":
+			return add(doc, path, value)
+		case "replace":
+			return replace(doc, path, value)
+		}
+		cur, err := get(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(cur, value) {
+			return nil, errors.Wrapf(ErrTestFailed, "value at %q", *o.Path)
+		}
+		return doc, nil
+
+	case "remove":
+		doc, _, err := remove(doc, path)
+		return doc, err
+
+	case "move", "copy":
+		if o.From == nil {
+			return nil, errors.Wrapf(ErrInvalid, "%s: missing from", o.Op)
+		}
+		from, err := parsePointer(*o.From)
+		if err != nil {
+			return nil, err
+		}
+
+		if o.Op == "copy" {
+			value, err := get(doc, from)
+			if err != nil {
+				return nil, err
+			}
+			return add(doc, path, deepCopy(value))
+		}
+
+		if *o.From == *o.Path {
+			return doc, nil
+		}
+		if strings.HasPrefix(*o.Path, *o.From+"/") {
+			return nil, errors.Wrapf(ErrInvalid, "move: %q is a child of %q", *o.Path, *o.From)
+		}
+		doc, value, err := remove(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	}
+
+	return nil, errors.Wrapf(ErrInvalid, "unknown op %q", o.Op)
+}
+
+// value decodes the value member of the operation. A null value is kept
+// apart from a missing one by the raw message holding "null".
+func (o operation) value() (interface{}, error) {
+	if len(o.Value) == 0 {
+		return nil, errors.Wrapf(ErrInvalid, "%s: missing value", o.Op)
+	}
+	var v interface{}
+	if err := json.Unmarshal(o.Value, &v); err != nil {
+		return nil, errors.Wrapf(ErrInvalid, "%s: decoding value: %v", o.Op, err)
+	}
+	return v, nil
+}
+
+// =============================================================================
+
+// parsePointer splits a JSON Pointer (RFC 6901) into its reference tokens.
+func parsePointer(s string) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if s[0] != '/' {
+		return nil, errors.Wrapf(ErrInvalid, "pointer %q must start with /", s)
+	}
+
+	tokens := strings.Split(s[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+	}
+	return tokens, nil
+}
+
+// index parses an array index token. The "-" token refers to the position
+// after the last element and is only valid when end is set.
+func index(token string, length int, end bool) (int, error) {
+	if token == "-" && end {
+		return length, nil
+	}
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, errors.Wrapf(ErrInvalid, "invalid array index %q", token)
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 {
+		return 0, errors.Wrapf(ErrInvalid, "invalid array index %q", token)
+	}
+
+	max := length - 1
+	if end {
+		max = length
+	}
+	if i > max {
+		return 0, errors.Wrapf(ErrInvalid, "array index %d out of range", i)
+	}
+	return i, nil
+}
+
+// get returns the value the path refers to.
+func get(doc interface{}, path []string) (interface{}, error) {
+	for _, t := range path {
+		switch n := doc.(type) {
+		case map[string]interface{}:
+			v, ok := n[t]
+			if !ok {
+				return nil, errors.Wrapf(ErrInvalid, "path %q does not exist", t)
+			}
+			doc = v
+		case []interface{}:
+			i, err := index(t, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = n[i]
+		default:
+			return nil, errors.Wrapf(ErrInvalid, "path %q does not exist", t)
+		}
+	}
+	return doc, nil
+}
+
+// update walks to the container holding the last token of the path and
+// replaces it with the result of fn.
+func update(doc interface{}, path []string, fn func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+
+	switch n := doc.(type) {
+	case map[string]interface{}:
+		child, ok := n[path[0]]
+		if !ok {
+			return nil, errors.Wrapf(ErrInvalid, "path %q does not exist", path[0])
+		}
+		child, err := update(child, path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[path[0]] = child
+		return n, nil
+
+	case []interface{}:
+		i, err := index(path[0], len(n), false)
+		if err != nil {
+			return nil, err
+		}
+		child, err := update(n[i], path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = child
+		return n, nil
+	}
+
+	return nil, errors.Wrapf(ErrInvalid, "path %q does not exist", path[0])
+}
+
+// add inserts value at path, replacing an existing object member.
+func add(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return update(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch n := parent.(type) {
+		case map[string]interface{}:
+			n[token] = value
+			return n, nil
+		case []interface{}:
+			i, err := index(token, len(n), true)
+			if err != nil {
+				return nil, err
+			}
+			n = append(n, nil)
+			copy(n[i+1:], n[i:])
+			n[i] = value
+			return n, nil
+		}
+		return nil, errors.Wrapf(ErrInvalid, "path %q does not exist", token)
+	})
+}
+
+// remove deletes the value at path and returns it along with the document.
+func remove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+
+	var removed interface{}
+	doc, err := update(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch n := parent.(type) {
+		case map[string]interface{}:
+			v, ok := n[token]
+			if !ok {
+				return nil, errors.Wrapf(ErrInvalid, "path %q does not exist", token)
+			}
+			removed = v
+			delete(n, token)
+			return n, nil
+		case []interface{}:
+			i, err := index(token, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			removed = n[i]
+			return append(n[:i], n[i+1:]...), nil
+		}
+		return nil, errors.Wrapf(ErrInvalid, "path %q does not exist", token)
+	})
+
+	return doc, removed, err
+}
+
+// replace swaps the existing value at path for value.
+func replace(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	doc, _, err := remove(doc, path)
+	if err != nil {
+		return nil, err
+	}
+	return add(doc, path, value)
+}
+
+// deepCopy copies a decoded JSON value so copies don't share containers.
+func deepCopy(v interface{}) interface{} {
+	switch n := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(n))
+		for k, e := range n {
+			m[k] = deepCopy(e)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(n))
+		for i, e := range n {
+			s[i] = deepCopy(e)
+		}
+		return s
+	}
+	return v
+}
@@ -0,0 +1,127 @@
+package patch_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/nextwavedevs/drop/foundation/patch"
+	"github.com/pkg/errors"
+)
+
+// TestMerge covers the examples of RFC 7396 appendix A along with the
+// decoding failures.
+func TestMerge(t *testing.T) {
+	tt := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+		err   error
+	}{
+		{"replace member", `{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`, nil},
+		{"add member", `{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`, nil},
+		{"null removes member", `{"a":"b"}`, `{"a":null}`, `{}`, nil},
+		{"null keeps others", `{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`, nil},
+		{"null of missing member", `{"a":"b"}`, `{"c":null}`, `{"a":"b"}`, nil},
+		{"array replaces array", `{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`, nil},
+		{"value replaces array", `{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`, nil},
+		{"nested merge", `{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`, nil},
+		{"arrays are not merged", `{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`, nil},
+		{"array document", `["a","b"]`, `["c","d"]`, `["c","d"]`, nil},
+		{"object over array", `{"a":"b"}`, `["c"]`, `["c"]`, nil},
+		{"null patch", `{"a":"foo"}`, `null`, `null`, nil},
+		{"string patch", `{"a":"foo"}`, `"bar"`, `"bar"`, nil},
+		{"null inside new member", `{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`, nil},
+		{"object over scalar", `[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`, nil},
+		{"nested null in new object", `{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`, nil},
+		{"malformed patch", `{}`, `{"a":`, "", patch.ErrInvalid},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := patch.Merge([]byte(tc.doc), []byte(tc.patch))
+			check(t, got, err, tc.want, tc.err)
+		})
+	}
+}
+
+// TestApply covers the operations of RFC 6902 along with the examples of its
+// appendix A.
+func TestApply(t *testing.T) {
+	tt := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+		err   error
+	}{
+		{"add member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`, nil},
+		{"add array element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`, nil},
+		{"add to array end", `{"foo":[1]}`, `[{"op":"add","path":"/foo/-","value":2}]`, `{"foo":[1,2]}`, nil},
+		{"add replaces member", `{"foo":1}`, `[{"op":"add","path":"/foo","value":2}]`, `{"foo":2}`, nil},
+		{"add null value", `{}`, `[{"op":"add","path":"/foo","value":null}]`, `{"foo":null}`, nil},
+		{"add whole document", `{"foo":1}`, `[{"op":"add","path":"","value":[1]}]`, `[1]`, nil},
+		{"add to missing parent", `{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, "", patch.ErrInvalid},
+		{"add past array end", `{"foo":[1]}`, `[{"op":"add","path":"/foo/2","value":2}]`, "", patch.ErrInvalid},
+		{"remove member", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`, nil},
+		{"remove array element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`, nil},
+		{"remove missing member", `{"foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, "", patch.ErrInvalid},
+		{"remove with end index", `{"foo":[1]}`, `[{"op":"remove","path":"/foo/-"}]`, "", patch.ErrInvalid},
+		{"replace member", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`, nil},
+		{"replace missing member", `{"foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, "", patch.ErrInvalid},
+		{"move member", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`, nil},
+		{"move array element", `{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`, nil},
+		{"move to itself", `{"foo":1}`, `[{"op":"move","from":"/foo","path":"/foo"}]`, `{"foo":1}`, nil},
+		{"move into child", `{"foo":{"bar":1}}`, `[{"op":"move","from":"/foo","path":"/foo/bar/baz"}]`, "", patch.ErrInvalid},
+		{"copy member", `{"foo":{"bar":1}}`, `[{"op":"copy","from":"/foo","path":"/baz"}]`, `{"baz":{"bar":1},"foo":{"bar":1}}`, nil},
+		{"copy is deep", `{"foo":{"bar":1}}`, `[{"op":"copy","from":"/foo","path":"/baz"},{"op":"replace","path":"/baz/bar","value":2}]`, `{"baz":{"bar":2},"foo":{"bar":1}}`, nil},
+		{"copy missing from", `{"foo":1}`, `[{"op":"copy","path":"/baz"}]`, "", patch.ErrInvalid},
+		{"test holds", `{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`, `{"baz":"qux","foo":["a",2,"c"]}`, nil},
+		{"test fails", `{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, "", patch.ErrTestFailed},
+		{"test compares numbers by value", `{"foo":1}`, `[{"op":"test","path":"/foo","value":1.0}]`, `{"foo":1}`, nil},
+		{"test null value", `{"foo":null}`, `[{"op":"test","path":"/foo","value":null}]`, `{"foo":null}`, nil},
+		{"test missing value", `{"foo":null}`, `[{"op":"test","path":"/foo"}]`, "", patch.ErrInvalid},
+		{"escaped pointer", `{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10},{"op":"remove","path":"/~1"}]`, `{"~1":10}`, nil},
+		{"leading zero index", `{"foo":[1,2]}`, `[{"op":"remove","path":"/foo/01"}]`, "", patch.ErrInvalid},
+		{"pointer without slash", `{"foo":1}`, `[{"op":"remove","path":"foo"}]`, "", patch.ErrInvalid},
+		{"missing path", `{"foo":1}`, `[{"op":"remove"}]`, "", patch.ErrInvalid},
+		{"unknown op", `{"foo":1}`, `[{"op":"frob","path":"/foo"}]`, "", patch.ErrInvalid},
+		{"unknown member", `{"foo":1}`, `[{"op":"remove","path":"/foo","extra":1}]`, "", patch.ErrInvalid},
+		{"not an array", `{"foo":1}`, `{"op":"remove","path":"/foo"}`, "", patch.ErrInvalid},
+		{"fails as a whole", `{"foo":1}`, `[{"op":"remove","path":"/foo"},{"op":"test","path":"/foo","value":1}]`, "", patch.ErrInvalid},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := patch.Apply([]byte(tc.doc), []byte(tc.patch))
+			check(t, got, err, tc.want, tc.err)
+		})
+	}
+}
+
+// check compares the result of a patch with the expected document or error.
+func check(t *testing.T, got []byte, err error, want string, wantErr error) {
+	t.Helper()
+
+	if wantErr != nil {
+		if errors.Cause(err) != wantErr {
+			t.Fatalf("got error %v, want %v", err, wantErr)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var g, w interface{}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("decoding result %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("decoding want %s: %v", want, err)
+	}
+	if !reflect.DeepEqual(g, w) {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,160 @@
+// Package ratelimit provides token bucket rate limits kept in a pluggable
+// store, so a limit can be held in memory by a single instance or shared by
+// every replica of a service.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit is a token bucket refilled at Rate tokens a second that holds at
+// most Burst tokens. Each request takes one token.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Result reports the outcome of taking a token from a bucket. Reset is the
+// time until the bucket is full again and RetryAfter the time until a token
+// is available when the request was refused.
+type Result struct {
+	Allowed    bool
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Store holds the buckets of a limit. Take must be atomic for a key so a
+// store shared by several replicas never hands out more tokens than the
+// limit allows.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+}
+
+// ParseLimit reads a limit written as count/unit with an optional burst, as
+// in "100/m" or "100/m:20". The unit is s, m or h. Without a burst the
+// bucket holds count tokens.
+func ParseLimit(s string) (Limit, error) {
+	spec, burst := s, ""
+	if i := strings.Index(s, ":"); i >= 0 {
+		spec, burst = s[:i], s[i+1:]
+	}
+
+	parts := strings.SplitN(spec, "/", 2)
+	if len(parts) != 2 {
+		return Limit{}, fmt.Errorf("limit %q is not of the form count/unit", s)
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || count < 1 {
+		return Limit{}, fmt.Errorf("limit %q has an invalid count", s)
+	}
+
+	var per time.Duration
+	switch strings.TrimSpace(parts[1]) {
+	case "s":
+		per = time.Second
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		return Limit{}, fmt.Errorf("limit %q has an invalid unit", s)
+	}
+
+	l := Limit{Rate: float64(count) / per.Seconds(), Burst: count}
+	if burst != "" {
+		if l.Burst, err = strconv.Atoi(strings.TrimSpace(burst)); err != nil || l.Burst < 1 {
+			return Limit{}, fmt.Errorf("limit %q has an invalid burst", s)
+		}
+	}
+	return l, nil
+}
+
+// take applies a request to a bucket holding tokens at last and returns the
+// tokens left along with the result.
+func take(limit Limit, tokens float64, last time.Time, now time.Time) (float64, Result) {
+	if elapsed := now.Sub(last).Seconds(); elapsed > 0 {
+		tokens = math.Min(float64(limit.Burst), tokens+elapsed*limit.Rate)
+	}
+
+	var res Result
+	if tokens >= 1 {
+		tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - tokens) / limit.Rate)
+	}
+	res.Remaining = int(tokens)
+	res.Reset = seconds((float64(limit.Burst) - tokens) / limit.Rate)
+
+	return tokens, res
+}
+
+// seconds converts a count of seconds into a duration.
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// =============================================================================
+
+// bucket is the state of a key in a Memory store.
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time
+}
+
+// Memory is a Store kept in the memory of a single process. Buckets that
+// have filled up again are dropped once the store holds more than its size.
+type Memory struct {
+	mu      sync.Mutex
+	size    int
+	buckets map[string]*bucket
+}
+
+// NewMemory constructs a Memory store that starts dropping idle buckets once
+// it holds size of them.
+func NewMemory(size int) *Memory {
+	return &Memory{
+		size:    size,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Take implements Store.
+func (m *Memory) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, exists := m.buckets[key]
+	if !exists {
+		if len(m.buckets) >= m.size {
+			m.sweep(now)
+		}
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		m.buckets[key] = b
+	}
+
+	var res Result
+	b.tokens, res = take(limit, b.tokens, b.last, now)
+	b.last = now
+	b.full = now.Add(res.Reset)
+
+	return res, nil
+}
+
+// sweep drops the buckets that are full by now, since a new bucket would be
+// the same.
+func (m *Memory) sweep(now time.Time) {
+	for key, b := range m.buckets {
+		if !b.full.After(now) {
+			delete(m.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,486 @@
+// Package rrule implements the subset of RFC 5545 recurrence rules needed to
+// describe recurring events and expand them into concrete occurrences.
+//
+// Supported rule parts are FREQ (DAILY, WEEKLY, MONTHLY, YEARLY), INTERVAL,
+// COUNT, UNTIL, BYDAY (with optional ordinals for MONTHLY and YEARLY rules),
+// BYMONTHDAY, BYMONTH and WKST.
+package rrule
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Set of supported frequencies.
+const (
+	Daily   = "DAILY"
+	Weekly  = "WEEKLY"
+	Monthly = "MONTHLY"
+	Yearly  = "YEARLY"
+)
+
+// maxPeriods bounds how many frequency periods Between will walk so a
+// pathological rule can't spin forever.
+const maxPeriods = 100000
+
+// weekdays maps the RFC 5545 day codes to time.Weekday values.
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// Day is a BYDAY entry. N selects the nth occurrence of the weekday within
+// the month or year, counting from the end when negative. Zero means every
+// occurrence.
+type Day struct {
+	Weekday time.Weekday
+	N       int
+}
+
+// Rule is a parsed recurrence rule.
+type Rule struct {
+	Freq       string
+	Interval   int
+	Count      int
+	Until      time.Time
+	ByDay      []Day
+	ByMonthDay []int
+	ByMonth    []time.Month
+	WeekStart  time.Weekday
+}
+
+// Parse parses the value of an RRULE property, with or without the leading
+// "RRULE:" name.
+func Parse(s string) (Rule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+
+	r := Rule{
+		Interval:  1,
+		WeekStart: time.Monday,
+	}
+
+	for _, part := range strings.Split(s, ";") {
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return Rule{}, errors.Errorf("malformed rule part %q", part)
+		}
+		name, value := strings.ToUpper(kv[0]), strings.ToUpper(kv[1])
+
+		switch name {
+		case "FREQ":
+			switch value {
+			case Daily, Weekly, Monthly, Yearly:
+				r.Freq = value
+			default:
+				return Rule{}, errors.Errorf("unsupported frequency %q", value)
+			}
+
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return Rule{}, errors.Errorf("invalid interval %q", value)
+			}
+			r.Interval = n
+
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return Rule{}, errors.Errorf("invalid count %q", value)
+			}
+			r.Count = n
+
+		case "UNTIL":
+			t, err := parseUntil(value)
+			if err != nil {
+				return Rule{}, err
+			}
+			r.Until = t
+
+		case "BYDAY":
+			for _, v := range strings.Split(value, ",") {
+				d, err := parseDay(v)
+				if err != nil {
+					return Rule{}, err
+				}
+				r.ByDay = append(r.ByDay, d)
+			}
+
+		case "BYMONTHDAY":
+			for _, v := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(v)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return Rule{}, errors.Errorf("invalid month day %q", v)
+				}
+				r.ByMonthDay = append(r.ByMonthDay, n)
+			}
+
+		case "BYMONTH":
+			for _, v := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 1 || n > 12 {
+					return Rule{}, errors.Errorf("invalid month %q", v)
+				}
+				r.ByMonth = append(r.ByMonth, time.Month(n))
+			}
+
+		case "WKST":
+			wd, ok := weekdays[value]
+			if !ok {
+				return Rule{}, errors.Errorf("invalid week start %q", value)
+			}
+			r.WeekStart = wd
+
+		default:
+			return Rule{}, errors.Errorf("unsupported rule part %q", name)
+		}
+	}
+
+	if r.Freq == "" {
+		return Rule{}, errors.New("FREQ is required")
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return Rule{}, errors.New("COUNT and UNTIL are mutually exclusive")
+	}
+	for _, d := range r.ByDay {
+		if d.N != 0 && r.Freq != Monthly && r.Freq != Yearly {
+			return Rule{}, errors.New("BYDAY ordinals are only valid for MONTHLY and YEARLY rules")
+		}
+	}
+
+	return r, nil
+}
+
+// String formats the rule back into its RFC 5545 form.
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	if len(r.ByMonth) > 0 {
+		months := make([]string, len(r.ByMonth))
+		for i, m := range r.ByMonth {
+			months[i] = strconv.Itoa(int(m))
+		}
+		parts = append(parts, "BYMONTH="+strings.Join(months, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, d := range r.ByMonthDay {
+			days[i] = strconv.Itoa(d)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, d := range r.ByDay {
+			days[i] = d.String()
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if r.WeekStart != time.Monday {
+		parts = append(parts, "WKST="+dayCode(r.WeekStart))
+	}
+	return strings.Join(parts, ";")
+}
+
+// String formats the day in its BYDAY form such as MO or -1FR.
+func (d Day) String() string {
+	if d.N == 0 {
+		return dayCode(d.Weekday)
+	}
+	return strconv.Itoa(d.N) + dayCode(d.Weekday)
+}
+
+// Between expands the rule anchored at start and returns every occurrence
+// that falls within [from, to). The wall clock time and location of start are
+// kept for each occurrence, so events stay at the same local time across
+// daylight saving changes. COUNT is applied from start, not from from.
+func (r Rule) Between(start time.Time, from time.Time, to time.Time) []time.Time {
+	var out []time.Time
+	seen := 0
+
+	for period := 0; period < maxPeriods; period++ {
+		candidates := r.period(start, period)
+
+		for _, t := range candidates {
+			if t.Before(start) {
+				continue
+			}
+			if !r.Until.IsZero() && t.After(r.Until) {
+				return out
+			}
+			if !t.Before(to) {
+				return out
+			}
+			seen++
+			if r.Count > 0 && seen > r.Count {
+				return out
+			}
+			if !t.Before(from) {
+				out = append(out, t)
+			}
+		}
+	}
+
+	return out
+}
+
+// period returns the sorted candidate occurrences for the nth period of the
+// rule counted from start.
+func (r Rule) period(start time.Time, n int) []time.Time {
+	loc := start.Location()
+	h, m, s := start.Clock()
+	at := func(y int, mon time.Month, d int) time.Time {
+		return time.Date(y, mon, d, h, m, s, 0, loc)
+	}
+
+	var out []time.Time
+
+	switch r.Freq {
+	case Daily:
+		day := start.AddDate(0, 0, n*r.Interval)
+		t := at(day.Year(), day.Month(), day.Day())
+		if r.matchMonth(t.Month()) && r.matchMonthDay(t) && r.matchWeekday(t.Weekday()) {
+			out = append(out, t)
+		}
+
+	case Weekly:
+		offset := (int(start.Weekday()) - int(r.WeekStart) + 7) % 7
+		weekStart := start.AddDate(0, 0, -offset+n*7*r.Interval)
+		days := r.ByDay
+		if len(days) == 0 {
+			days = []Day{{Weekday: start.Weekday()}}
+		}
+		for _, d := range days {
+			delta := (int(d.Weekday) - int(r.WeekStart) + 7) % 7
+			day := weekStart.AddDate(0, 0, delta)
+			t := at(day.Year(), day.Month(), day.Day())
+			if r.matchMonth(t.Month()) {
+				out = append(out, t)
+			}
+		}
+
+	case Monthly:
+		first := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, loc).AddDate(0, n*r.Interval, 0)
+		if r.matchMonth(first.Month()) {
+			out = r.monthDays(first.Year(), first.Month(), start.Day(), at)
+		}
+
+	case Yearly:
+		year := start.Year() + n*r.Interval
+		months := r.ByMonth
+		if len(months) == 0 {
+			switch {
+			case len(r.ByMonthDay) > 0:
+				for mon := time.January; mon <= time.December; mon++ {
+					months = append(months, mon)
+				}
+			case len(r.ByDay) > 0:
+				out = r.yearDays(year, at)
+			default:
+				months = []time.Month{start.Month()}
+			}
+		}
+		for _, mon := range months {
+			out = append(out, r.monthDays(year, mon, start.Day(), at)...)
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Before(out[j]) })
+	return out
+}
+
+// monthDays returns the days of a month selected by BYMONTHDAY and BYDAY,
+// falling back to the day of month of the start when neither is set.
+func (r Rule) monthDays(year int, month time.Month, startDay int, at func(int, time.Month, int) time.Time) []time.Time {
+	last := daysIn(year, month)
+	var out []time.Time
+
+	switch {
+	case len(r.ByMonthDay) > 0:
+		for _, d := range r.ByMonthDay {
+			if d < 0 {
+				d = last + d + 1
+			}
+			if d < 1 || d > last {
+				continue
+			}
+			t := at(year, month, d)
+			if r.matchWeekday(t.Weekday()) {
+				out = append(out, t)
+			}
+		}
+
+	case len(r.ByDay) > 0:
+		for _, bd := range r.ByDay {
+			var matches []int
+			for d := 1; d <= last; d++ {
+				if time.Date(year, month, d, 0, 0, 0, 0, time.UTC).Weekday() == bd.Weekday {
+					matches = append(matches, d)
+				}
+			}
+			for _, d := range nth(matches, bd.N) {
+				out = append(out, at(year, month, d))
+			}
+		}
+
+	default:
+		// Months without the start's day are skipped, as RFC 5545 requires.
+		if startDay <= last {
+			out = append(out, at(year, month, startDay))
+		}
+	}
+
+	return out
+}
+
+// yearDays returns the days of a year selected by BYDAY, applying ordinals
+// across the whole year as RFC 5545 requires of YEARLY rules without BYMONTH.
+func (r Rule) yearDays(year int, at func(int, time.Month, int) time.Time) []time.Time {
+	last := time.Date(year, time.December, 31, 0, 0, 0, 0, time.UTC).YearDay()
+	var out []time.Time
+
+	for _, bd := range r.ByDay {
+		var matches []int
+		for d := 1; d <= last; d++ {
+			if time.Date(year, time.January, d, 0, 0, 0, 0, time.UTC).Weekday() == bd.Weekday {
+				matches = append(matches, d)
+			}
+		}
+		for _, d := range nth(matches, bd.N) {
+			out = append(out, at(year, time.January, d))
+		}
+	}
+
+	return out
+}
+
+// nth picks the nth of the matching days, counting from the end when n is
+// negative, or all of them when n is zero.
+func nth(matches []int, n int) []int {
+	switch {
+	case n == 0:
+		return matches
+	case n > 0 && n <= len(matches):
+		return matches[n-1 : n]
+	case n < 0 && -n <= len(matches):
+		return matches[len(matches)+n : len(matches)+n+1]
+	}
+	return nil
+}
+
+// matchMonth reports whether the month passes the BYMONTH filter.
+func (r Rule) matchMonth(m time.Month) bool {
+	if len(r.ByMonth) == 0 {
+		return true
+	}
+	for _, bm := range r.ByMonth {
+		if bm == m {
+			return true
+		}
+	}
+	return false
+}
+
+// matchMonthDay reports whether the day passes the BYMONTHDAY filter.
+func (r Rule) matchMonthDay(t time.Time) bool {
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+	last := daysIn(t.Year(), t.Month())
+	for _, d := range r.ByMonthDay {
+		if d < 0 {
+			d = last + d + 1
+		}
+		if d == t.Day() {
+			return true
+		}
+	}
+	return false
+}
+
+// matchWeekday reports whether the weekday passes the BYDAY filter.
+func (r Rule) matchWeekday(wd time.Weekday) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, d := range r.ByDay {
+		if d.Weekday == wd {
+			return true
+		}
+	}
+	return false
+}
+
+// =============================================================================
+
+// parseDay parses a BYDAY entry such as MO, 2TU or -1FR.
+func parseDay(s string) (Day, error) {
+	if len(s) < 2 {
+		return Day{}, errors.Errorf("invalid day %q", s)
+	}
+
+	code := s[len(s)-2:]
+	wd, ok := weekdays[code]
+	if !ok {
+		return Day{}, errors.Errorf("invalid day %q", s)
+	}
+
+	d := Day{Weekday: wd}
+	if prefix := s[:len(s)-2]; prefix != "" {
+		n, err := strconv.Atoi(prefix)
+		if err != nil || n == 0 || n < -53 || n > 53 {
+			return Day{}, errors.Errorf("invalid day ordinal %q", s)
+		}
+		d.N = n
+	}
+
+	return d, nil
+}
+
+// parseUntil parses the UNTIL value in either its date or UTC date-time form.
+func parseUntil(s string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102T150405", "20060102"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			if layout == "20060102" {
+				t = t.Add(24*time.Hour - time.Second)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid until %q", s)
+}
+
+// dayCode returns the RFC 5545 two letter code of a weekday.
+func dayCode(wd time.Weekday) string {
+	for code, d := range weekdays {
+		if d == wd {
+			return code
+		}
+	}
+	return ""
+}
+
+// daysIn returns the number of days in the month.
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
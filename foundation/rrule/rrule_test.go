@@ -0,0 +1,158 @@
+package rrule_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nextwavedevs/drop/foundation/rrule"
+)
+
+// TestParse covers rules that are rejected and the canonical form of the
+// ones that are accepted.
+func TestParse(t *testing.T) {
+	tt := []struct {
+		name string
+		rule string
+		want string
+		err  bool
+	}{
+		{"prefix", "RRULE:FREQ=DAILY", "FREQ=DAILY", false},
+		{"lower case", "freq=weekly;byday=mo,we", "FREQ=WEEKLY;BYDAY=MO,WE", false},
+		{"canonical order", "BYDAY=1MO,-1FR;COUNT=10;INTERVAL=2;FREQ=MONTHLY", "FREQ=MONTHLY;INTERVAL=2;COUNT=10;BYDAY=1MO,-1FR", false},
+		{"interval of one dropped", "FREQ=DAILY;INTERVAL=1", "FREQ=DAILY", false},
+		{"until date", "FREQ=DAILY;UNTIL=19971224", "FREQ=DAILY;UNTIL=19971224T235959Z", false},
+		{"until date time", "FREQ=DAILY;UNTIL=19971224T000000Z", "FREQ=DAILY;UNTIL=19971224T000000Z", false},
+		{"month days", "FREQ=MONTHLY;BYMONTHDAY=1,-1", "FREQ=MONTHLY;BYMONTHDAY=1,-1", false},
+		{"months", "FREQ=YEARLY;BYMONTH=1,12", "FREQ=YEARLY;BYMONTH=1,12", false},
+		{"week start", "FREQ=WEEKLY;WKST=SU", "FREQ=WEEKLY;WKST=SU", false},
+		{"missing freq", "COUNT=3", "", true},
+		{"unsupported freq", "FREQ=HOURLY", "", true},
+		{"count and until", "FREQ=DAILY;COUNT=3;UNTIL=19971224", "", true},
+		{"zero interval", "FREQ=DAILY;INTERVAL=0", "", true},
+		{"zero count", "FREQ=DAILY;COUNT=0", "", true},
+		{"bad until", "FREQ=DAILY;UNTIL=tomorrow", "", true},
+		{"bad day", "FREQ=WEEKLY;BYDAY=XX", "", true},
+		{"zero ordinal", "FREQ=MONTHLY;BYDAY=0MO", "", true},
+		{"ordinal out of range", "FREQ=YEARLY;BYDAY=54MO", "", true},
+		{"ordinal on weekly", "FREQ=WEEKLY;BYDAY=1MO", "", true},
+		{"zero month day", "FREQ=MONTHLY;BYMONTHDAY=0", "", true},
+		{"month day out of range", "FREQ=MONTHLY;BYMONTHDAY=32", "", true},
+		{"month out of range", "FREQ=YEARLY;BYMONTH=13", "", true},
+		{"unsupported part", "FREQ=DAILY;BYHOUR=9", "", true},
+		{"malformed part", "FREQ=DAILY;COUNT", "", true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := rrule.Parse(tc.rule)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("got rule %q, want an error", r)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := r.String(); got != tc.want {
+				t.Fatalf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestBetween expands rules, most of them from the examples of RFC 5545
+// section 3.8.5.3, anchored at 2 September 1997 09:00.
+func TestBetween(t *testing.T) {
+	start := time.Date(1997, time.September, 2, 9, 0, 0, 0, time.UTC)
+	from := start
+	to := start.AddDate(2, 0, 0)
+
+	tt := []struct {
+		name  string
+		rule  string
+		start time.Time
+		from  time.Time
+		to    time.Time
+		want  []string
+	}{
+		{"daily count", "FREQ=DAILY;COUNT=4", start, from, to, []string{"1997-09-02", "1997-09-03", "1997-09-04", "1997-09-05"}},
+		{"daily until is inclusive", "FREQ=DAILY;UNTIL=19970905T090000Z", start, from, to, []string{"1997-09-02", "1997-09-03", "1997-09-04", "1997-09-05"}},
+		{"daily until date", "FREQ=DAILY;UNTIL=19970904", start, from, to, []string{"1997-09-02", "1997-09-03", "1997-09-04"}},
+		{"daily interval", "FREQ=DAILY;INTERVAL=10;COUNT=3", start, from, to, []string{"1997-09-02", "1997-09-12", "1997-09-22"}},
+		{"daily by month", "FREQ=DAILY;BYMONTH=1;COUNT=2", start, from, to, []string{"1998-01-01", "1998-01-02"}},
+		{"weekly count", "FREQ=WEEKLY;COUNT=3", start, from, to, []string{"1997-09-02", "1997-09-09", "1997-09-16"}},
+		{"weekly by day", "FREQ=WEEKLY;COUNT=4;BYDAY=TU,TH", start, from, to, []string{"1997-09-02", "1997-09-04", "1997-09-09", "1997-09-11"}},
+		{"weekly interval by day", "FREQ=WEEKLY;INTERVAL=2;COUNT=4;BYDAY=TU,TH", start, from, to, []string{"1997-09-02", "1997-09-04", "1997-09-16", "1997-09-18"}},
+		{"weekly by day before start", "FREQ=WEEKLY;COUNT=3;BYDAY=MO", start, from, to, []string{"1997-09-08", "1997-09-15", "1997-09-22"}},
+		{"monthly first friday", "FREQ=MONTHLY;COUNT=6;BYDAY=1FR", start, from, to, []string{"1997-09-05", "1997-10-03", "1997-11-07", "1997-12-05", "1998-01-02", "1998-02-06"}},
+		{"monthly last friday", "FREQ=MONTHLY;COUNT=4;BYDAY=-1FR", start, from, to, []string{"1997-09-26", "1997-10-31", "1997-11-28", "1997-12-26"}},
+		{"monthly first and last sunday", "FREQ=MONTHLY;INTERVAL=2;COUNT=6;BYDAY=1SU,-1SU", start, from, to, []string{"1997-09-07", "1997-09-28", "1997-11-02", "1997-11-30", "1998-01-04", "1998-01-25"}},
+		{"monthly second to last monday", "FREQ=MONTHLY;COUNT=3;BYDAY=-2MO", start, from, to, []string{"1997-09-22", "1997-10-20", "1997-11-17"}},
+		{"monthly fifth friday skips months", "FREQ=MONTHLY;COUNT=3;BYDAY=5FR", start, from, to, []string{"1997-10-31", "1998-01-30", "1998-05-29"}},
+		{"monthly third to last day", "FREQ=MONTHLY;COUNT=3;BYMONTHDAY=-3", start, from, to, []string{"1997-09-28", "1997-10-29", "1997-11-28"}},
+		{"monthly first and last day", "FREQ=MONTHLY;COUNT=4;BYMONTHDAY=1,-1", start, from, to, []string{"1997-09-30", "1997-10-01", "1997-10-31", "1997-11-01"}},
+		{"monthly friday the 13th", "FREQ=MONTHLY;COUNT=3;BYDAY=FR;BYMONTHDAY=13", start, from, to, []string{"1998-02-13", "1998-03-13", "1998-11-13"}},
+		{"monthly skips short months", "FREQ=MONTHLY;COUNT=3", time.Date(2021, time.January, 31, 9, 0, 0, 0, time.UTC), time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC), time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC), []string{"2021-01-31", "2021-03-31", "2021-05-31"}},
+		{"yearly by month", "FREQ=YEARLY;COUNT=4;BYMONTH=6,7", time.Date(1997, time.June, 10, 9, 0, 0, 0, time.UTC), time.Date(1997, time.June, 10, 9, 0, 0, 0, time.UTC), to, []string{"1997-06-10", "1997-07-10", "1998-06-10", "1998-07-10"}},
+		{"yearly ordinal in month", "FREQ=YEARLY;COUNT=2;BYMONTH=11;BYDAY=4TH", start, from, to, []string{"1997-11-27", "1998-11-26"}},
+		{"yearly by day over the year", "FREQ=YEARLY;COUNT=6;BYDAY=MO", time.Date(1997, time.January, 6, 9, 0, 0, 0, time.UTC), time.Date(1997, time.January, 1, 0, 0, 0, 0, time.UTC), to, []string{"1997-01-06", "1997-01-13", "1997-01-20", "1997-01-27", "1997-02-03", "1997-02-10"}},
+		{"yearly by day across years", "FREQ=YEARLY;COUNT=3;BYDAY=MO", time.Date(1997, time.December, 22, 9, 0, 0, 0, time.UTC), time.Date(1997, time.January, 1, 0, 0, 0, 0, time.UTC), to, []string{"1997-12-22", "1997-12-29", "1998-01-05"}},
+		{"yearly 20th monday", "FREQ=YEARLY;COUNT=3;BYDAY=20MO", time.Date(1997, time.May, 19, 9, 0, 0, 0, time.UTC), time.Date(1997, time.January, 1, 0, 0, 0, 0, time.UTC), to, []string{"1997-05-19", "1998-05-18", "1999-05-17"}},
+		{"yearly last sunday", "FREQ=YEARLY;COUNT=2;BYDAY=-1SU", time.Date(1997, time.January, 1, 9, 0, 0, 0, time.UTC), time.Date(1997, time.January, 1, 0, 0, 0, 0, time.UTC), to, []string{"1997-12-28", "1998-12-27"}},
+		{"yearly 53rd ordinal skips short years", "FREQ=YEARLY;COUNT=2;BYDAY=53TH", time.Date(1997, time.January, 1, 9, 0, 0, 0, time.UTC), time.Date(1997, time.January, 1, 0, 0, 0, 0, time.UTC), time.Date(2010, time.January, 1, 0, 0, 0, 0, time.UTC), []string{"1998-12-31", "2004-12-30"}},
+		{"yearly by month day in every month", "FREQ=YEARLY;COUNT=3;BYMONTHDAY=1", start, from, to, []string{"1997-10-01", "1997-11-01", "1997-12-01"}},
+		{"yearly leap day", "FREQ=YEARLY;COUNT=2", time.Date(2020, time.February, 29, 9, 0, 0, 0, time.UTC), time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC), time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC), []string{"2020-02-29", "2024-02-29"}},
+		{"count applies from start", "FREQ=DAILY;COUNT=5", start, start.AddDate(0, 0, 3), to, []string{"1997-09-05", "1997-09-06"}},
+		{"to is exclusive", "FREQ=DAILY", start, from, start.AddDate(0, 0, 3), []string{"1997-09-02", "1997-09-03", "1997-09-04"}},
+		{"empty window", "FREQ=DAILY", start, to, to, nil},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := rrule.Parse(tc.rule)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got := r.Between(tc.start, tc.from, tc.to)
+			if len(got) != len(tc.want) {
+				t.Fatalf("got %d occurrences %v, want %v", len(got), got, tc.want)
+			}
+			for i, occ := range got {
+				if d := occ.Format("2006-01-02"); d != tc.want[i] {
+					t.Fatalf("occurrence %d: got %s, want %s", i, d, tc.want[i])
+				}
+				if h, m, _ := occ.Clock(); h != 9 || m != 0 {
+					t.Fatalf("occurrence %d: got %s, want 09:00", i, occ.Format("15:04"))
+				}
+			}
+		})
+	}
+}
+
+// TestBetweenDST checks occurrences keep their wall clock time across a
+// daylight saving change.
+func TestBetweenDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %v", err)
+	}
+
+	r, err := rrule.Parse("FREQ=WEEKLY;COUNT=2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	start := time.Date(2021, time.November, 1, 9, 0, 0, 0, loc)
+	got := r.Between(start, start, start.AddDate(0, 1, 0))
+	if len(got) != 2 {
+		t.Fatalf("got %d occurrences, want 2", len(got))
+	}
+	if h, _, _ := got[1].Clock(); h != 9 {
+		t.Fatalf("got %s, want 09:00 local time", got[1].Format(time.RFC3339))
+	}
+	if d := got[1].Sub(got[0]); d != 7*24*time.Hour+time.Hour {
+		t.Fatalf("got %v between occurrences, want 169h", d)
+	}
+}
@@ -0,0 +1,203 @@
+package web
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Compress compresses responses with gzip or deflate when the client allows
+// it in Accept-Encoding. Bodies shorter than minSize are sent as they are
+// since compressing them saves little, as are bodies that already have a
+// Content-Encoding or are images. It should be the first middleware so
+// every response, errors included, passes through it.
+func Compress(minSize int) Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler Handler) Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			coding := contentCoding(r.Header.Get("Accept-Encoding"))
+			if coding == "" || r.Method == http.MethodHead {
+				return handler(ctx, w, r)
+			}
+
+			// Tags the client holds for the compressed response are compared
+			// with the uncompressed one's.
+			held := unvaryTags(r.Header, "If-None-Match", coding)
+
+			cw := compressWriter{
+				ResponseWriter: w,
+				coding:         coding,
+				minSize:        minSize,
+				held:           held,
+			}
+			err := handler(ctx, &cw, r)
+			if cerr := cw.close(); err == nil {
+				err = cerr
+			}
+
+			return err
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// contentCoding picks gzip or deflate from an Accept-Encoding header,
+// preferring gzip, or returns an empty string when neither is acceptable.
+func contentCoding(header string) string {
+	if header == "" {
+		return ""
+	}
+
+	best, bestQ := "", 0.0
+	for _, coding := range []string{"gzip", "deflate"} {
+		if q := codingQuality(header, coding); q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+// codingQuality returns the weight an Accept-Encoding header gives a coding,
+// falling back to the weight of *.
+func codingQuality(header string, coding string) float64 {
+	q, found := 0.0, false
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if name != coding && (name != "*" || found) {
+			continue
+		}
+
+		w := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if f, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					w = f
+				}
+			}
+		}
+
+		q = w
+		if name == coding {
+			found = true
+		}
+	}
+	return q
+}
+
+// compressWriter holds back the start of a response until it knows whether
+// the body is long enough to compress.
+type compressWriter struct {
+	http.ResponseWriter
+	coding  string
+	minSize int
+	held    bool
+	status  int
+	buf     []byte
+	started bool
+	w       io.WriteCloser
+}
+
+// WriteHeader implements http.ResponseWriter. The status is sent with the
+// first part of the body.
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.status != 0 {
+		return
+	}
+	cw.status = status
+
+	// Responses without a body are sent right away. A 304 for a compressed
+	// response the client holds names the tag it was sent with.
+	if status == http.StatusNotModified && cw.held {
+		varyTag(cw.Header(), cw.coding)
+	}
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		cw.start(false)
+	}
+}
+
+// Write implements http.ResponseWriter.
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.started {
+		if cw.w != nil {
+			return cw.w.Write(b)
+		}
+		return cw.ResponseWriter.Write(b)
+	}
+
+	cw.buf = append(cw.buf, b...)
+	if len(cw.buf) < cw.minSize {
+		return len(b), nil
+	}
+
+	if err := cw.start(cw.compressible()); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// compressible reports whether the response is worth compressing.
+func (cw *compressWriter) compressible() bool {
+	h := cw.Header()
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	return !strings.HasPrefix(h.Get("Content-Type"), "image/")
+}
+
+// start sends the status and anything held back, compressed or not.
+func (cw *compressWriter) start(compress bool) error {
+	cw.started = true
+
+	if compress {
+		h := cw.Header()
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.coding)
+		varyTag(h, cw.coding)
+
+		switch cw.coding {
+		case "gzip":
+			cw.w = gzip.NewWriter(cw.ResponseWriter)
+		default:
+			cw.w, _ = flate.NewWriter(cw.ResponseWriter, flate.DefaultCompression)
+		}
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := cw.Write(buf)
+	return err
+}
+
+// close sends a response that was too short to compress and finishes a
+// compressed one.
+func (cw *compressWriter) close() error {
+	switch {
+	case cw.w != nil:
+		return cw.w.Close()
+	case !cw.started && cw.status != 0:
+		return cw.start(false)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package web
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// conditional handles GET and HEAD requests to a route with a cache policy.
+// The response is held back until the handler returns so a successful one
+// can be given the route's Cache-Control and an ETag computed from its body
+// when the handler didn't set one. Clients already holding the response,
+// according to If-None-Match or else If-Modified-Since, get 304 instead.
+func conditional(rt *Route) Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler Handler) Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			if rt.CacheControl == "" || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+				return handler(ctx, w, r)
+			}
+
+			cw := conditionalWriter{ResponseWriter: w}
+			if err := handler(ctx, &cw, r); err != nil {
+				if cw.status != 0 {
+					cw.flush()
+				}
+				return err
+			}
+
+			if cw.status == 0 {
+				cw.status = http.StatusOK
+			}
+			if cw.status != http.StatusOK {
+				return cw.flush()
+			}
+
+			hdr := w.Header()
+			if hdr.Get("Cache-Control") == "" {
+				hdr.Set("Cache-Control", rt.CacheControl)
+			}
+			if hdr.Get("ETag") == "" {
+				sum := sha256.Sum256(cw.body)
+				hdr.Set("ETag", strconv.Quote(hex.EncodeToString(sum[:16])))
+			}
+
+			if notModified(r, hdr) {
+				hdr.Del("Content-Type")
+				hdr.Del("Content-Length")
+				if v, ok := ctx.Value(KeyValues).(*Values); ok {
+					v.StatusCode = http.StatusNotModified
+				}
+				cw.status, cw.body = http.StatusNotModified, nil
+			}
+
+			return cw.flush()
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// notModified reports whether the client already holds the response with
+// the headers h.
+func notModified(r *http.Request, h http.Header) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		etag := strings.TrimPrefix(h.Get("ETag"), "W/")
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lm, err := http.ParseTime(h.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !lm.After(ims)
+}
+
+// conditionalWriter holds back a response until it is known whether the
+// client needs it.
+type conditionalWriter struct {
+	http.ResponseWriter
+	status int
+	body   []byte
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (cw *conditionalWriter) WriteHeader(status int) {
+	if cw.status == 0 {
+		cw.status = status
+	}
+}
+
+// Write implements http.ResponseWriter.
+func (cw *conditionalWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	cw.body = append(cw.body, b...)
+	return len(b), nil
+}
+
+// flush sends the response held back.
+func (cw *conditionalWriter) flush() error {
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if len(cw.body) == 0 {
+		return nil
+	}
+	_, err := cw.ResponseWriter.Write(cw.body)
+	return err
+}
@@ -0,0 +1,33 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"html/template"
+	"net/http"
+)
+
+// docsPage renders an OpenAPI document fetched from the browser.
+//
+//go:embed docs.html
+var docsPage string
+
+var docsTemplate = template.Must(template.New("docs").Parse(docsPage))
+
+// DocsPage returns a handler serving a page that browses the OpenAPI
+// document found at specURL.
+func DocsPage(title string, specURL string) Handler {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		var b bytes.Buffer
+		data := struct {
+			Title   string
+			SpecURL string
+		}{title, specURL}
+		if err := docsTemplate.Execute(&b, data); err != nil {
+			return err
+		}
+
+		return RespondRaw(ctx, w, b.Bytes(), "text/html; charset=utf-8", http.StatusOK)
+	}
+}
@@ -0,0 +1,299 @@
+package web
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Encoder marshals a response value into the body of a media type.
+type Encoder func(v interface{}) ([]byte, error)
+
+// encoders is the registry of media types Respond can produce, in the order
+// they are preferred when the client values them equally.
+var encoders = struct {
+	sync.RWMutex
+	types []string
+	enc   map[string]Encoder
+}{
+	enc: make(map[string]Encoder),
+}
+
+func init() {
+	RegisterEncoder("application/json", json.Marshal)
+	RegisterEncoder("application/msgpack", MarshalMsgPack)
+	RegisterEncoder("application/cbor", MarshalCBOR)
+}
+
+// RegisterEncoder adds the encoder Respond uses for a media type, replacing
+// any registered before. The first media type registered is the default.
+func RegisterEncoder(contentType string, enc Encoder) {
+	encoders.Lock()
+	defer encoders.Unlock()
+
+	if _, exists := encoders.enc[contentType]; !exists {
+		encoders.types = append(encoders.types, contentType)
+	}
+	encoders.enc[contentType] = enc
+}
+
+// Encodings returns the media types Respond can produce, default first.
+func Encodings() []string {
+	encoders.RLock()
+	defer encoders.RUnlock()
+
+	return append([]string(nil), encoders.types...)
+}
+
+// defaultEncoding returns the media type Respond uses when the client has no
+// preference.
+func defaultEncoding() string {
+	encoders.RLock()
+	defer encoders.RUnlock()
+
+	if len(encoders.types) == 0 {
+		return ""
+	}
+	return encoders.types[0]
+}
+
+// encoder picks the registered encoder the client prefers according to its
+// Accept header.
+func encoder(accept string) (string, Encoder) {
+	encoders.RLock()
+	defer encoders.RUnlock()
+
+	contentType := negotiate(accept, encoders.types)
+	return contentType, encoders.enc[contentType]
+}
+
+// =============================================================================
+
+// MarshalMsgPack encodes v as MessagePack. The value is laid out the way
+// encoding/json would, so json tags and Marshalers are honoured.
+func MarshalMsgPack(v interface{}) ([]byte, error) {
+	tree, err := jsonTree(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	msgpack(&buf, tree)
+	return buf.Bytes(), nil
+}
+
+// MarshalCBOR encodes v as CBOR. The value is laid out the way encoding/json
+// would, so json tags and Marshalers are honoured.
+func MarshalCBOR(v interface{}) ([]byte, error) {
+	tree, err := jsonTree(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	cbor(&buf, tree)
+	return buf.Bytes(), nil
+}
+
+// jsonTree converts v into the generic values encoding/json decodes it as,
+// keeping numbers exact.
+func jsonTree(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var tree interface{}
+	if err := dec.Decode(&tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// sortedKeys returns the keys of an object in order so encodings are
+// deterministic.
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// msgpack writes a generic value in MessagePack.
+func msgpack(buf *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+
+	case bool:
+		if v {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+
+	case json.Number:
+		if n, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			msgpackInt(buf, n)
+			return
+		}
+		f, _ := v.Float64()
+		buf.WriteByte(0xcb)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+
+	case string:
+		msgpackHead(buf, len(v), 0xa0, 32, 0xd9, 0xda, 0xdb)
+		buf.WriteString(v)
+
+	case []interface{}:
+		msgpackHead(buf, len(v), 0x90, 16, 0, 0xdc, 0xdd)
+		for _, e := range v {
+			msgpack(buf, e)
+		}
+
+	case map[string]interface{}:
+		msgpackHead(buf, len(v), 0x80, 16, 0, 0xde, 0xdf)
+		for _, k := range sortedKeys(v) {
+			msgpack(buf, k)
+			msgpack(buf, v[k])
+		}
+	}
+}
+
+// msgpackHead writes the type and length of a string, array or map using
+// the fix form below fixMax and the 8, 16 or 32 bit form above it. A zero
+// code8 means the type has no 8 bit form.
+func msgpackHead(buf *bytes.Buffer, n int, fix byte, fixMax int, code8 byte, code16 byte, code32 byte) {
+	switch {
+	case n < fixMax:
+		buf.WriteByte(fix | byte(n))
+	case code8 != 0 && n <= math.MaxUint8:
+		buf.WriteByte(code8)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(code16)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(code32)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+}
+
+// msgpackInt writes an integer in the smallest MessagePack form.
+func msgpackInt(buf *bytes.Buffer, n int64) {
+	switch {
+	case n >= 0 && n <= math.MaxInt8:
+		buf.WriteByte(byte(n))
+	case n < 0 && n >= -32:
+		buf.WriteByte(byte(int8(n)))
+	case n >= 0 && n <= math.MaxUint8:
+		buf.WriteByte(0xcc)
+		buf.WriteByte(byte(n))
+	case n >= 0 && n <= math.MaxUint16:
+		buf.WriteByte(0xcd)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	case n >= 0 && n <= math.MaxUint32:
+		buf.WriteByte(0xce)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	case n >= 0:
+		buf.WriteByte(0xcf)
+		binary.Write(buf, binary.BigEndian, uint64(n))
+	case n >= math.MinInt8:
+		buf.WriteByte(0xd0)
+		buf.WriteByte(byte(int8(n)))
+	case n >= math.MinInt16:
+		buf.WriteByte(0xd1)
+		binary.Write(buf, binary.BigEndian, int16(n))
+	case n >= math.MinInt32:
+		buf.WriteByte(0xd2)
+		binary.Write(buf, binary.BigEndian, int32(n))
+	default:
+		buf.WriteByte(0xd3)
+		binary.Write(buf, binary.BigEndian, n)
+	}
+}
+
+// CBOR major types.
+const (
+	cborUint   = 0
+	cborNegInt = 1
+	cborText   = 3
+	cborArray  = 4
+	cborMap    = 5
+)
+
+// cbor writes a generic value in CBOR.
+func cbor(buf *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(0xf6)
+
+	case bool:
+		if v {
+			buf.WriteByte(0xf5)
+		} else {
+			buf.WriteByte(0xf4)
+		}
+
+	case json.Number:
+		if n, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			if n >= 0 {
+				cborHead(buf, cborUint, uint64(n))
+			} else {
+				cborHead(buf, cborNegInt, uint64(-1-n))
+			}
+			return
+		}
+		f, _ := v.Float64()
+		buf.WriteByte(0xfb)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+
+	case string:
+		cborHead(buf, cborText, uint64(len(v)))
+		buf.WriteString(v)
+
+	case []interface{}:
+		cborHead(buf, cborArray, uint64(len(v)))
+		for _, e := range v {
+			cbor(buf, e)
+		}
+
+	case map[string]interface{}:
+		cborHead(buf, cborMap, uint64(len(v)))
+		for _, k := range sortedKeys(v) {
+			cbor(buf, k)
+			cbor(buf, v[k])
+		}
+	}
+}
+
+// cborHead writes the major type and argument of a CBOR item in the
+// shortest form.
+func cborHead(buf *bytes.Buffer, major byte, n uint64) {
+	major <<= 5
+	switch {
+	case n < 24:
+		buf.WriteByte(major | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(major | 24)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(major | 25)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	case n <= math.MaxUint32:
+		buf.WriteByte(major | 26)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	default:
+		buf.WriteByte(major | 27)
+		binary.Write(buf, binary.BigEndian, n)
+	}
+}
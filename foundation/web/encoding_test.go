@@ -0,0 +1,131 @@
+package web_test
+
+import (
+	"encoding/hex"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/nextwavedevs/drop/foundation/web"
+)
+
+// TestMarshal checks the MessagePack and CBOR encodings against the byte
+// layouts of their specifications, picking the smallest form at each boundary.
+func TestMarshal(t *testing.T) {
+	type tagged struct {
+		Name    string `json:"name"`
+		Skipped string `json:"-"`
+		Empty   string `json:"empty,omitempty"`
+		Count   int    `json:"count"`
+	}
+
+	tt := []struct {
+		name    string
+		v       interface{}
+		msgpack string
+		cbor    string
+	}{
+		{"null", nil, "c0", "f6"},
+		{"false", false, "c2", "f4"},
+		{"true", true, "c3", "f5"},
+		{"zero", 0, "00", "00"},
+		{"largest fixint", 127, "7f", "187f"},
+		{"largest cbor tiny int", 23, "17", "17"},
+		{"smallest cbor uint8", 24, "18", "1818"},
+		{"uint8", 128, "cc80", "1880"},
+		{"uint16", 256, "cd0100", "190100"},
+		{"uint32", 65536, "ce00010000", "1a00010000"},
+		{"uint64", int64(math.MaxUint32) + 1, "cf0000000100000000", "1b0000000100000000"},
+		{"minus one", -1, "ff", "20"},
+		{"smallest negative fixint", -32, "e0", "381f"},
+		{"int8", -33, "d0df", "3820"},
+		{"int16", -129, "d1ff7f", "3880"},
+		{"int32", -32769, "d2ffff7fff", "398000"},
+		{"int64", int64(math.MinInt32) - 1, "d3ffffffff7fffffff", "3a80000000"},
+		{"float", 1.5, "cb3ff8000000000000", "fb3ff8000000000000"},
+		{"empty string", "", "a0", "60"},
+		{"fixstr", "a", "a161", "6161"},
+		{"str8", strings.Repeat("a", 32), "d920" + strings.Repeat("61", 32), "7820" + strings.Repeat("61", 32)},
+		{"str16", strings.Repeat("a", 256), "da0100" + strings.Repeat("61", 256), "790100" + strings.Repeat("61", 256)},
+		{"utf-8 length in bytes", "é", "a2c3a9", "62c3a9"},
+		{"empty array", []int{}, "90", "80"},
+		{"fixarray", []int{1, 2, 3}, "93010203", "83010203"},
+		{"array16", make([]bool, 16), "dc0010" + strings.Repeat("c2", 16), "90" + strings.Repeat("f4", 16)},
+		{"nil slice", []int(nil), "c0", "f6"},
+		{"empty map", map[string]int{}, "80", "a0"},
+		{"map keys sorted", map[string]int{"b": 2, "a": 1}, "82a16101a16202", "a2616101616202"},
+		{"map16", sixteenKeys(), "de0010" + sixteenKeysHex(), "b0" + sixteenKeysCBOR()},
+		{"json tags", tagged{Name: "x", Skipped: "y", Count: 1}, "82a5636f756e7401a46e616d65a178", "a265636f756e7401646e616d656178"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := web.MarshalMsgPack(tc.v)
+			if err != nil {
+				t.Fatalf("msgpack: unexpected error: %v", err)
+			}
+			if h := hex.EncodeToString(got); h != tc.msgpack {
+				t.Errorf("msgpack: got %s, want %s", h, tc.msgpack)
+			}
+
+			got, err = web.MarshalCBOR(tc.v)
+			if err != nil {
+				t.Fatalf("cbor: unexpected error: %v", err)
+			}
+			if h := hex.EncodeToString(got); h != tc.cbor {
+				t.Errorf("cbor: got %s, want %s", h, tc.cbor)
+			}
+		})
+	}
+}
+
+// TestMarshalError checks values encoding/json refuses are refused too.
+func TestMarshalError(t *testing.T) {
+	tt := []struct {
+		name string
+		v    interface{}
+	}{
+		{"channel", make(chan int)},
+		{"function", func() {}},
+		{"NaN", math.NaN()},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := web.MarshalMsgPack(tc.v); err == nil {
+				t.Errorf("msgpack: want an error")
+			}
+			if _, err := web.MarshalCBOR(tc.v); err == nil {
+				t.Errorf("cbor: want an error")
+			}
+		})
+	}
+}
+
+// sixteenKeys returns a map with the keys "a" to "p", one more than fits in
+// a fixmap, each holding zero.
+func sixteenKeys() map[string]int {
+	m := make(map[string]int)
+	for c := 'a'; c < 'a'+16; c++ {
+		m[string(c)] = 0
+	}
+	return m
+}
+
+// sixteenKeysHex returns the MessagePack entries of sixteenKeys.
+func sixteenKeysHex() string {
+	var b strings.Builder
+	for c := 'a'; c < 'a'+16; c++ {
+		b.WriteString("a1" + hex.EncodeToString([]byte{byte(c)}) + "00")
+	}
+	return b.String()
+}
+
+// sixteenKeysCBOR returns the CBOR entries of sixteenKeys.
+func sixteenKeysCBOR() string {
+	var b strings.Builder
+	for c := 'a'; c < 'a'+16; c++ {
+		b.WriteString("61" + hex.EncodeToString([]byte{byte(c)}) + "00")
+	}
+	return b.String()
+}
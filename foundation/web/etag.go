@@ -0,0 +1,68 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+)
+
+// tagSeparator starts the suffix naming the representation an entity tag
+// belongs to. Handlers must not use it in the tags they set.
+const tagSeparator = "~"
+
+// varyTag gives the strong ETag in h a suffix naming a representation of the
+// resource, such as a media type or content coding, so every representation
+// has its own tag. Weak tags are left as they are.
+func varyTag(h http.Header, variant string) {
+	tag := h.Get("ETag")
+	if len(tag) < 2 || strings.HasPrefix(tag, "W/") || !strings.HasSuffix(tag, `"`) {
+		return
+	}
+	h.Set("ETag", tag[:len(tag)-1]+tagSeparator+variant+`"`)
+}
+
+// BaseTag removes the representation suffixes from an entity tag, returning
+// the tag the handler set. Handlers use it to read the tags clients send in
+// If-Match.
+func BaseTag(tag string) string {
+	i := strings.Index(tag, tagSeparator)
+	if i < 0 || !strings.HasSuffix(tag, `"`) {
+		return tag
+	}
+	return tag[:i] + `"`
+}
+
+// unvaryTags removes the suffix for variant from the tags in the named
+// request header, so inner handlers compare them with the tags they produce
+// before the representation is changed. It reports whether any tag had it.
+func unvaryTags(h http.Header, name string, variant string) bool {
+	v := h.Get(name)
+	if v == "" {
+		return false
+	}
+
+	var found bool
+	suffix := tagSeparator + variant + `"`
+	tags := strings.Split(v, ",")
+	for i, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if strings.HasSuffix(tag, suffix) {
+			tag = tag[:len(tag)-len(suffix)] + `"`
+			found = true
+		}
+		tags[i] = tag
+	}
+	h.Set(name, strings.Join(tags, ", "))
+
+	return found
+}
+
+// mediaVariant names a media type in an entity tag suffix.
+func mediaVariant(contentType string) string {
+	if i := strings.Index(contentType, "/"); i >= 0 {
+		contentType = contentType[i+1:]
+	}
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+	return strings.TrimSpace(contentType)
+}
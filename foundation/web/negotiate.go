@@ -0,0 +1,72 @@
+package web
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Negotiate picks the media type from offers the client prefers according
+// to its Accept header. Offers the client values equally are chosen in the
+// order given, so the first offer is the default. The first offer is also
+// returned when the client accepts none of them.
+func Negotiate(r *http.Request, offers ...string) string {
+	return negotiate(r.Header.Get("Accept"), offers)
+}
+
+// negotiate picks the offer an Accept header prefers.
+func negotiate(accept string, offers []string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+
+	if accept == "" {
+		return offers[0]
+	}
+
+	best, bestQ := offers[0], 0.0
+	for _, offer := range offers {
+		if q := quality(accept, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// quality returns the weight an Accept header gives a media type, taken from
+// the most specific range matching it.
+func quality(accept string, mediaType string) float64 {
+	typ := strings.SplitN(mediaType, "/", 2)[0]
+
+	q, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		rng, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		var s int
+		switch {
+		case rng == mediaType:
+			s = 2
+		case rng == typ+"/*":
+			s = 1
+		case rng == "*/*":
+			s = 0
+		default:
+			continue
+		}
+		if s <= specificity {
+			continue
+		}
+
+		specificity, q = s, 1
+		if v, ok := params["q"]; ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+	}
+	return q
+}
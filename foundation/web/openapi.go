@@ -0,0 +1,381 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIInfo describes the API as a whole in its OpenAPI document.
+type APIInfo struct {
+	Title       string
+	Version     string
+	Description string
+
+	// Errors holds a value of the body sent with failed requests for each
+	// media type errors are sent as.
+	Errors map[string]interface{}
+}
+
+// Document is an OpenAPI 3 document ready to be rendered as JSON.
+type Document map[string]interface{}
+
+// OpenAPI builds an OpenAPI 3 document from the routes registered with the
+// app. Debug routes and CORS preflight routes are left out. Schemas are
+// derived from the json and validate tags of the documented types.
+func (a *App) OpenAPI(info APIInfo) Document {
+	sc := schemas{defs: make(map[string]interface{})}
+
+	errContent := make(map[string]interface{})
+	for mediaType, v := range info.Errors {
+		errContent[mediaType] = map[string]interface{}{"schema": sc.of(reflect.TypeOf(v))}
+	}
+
+	paths := make(map[string]map[string]interface{})
+	for _, rt := range a.routes {
+		if rt.Debug || rt.Method == http.MethodOptions {
+			continue
+		}
+
+		path, params := openPath(rt.Path)
+		for _, p := range rt.Params {
+			params = append(params, map[string]interface{}{
+				"name":        p.Name,
+				"in":          "query",
+				"description": p.Description,
+				"schema":      map[string]interface{}{"type": "string"},
+			})
+		}
+
+		op := map[string]interface{}{
+			"operationId": rt.Name,
+			"responses":   sc.responses(rt, errContent),
+		}
+		if rt.Summary != "" {
+			op["summary"] = rt.Summary
+		}
+		if len(rt.Tags) > 0 {
+			op["tags"] = rt.Tags
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+		if rt.Request != nil {
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  sc.content(rt.Request),
+			}
+		}
+		switch rt.Auth {
+		case AuthRequired:
+			op["security"] = []interface{}{map[string]interface{}{"bearerAuth": []string{}}}
+		case AuthOptional:
+			op["security"] = []interface{}{map[string]interface{}{}, map[string]interface{}{"bearerAuth": []string{}}}
+		}
+		if len(rt.Roles) > 0 {
+			op["description"] = "Requires one of the roles: " + strings.Join(rt.Roles, ", ") + "."
+		}
+
+		if paths[path] == nil {
+			paths[path] = make(map[string]interface{})
+		}
+		paths[path][strings.ToLower(rt.Method)] = op
+	}
+
+	return Document{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       info.Title,
+			"version":     info.Version,
+			"description": info.Description,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": sc.defs,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+				},
+			},
+		},
+	}
+}
+
+// openPath turns a router path such as /v1/users/:id into the OpenAPI form
+// /v1/users/{id} along with its path parameters.
+func openPath(path string) (string, []interface{}) {
+	var params []interface{}
+
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if part == "" || (part[0] != ':' && part[0] != '*') {
+			continue
+		}
+		name := part[1:]
+		if name == "" {
+			name = "path"
+		}
+		parts[i] = "{" + name + "}"
+		params = append(params, map[string]interface{}{
+			"name":     name,
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]interface{}{"type": "string"},
+		})
+	}
+
+	return strings.Join(parts, "/"), params
+}
+
+// =============================================================================
+
+// schemas collects the named types of a document as components.
+type schemas struct {
+	defs map[string]interface{}
+}
+
+// responses renders the documented responses of a route. Routes that
+// document none are assumed to answer 200 with a body of unknown form.
+func (sc schemas) responses(rt *Route, errContent map[string]interface{}) map[string]interface{} {
+	res := make(map[string]interface{})
+	for status, b := range rt.Responses {
+		r := map[string]interface{}{"description": http.StatusText(status)}
+		switch {
+		case b == nil:
+			r["content"] = errContent
+		case len(b.ContentTypes) > 0:
+			r["content"] = sc.content(b)
+		}
+		res[strconv.Itoa(status)] = r
+	}
+
+	ok := false
+	for status := range rt.Responses {
+		if status < 400 {
+			ok = true
+		}
+	}
+	if !ok {
+		res["200"] = map[string]interface{}{"description": http.StatusText(http.StatusOK)}
+	}
+
+	res["default"] = map[string]interface{}{
+		"description": "Error",
+		"content":     errContent,
+	}
+	return res
+}
+
+// content renders the media types of a body.
+func (sc schemas) content(b *Body) map[string]interface{} {
+	schema := map[string]interface{}{"type": "string", "format": "binary"}
+	if b.Type != nil {
+		schema = sc.of(b.Type)
+	}
+
+	content := make(map[string]interface{})
+	for _, ct := range b.ContentTypes {
+		content[ct] = map[string]interface{}{"schema": schema}
+	}
+	return content
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// of returns the schema of a type. Named structs are added to the components
+// and referenced.
+func (sc schemas) of(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case rawMessageType:
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": sc.of(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": sc.of(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return sc.object(t)
+		}
+		name := strings.ReplaceAll(t.String(), "*", "")
+		if _, exists := sc.defs[name]; !exists {
+
+			// Hold the name while the fields are walked so types that refer
+			// to themselves end in a reference.
+			sc.defs[name] = map[string]interface{}{}
+			sc.defs[name] = sc.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+
+	return map[string]interface{}{}
+}
+
+// object renders the schema of a struct from the json and validate tags of
+// its fields. Embedded structs without a name of their own are flattened.
+func (sc schemas) object(t reflect.Type) map[string]interface{} {
+	props := make(map[string]interface{})
+	var required []string
+
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if tag == "-" || (f.PkgPath != "" && !f.Anonymous) {
+				continue
+			}
+
+			name := strings.SplitN(tag, ",", 2)[0]
+			if f.Anonymous && name == "" {
+				ft := f.Type
+				if ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				if ft.Kind() == reflect.Struct {
+					walk(ft)
+					continue
+				}
+			}
+			if f.PkgPath != "" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+
+			schema := sc.of(f.Type)
+			rules := f.Tag.Get("validate")
+			constrain(schema, rules)
+			props[name] = schema
+
+			for _, rule := range strings.Split(rules, ",") {
+				if rule == "dive" {
+					break
+				}
+				if rule == "required" {
+					required = append(required, name)
+				}
+			}
+		}
+	}
+	walk(t)
+
+	obj := map[string]interface{}{"type": "object", "properties": props}
+	if len(required) > 0 {
+		sort.Strings(required)
+		obj["required"] = required
+	}
+	return obj
+}
+
+// constrain adds the rules of a validate tag that OpenAPI can express to a
+// schema. Rules after dive apply to the items of an array.
+func constrain(schema map[string]interface{}, rules string) {
+	if rules == "" {
+		return
+	}
+	if _, ref := schema["$ref"]; ref {
+		return
+	}
+
+	list := strings.Split(rules, ",")
+	for i, rule := range list {
+		if rule == "dive" {
+			if items, ok := schema["items"].(map[string]interface{}); ok {
+				constrain(items, strings.Join(list[i+1:], ","))
+			}
+			return
+		}
+
+		if strings.Contains(rule, "|") {
+			continue
+		}
+		key, param := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			key, param = rule[:i], rule[i+1:]
+		}
+
+		switch key {
+		case "email":
+			schema["format"] = "email"
+		case "url", "uri", "clearable_url":
+			schema["format"] = "uri"
+		case "uuid", "uuid4":
+			schema["format"] = "uuid"
+		case "iso3166":
+			schema["pattern"] = "^[A-Z]{2}$"
+		case "oneof":
+			schema["enum"] = strings.Fields(param)
+		case "min", "max", "len", "gte", "lte", "gt", "lt":
+			bound(schema, key, param)
+		}
+	}
+}
+
+// bound adds a size rule to a schema, reading it as a length, a count of
+// items or a value depending on the type of the schema.
+func bound(schema map[string]interface{}, key string, param string) {
+	n, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return
+	}
+
+	var lower, upper string
+	switch schema["type"] {
+	case "string":
+		lower, upper = "minLength", "maxLength"
+	case "array":
+		lower, upper = "minItems", "maxItems"
+	case "integer", "number":
+		lower, upper = "minimum", "maximum"
+	default:
+		return
+	}
+
+	switch key {
+	case "min", "gte":
+		schema[lower] = n
+	case "max", "lte":
+		schema[upper] = n
+	case "len":
+		schema[lower], schema[upper] = n, n
+	case "gt":
+		if lower == "minimum" {
+			schema[lower], schema["exclusiveMinimum"] = n, true
+		}
+	case "lt":
+		if upper == "maximum" {
+			schema[upper], schema["exclusiveMaximum"] = n, true
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package web
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ParseProxies parses the addresses and CIDR ranges of trusted proxies.
+func ParseProxies(specs []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		if !strings.Contains(spec, "/") {
+			ip := net.ParseIP(spec)
+			if ip == nil {
+				return nil, errors.Errorf("invalid proxy address %q", spec)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(spec)
+		if err != nil {
+			return nil, errors.Errorf("invalid proxy range %q", spec)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// TrustProxies sets the proxies, such as load balancers, whose
+// X-Forwarded-For header is believed when working out the address of the
+// client. Without any the client is the peer of the connection.
+func (a *App) TrustProxies(nets []*net.IPNet) {
+	a.proxies = nets
+}
+
+// clientIP returns the address of the client that made the request. Entries
+// of X-Forwarded-For are walked from the right, the closest hop first, for
+// as long as they are trusted proxies; the first one that isn't is the
+// client. Entries further left are set by the client and can't be believed.
+func (a *App) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if len(a.proxies) == 0 || !a.trusted(host) {
+		return host
+	}
+
+	var hops []string
+	for _, h := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(h, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		host = hop
+		if !a.trusted(hop) {
+			break
+		}
+	}
+	return host
+}
+
+// trusted reports whether the address belongs to a trusted proxy.
+func (a *App) trusted(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range a.proxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package web_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/nextwavedevs/drop/foundation/logger"
+	"github.com/nextwavedevs/drop/foundation/web"
+)
+
+// TestClientIP checks X-Forwarded-For is only believed from trusted proxies.
+func TestClientIP(t *testing.T) {
+	proxies, err := web.ParseProxies([]string{"10.0.0.0/8", "192.0.2.1"})
+	if err != nil {
+		t.Fatalf("parsing proxies: %v", err)
+	}
+
+	tt := []struct {
+		name    string
+		proxies bool
+		remote  string
+		xff     []string
+		want    string
+	}{
+		{"no proxies", false, "10.0.0.1:1234", []string{"203.0.113.9"}, "10.0.0.1"},
+		{"untrusted peer", true, "198.51.100.7:1234", []string{"203.0.113.9"}, "198.51.100.7"},
+		{"trusted peer", true, "10.0.0.1:1234", []string{"203.0.113.9"}, "203.0.113.9"},
+		{"trusted single address", true, "192.0.2.1:1234", []string{"203.0.113.9"}, "203.0.113.9"},
+		{"trusted peer without header", true, "10.0.0.1:1234", nil, "10.0.0.1"},
+		{"spoofed entries ignored", true, "10.0.0.1:1234", []string{"1.1.1.1, 203.0.113.9"}, "203.0.113.9"},
+		{"chain of proxies", true, "10.0.0.1:1234", []string{"203.0.113.9, 10.0.0.2"}, "203.0.113.9"},
+		{"repeated headers", true, "10.0.0.1:1234", []string{"1.1.1.1", "203.0.113.9"}, "203.0.113.9"},
+		{"only proxies", true, "10.0.0.1:1234", []string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"garbage entry", true, "10.0.0.1:1234", []string{"203.0.113.9, bogus"}, "10.0.0.1"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			app := web.NewApp(make(chan os.Signal, 1), logger.New(ioutil.Discard, "test", logger.InfoLevel))
+			if tc.proxies {
+				app.TrustProxies(proxies)
+			}
+
+			var got string
+			app.Handle(http.MethodGet, "/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+				got = ctx.Value(web.KeyValues).(*web.Values).ClientIP
+				return nil
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tc.remote
+			for _, h := range tc.xff {
+				r.Header.Add("X-Forwarded-For", h)
+			}
+			app.ServeHTTP(httptest.NewRecorder(), r)
+
+			if got != tc.want {
+				t.Fatalf("got client %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestParseProxies checks malformed proxies are refused.
+func TestParseProxies(t *testing.T) {
+	for _, spec := range []string{"10.0.0", "10.0.0.0/33", "proxy"} {
+		if _, err := web.ParseProxies([]string{spec}); err == nil {
+			t.Errorf("%q: want an error", spec)
+		}
+	}
+}
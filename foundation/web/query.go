@@ -0,0 +1,207 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// queryValidator checks values bound by DecodeQuery.
+var queryValidator struct {
+	sync.RWMutex
+	fn func(val interface{}) error
+}
+
+// SetQueryValidator sets the function DecodeQuery runs on the values it
+// binds, such as one checking validate tags.
+func SetQueryValidator(fn func(val interface{}) error) {
+	queryValidator.Lock()
+	defer queryValidator.Unlock()
+
+	queryValidator.fn = fn
+}
+
+// durationType is the type of time.Duration fields.
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// DecodeQuery binds the path parameters and query string of a request into
+// the struct val points to. Fields tagged `param:"name"` take the path
+// parameter and fields tagged `query:"name"` the query parameter, or the
+// value of a `default:"..."` tag when it is missing. Strings, booleans,
+// numbers, durations and times given in RFC 3339 or as YYYY-MM-DD dates are
+// supported, as are pointers to them, which stay nil when the parameter is
+// missing, and slices of them given as repeated or comma separated values.
+// Embedded structs are bound too.
+//
+// Values that can't be parsed are reported as FieldErrors. The result is
+// then passed to the validator set with SetQueryValidator.
+func DecodeQuery(r *http.Request, val interface{}) error {
+	rv := reflect.ValueOf(val)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("decode query: %T is not a pointer to a struct", val)
+	}
+
+	var fields FieldErrors
+	bindQuery(rv.Elem(), Params(r), r.URL.Query(), &fields)
+	if len(fields) > 0 {
+		return fields
+	}
+
+	queryValidator.RLock()
+	fn := queryValidator.fn
+	queryValidator.RUnlock()
+
+	if fn != nil {
+		return fn(val)
+	}
+	return nil
+}
+
+// bindQuery binds the fields of the struct sv.
+func bindQuery(sv reflect.Value, params map[string]string, query map[string][]string, fields *FieldErrors) {
+	st := sv.Type()
+	for i := 0; i < st.NumField(); i++ {
+		sf := st.Field(i)
+		fv := sv.Field(i)
+
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			bindQuery(fv, params, query, fields)
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		var name string
+		var values []string
+		switch {
+		case sf.Tag.Get("param") != "":
+			name = sf.Tag.Get("param")
+			if s, ok := params[name]; ok {
+				values = []string{s}
+			}
+		case sf.Tag.Get("query") != "":
+			name = sf.Tag.Get("query")
+			for _, s := range query[name] {
+				if s != "" {
+					values = append(values, s)
+				}
+			}
+		default:
+			continue
+		}
+
+		if len(values) == 0 {
+			def, ok := sf.Tag.Lookup("default")
+			if !ok {
+				continue
+			}
+			values = []string{def}
+		}
+
+		if err := setQueryField(fv, values); err != nil {
+			*fields = append(*fields, FieldError{Field: name, Error: name + " " + err.Error()})
+		}
+	}
+}
+
+// setQueryField stores the values of a parameter in the field fv.
+func setQueryField(fv reflect.Value, values []string) error {
+	switch {
+	case fv.Kind() == reflect.Ptr:
+		ev := reflect.New(fv.Type().Elem())
+		if err := setQueryField(ev.Elem(), values); err != nil {
+			return err
+		}
+		fv.Set(ev)
+		return nil
+
+	case fv.Kind() == reflect.Slice:
+		var parts []string
+		for _, s := range values {
+			for _, part := range strings.Split(s, ",") {
+				if part = strings.TrimSpace(part); part != "" {
+					parts = append(parts, part)
+				}
+			}
+		}
+
+		sv := reflect.MakeSlice(fv.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			if err := parseQueryValue(sv.Index(i), part); err != nil {
+				return err
+			}
+		}
+		fv.Set(sv)
+		return nil
+	}
+
+	return parseQueryValue(fv, values[len(values)-1])
+}
+
+// parseQueryValue parses s into the single valued field fv.
+func parseQueryValue(fv reflect.Value, s string) error {
+	switch {
+	case fv.Type() == timeType:
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			if t, err = time.Parse("2006-01-02", s); err != nil {
+				return errors.New("must be an RFC 3339 time or a YYYY-MM-DD date")
+			}
+		}
+		fv.Set(reflect.ValueOf(t))
+		return nil
+
+	case fv.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return errors.New("must be a duration")
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return errors.New("must be true or false")
+		}
+		fv.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, fv.Type().Bits())
+		if err != nil {
+			return errors.New("must be an integer")
+		}
+		fv.SetInt(n)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, fv.Type().Bits())
+		if err != nil {
+			return errors.New("must be a positive integer")
+		}
+		fv.SetUint(n)
+
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, fv.Type().Bits())
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		fv.SetFloat(f)
+
+	default:
+		return fmt.Errorf("has unsupported type %s", fv.Type())
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package web_test
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dimfeld/httptreemux/v5"
+	"github.com/nextwavedevs/drop/foundation/web"
+)
+
+// Paging is embedded in query to check embedded structs are bound.
+type Paging struct {
+	Page int `query:"page" default:"1"`
+	Rows int `query:"rows" default:"20"`
+}
+
+// query has a field of each supported kind.
+type query struct {
+	Paging
+	ID       string          `param:"id"`
+	Name     string          `query:"name"`
+	Active   bool            `query:"active"`
+	Min      int8            `query:"min"`
+	Max      uint16          `query:"max"`
+	Ratio    float64         `query:"ratio"`
+	Wait     time.Duration   `query:"wait" default:"5s"`
+	Since    time.Time       `query:"since"`
+	Limit    *int            `query:"limit"`
+	Until    *time.Time      `query:"until"`
+	Tags     []string        `query:"tag"`
+	Days     []int           `query:"day"`
+	Timeouts []time.Duration `query:"timeouts"`
+	Ignored  string
+	hidden   string `query:"hidden"`
+}
+
+// TestDecodeQuery binds query strings and path parameters into query.
+func TestDecodeQuery(t *testing.T) {
+	ten := 10
+	until := time.Date(2021, time.May, 1, 0, 0, 0, 0, time.UTC)
+	since := time.Date(2021, time.April, 1, 12, 30, 0, 0, time.FixedZone("", 2*60*60))
+
+	defaults := query{Paging: Paging{Page: 1, Rows: 20}, Wait: 5 * time.Second}
+	with := func(fn func(q *query)) query {
+		q := defaults
+		fn(&q)
+		return q
+	}
+
+	tt := []struct {
+		name   string
+		params map[string]string
+		query  string
+		want   query
+		fields []string
+	}{
+		{"defaults", nil, "", defaults, nil},
+		{"embedded", nil, "page=3&rows=50", with(func(q *query) { q.Page, q.Rows = 3, 50 }), nil},
+		{"empty value takes default", nil, "page=", defaults, nil},
+		{"path parameter", map[string]string{"id": "abc"}, "id=xyz", with(func(q *query) { q.ID = "abc" }), nil},
+		{"string", nil, "name=a+b%26c", with(func(q *query) { q.Name = "a b&c" }), nil},
+		{"last value wins", nil, "name=a&name=b", with(func(q *query) { q.Name = "b" }), nil},
+		{"bool", nil, "active=true", with(func(q *query) { q.Active = true }), nil},
+		{"sized ints", nil, "min=-128&max=65535", with(func(q *query) { q.Min, q.Max = -128, 65535 }), nil},
+		{"float", nil, "ratio=0.25", with(func(q *query) { q.Ratio = 0.25 }), nil},
+		{"duration", nil, "wait=1m30s", with(func(q *query) { q.Wait = 90 * time.Second }), nil},
+		{"rfc 3339 time", nil, "since=2021-04-01T12:30:00%2B02:00", with(func(q *query) { q.Since = since }), nil},
+		{"date", nil, "until=2021-05-01", with(func(q *query) { q.Until = &until }), nil},
+		{"pointer", nil, "limit=10", with(func(q *query) { q.Limit = &ten }), nil},
+		{"repeated values", nil, "tag=a&tag=b", with(func(q *query) { q.Tags = []string{"a", "b"} }), nil},
+		{"comma separated values", nil, "tag=a,+b,,c&tag=d", with(func(q *query) { q.Tags = []string{"a", "b", "c", "d"} }), nil},
+		{"slice of ints", nil, "day=1,2", with(func(q *query) { q.Days = []int{1, 2} }), nil},
+		{"slice of durations", nil, "timeouts=1s,2s", with(func(q *query) { q.Timeouts = []time.Duration{time.Second, 2 * time.Second} }), nil},
+		{"untagged and unexported", nil, "Ignored=x&hidden=y", defaults, nil},
+		{"bad bool", nil, "active=maybe", query{}, []string{"active"}},
+		{"int overflow", nil, "min=128", query{}, []string{"min"}},
+		{"negative uint", nil, "max=-1", query{}, []string{"max"}},
+		{"bad float", nil, "ratio=half", query{}, []string{"ratio"}},
+		{"bad duration", nil, "wait=5", query{}, []string{"wait"}},
+		{"bad time", nil, "since=yesterday", query{}, []string{"since"}},
+		{"bad pointer", nil, "limit=ten", query{}, []string{"limit"}},
+		{"bad slice element", nil, "day=1,two", query{}, []string{"day"}},
+		{"every bad field", nil, "page=x&min=y", query{}, []string{"page", "min"}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/?"+tc.query, nil)
+			if tc.params != nil {
+				r = r.WithContext(httptreemux.AddParamsToContext(r.Context(), tc.params))
+			}
+
+			var got query
+			err := web.DecodeQuery(r, &got)
+
+			if tc.fields != nil {
+				var fe web.FieldErrors
+				if !errors.As(err, &fe) {
+					t.Fatalf("got error %v, want field errors", err)
+				}
+				var names []string
+				for _, f := range fe {
+					names = append(names, f.Field)
+				}
+				if !reflect.DeepEqual(names, tc.fields) {
+					t.Fatalf("got errors for %v, want %v", names, tc.fields)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.Since.Equal(tc.want.Since) {
+				t.Fatalf("got since %v, want %v", got.Since, tc.want.Since)
+			}
+			got.Since, tc.want.Since = time.Time{}, time.Time{}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestDecodeQueryTarget checks values that aren't pointers to structs are
+// refused.
+func TestDecodeQueryTarget(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+
+	var q query
+	for _, val := range []interface{}{q, new(int), nil} {
+		if err := web.DecodeQuery(r, val); err == nil {
+			t.Errorf("%T: want an error", val)
+		}
+	}
+}
+
+// TestDecodeQueryValidator checks the validator runs on bound values and
+// not when binding fails.
+func TestDecodeQueryValidator(t *testing.T) {
+	invalid := errors.New("invalid")
+	var calls int
+	web.SetQueryValidator(func(val interface{}) error {
+		calls++
+		if val.(*query).Page > 10 {
+			return invalid
+		}
+		return nil
+	})
+	defer web.SetQueryValidator(nil)
+
+	tt := []struct {
+		query string
+		err   bool
+		calls int
+	}{
+		{"page=2", false, 1},
+		{"page=11", true, 1},
+		{"page=x", true, 0},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.query, func(t *testing.T) {
+			calls = 0
+			r := httptest.NewRequest("GET", "/?"+tc.query, nil)
+
+			var q query
+			err := web.DecodeQuery(r, &q)
+			if (err != nil) != tc.err {
+				t.Fatalf("got error %v, want error %v", err, tc.err)
+			}
+			if calls != tc.calls {
+				t.Fatalf("validator ran %d times, want %d", calls, tc.calls)
+			}
+		})
+	}
+}
@@ -1,12 +1,22 @@
 package web
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"strings"
 
 	"github.com/dimfeld/httptreemux/v5"
+	"github.com/pkg/errors"
 )
 
+// DefaultMaxBody is the largest request body an App accepts unless told
+// otherwise.
+const DefaultMaxBody = 1 << 20
+
 // Params returns the web call parameters from the request.
 func Params(r *http.Request) map[string]string {
 	return httptreemux.ContextParams(r.Context())
@@ -16,12 +26,113 @@ func Params(r *http.Request) map[string]string {
 // body is decoded into the provided value.
 //
 // If the provided value is a struct then it is checked for validation tags.
+//
+// Bodies that aren't JSON are refused with 415 and ones that can't be
+// decoded with 400, saying where the document went wrong.
 func Decode(r *http.Request, val interface{}) error {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mt != "application/json" && !strings.HasSuffix(mt, "+json")) {
+		return NewRequestError(fmt.Errorf("unsupported content type %q, expected application/json", r.Header.Get("Content-Type")), http.StatusUnsupportedMediaType)
+	}
+
 	decoder := json.NewDecoder(r.Body)
 	decoder.DisallowUnknownFields()
 	if err := decoder.Decode(val); err != nil {
-		return err
+		return decodeError(err)
+	}
+
+	// Anything after the document is a mistake by the client.
+	if err := decoder.Decode(&struct{}{}); err != io.EOF {
+		if _, ok := errors.Cause(err).(*RequestError); ok {
+			return err
+		}
+		return NewRequestError(errors.New("body must hold a single JSON document"), http.StatusBadRequest)
 	}
 
 	return nil
 }
+
+// decodeError turns an error decoding a JSON body into a RequestError
+// naming the offending field and offset where it can.
+func decodeError(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var invalidErr *json.InvalidUnmarshalError
+
+	switch {
+	case errors.As(err, &invalidErr):
+		return err
+	case errors.As(err, &syntaxErr):
+		return NewRequestError(fmt.Errorf("malformed JSON at offset %d: %s", syntaxErr.Offset, syntaxErr), http.StatusBadRequest)
+	case errors.As(err, &typeErr):
+		return NewRequestError(fmt.Errorf("field %q must be %s, got %s at offset %d", typeErr.Field, typeErr.Type, typeErr.Value, typeErr.Offset), http.StatusBadRequest)
+	case err == io.EOF:
+		return NewRequestError(errors.New("body must not be empty"), http.StatusBadRequest)
+	case err == io.ErrUnexpectedEOF:
+		return NewRequestError(errors.New("body ends in the middle of the JSON document"), http.StatusBadRequest)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return NewRequestError(fmt.Errorf("unknown field %s", strings.TrimPrefix(err.Error(), "json: unknown field ")), http.StatusBadRequest)
+	}
+
+	if _, ok := errors.Cause(err).(*RequestError); ok {
+		return err
+	}
+	return NewRequestError(err, http.StatusBadRequest)
+}
+
+// limitBody caps the request body of a route at its limit, or the App's
+// when the route has none. Reading past it fails with a RequestError for
+// 413.
+func (a *App) limitBody(rt *Route) Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler Handler) Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			limit := rt.MaxBody
+			if limit == 0 {
+				limit = a.maxBody
+			}
+
+			if limit > 0 && r.Body != nil {
+				if r.ContentLength > limit {
+					return NewRequestError(tooLarge(limit), http.StatusRequestEntityTooLarge)
+				}
+				r.Body = &limitedBody{
+					ReadCloser: http.MaxBytesReader(w, r.Body, limit),
+					limit:      limit,
+				}
+			}
+
+			return handler(ctx, w, r)
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// tooLarge is the error for a body over limit bytes.
+func tooLarge(limit int64) error {
+	return fmt.Errorf("body must not be larger than %d bytes", limit)
+}
+
+// limitedBody reports reads past the limit of a http.MaxBytesReader as a
+// RequestError so handlers return them as they would any other.
+type limitedBody struct {
+	io.ReadCloser
+	limit int64
+	read  int64
+}
+
+// Read implements io.Reader.
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if err != nil && err != io.EOF && b.read >= b.limit {
+		return n, NewRequestError(tooLarge(b.limit), http.StatusRequestEntityTooLarge)
+	}
+	return n, err
+}
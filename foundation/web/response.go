@@ -1,8 +1,9 @@
 package web
 
 import (
+	"bufio"
 	"context"
-	"encoding/json"
+	"io"
 	"net/http"
 
 	"go.opentelemetry.io/otel/trace"
@@ -20,30 +21,88 @@ func Respond(ctx context.Context, w http.ResponseWriter, data interface{}, statu
 	if !ok {
 		return NewShutdownError("web value missing from context")
 	}
-	v.StatusCode = statusCode
 
 	// If there is nothing to marshal then set status code and return.
 	if statusCode == http.StatusNoContent {
+		v.StatusCode = statusCode
 		w.WriteHeader(statusCode)
 		return nil
 	}
 
-	// Convert the response value to JSON.
-	jsonData, err := json.Marshal(data)
+	// Convert the response value to the encoding the client prefers,
+	// JSON unless it asks for another.
+	contentType, encode := encoder(v.Accept)
+	body, err := encode(data)
 	if err != nil {
 		return err
 	}
 
 	// Set the content type and headers once we know marshaling has succeeded.
-	w.Header().Set("Content-Type", "application/json")
+	// Encodings other than the default get their own entity tag.
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Add("Vary", "Accept")
+	if contentType != defaultEncoding() {
+		varyTag(w.Header(), mediaVariant(contentType))
+	}
 
-	// Write the status code to the response.
+	// Write the status code to the response. From here on the response is
+	// committed and errors can't be sent in its place.
+	v.StatusCode = statusCode
 	w.WriteHeader(statusCode)
 
 	// Send the result back to the client.
-	if _, err := w.Write(jsonData); err != nil {
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RespondRaw sends an already encoded body to the client with the provided
+// content type.
+func RespondRaw(ctx context.Context, w http.ResponseWriter, body []byte, contentType string, statusCode int) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "foundation.web.respondraw")
+	defer span.End()
+
+	// Set the status code for the request logger middleware.
+	v, ok := ctx.Value(KeyValues).(*Values)
+	if !ok {
+		return NewShutdownError("web value missing from context")
+	}
+	v.StatusCode = statusCode
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(statusCode)
+
+	if _, err := w.Write(body); err != nil {
 		return err
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// RespondStream sends a body to the client as fn produces it so large
+// responses never have to be held in memory. The status is committed before
+// fn runs, so an error from fn can only cut the response short. The status
+// code recorded in Values tells the error middleware not to respond again.
+func RespondStream(ctx context.Context, w http.ResponseWriter, contentType string, statusCode int, fn func(w io.Writer) error) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "foundation.web.respondstream")
+	defer span.End()
+
+	// Set the status code for the request logger middleware.
+	v, ok := ctx.Value(KeyValues).(*Values)
+	if !ok {
+		return NewShutdownError("web value missing from context")
+	}
+	v.StatusCode = statusCode
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(statusCode)
+
+	bw := bufio.NewWriter(w)
+	if err := fn(bw); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
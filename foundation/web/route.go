@@ -0,0 +1,230 @@
+package web
+
+import (
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Set of ways a route can be authenticated.
+const (
+	AuthNone     = ""
+	AuthRequired = "required"
+	AuthOptional = "optional"
+)
+
+// Route records what is known about a registered route so the API can be
+// documented from the routes themselves. Handle fills in the method, path and
+// name along with anything the route's middleware describes; the rest is
+// added by chaining the methods below onto the result of Handle.
+type Route struct {
+	Method       string
+	Path         string
+	Name         string
+	Summary      string
+	Tags         []string
+	Debug        bool
+	Auth         string
+	Roles        []string
+	Params       []Param
+	CacheControl string
+	MaxBody      int64
+	WriteTimeout time.Duration
+	ReadTimeout  time.Duration
+	Request      *Body
+	Responses    map[int]*Body
+}
+
+// Param describes a query string parameter of a route.
+type Param struct {
+	Name        string
+	Description string
+}
+
+// Body describes the body of a request or response. Type is nil for bodies
+// that are not JSON, such as exports and uploads, and for responses without
+// a body.
+type Body struct {
+	Type         reflect.Type
+	ContentTypes []string
+}
+
+// Doc sets the one line summary of the route.
+func (rt *Route) Doc(summary string) *Route {
+	rt.Summary = summary
+	return rt
+}
+
+// Tag groups the route under the given tags instead of the first segment of
+// its path.
+func (rt *Route) Tag(tags ...string) *Route {
+	rt.Tags = tags
+	return rt
+}
+
+// Query documents a query string parameter the route reads.
+func (rt *Route) Query(name string, description string) *Route {
+	rt.Params = append(rt.Params, Param{Name: name, Description: description})
+	return rt
+}
+
+// Accepts documents the JSON body decoded by the route from a value of its
+// type.
+func (rt *Route) Accepts(v interface{}) *Route {
+	rt.Request = &Body{Type: reflect.TypeOf(v), ContentTypes: []string{"application/json"}}
+	return rt.Fails(http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType)
+}
+
+// AcceptsRaw documents a route reading a body of one of the content types
+// that isn't described by a Go type.
+func (rt *Route) AcceptsRaw(contentTypes ...string) *Route {
+	rt.Request = &Body{ContentTypes: contentTypes}
+	return rt.Fails(http.StatusRequestEntityTooLarge)
+}
+
+// Returns documents a response of the route. The body, in any of the
+// registered encodings, is described by the type of v; a nil v documents a
+// response without a body.
+func (rt *Route) Returns(status int, v interface{}) *Route {
+	b := Body{}
+	if v != nil {
+		b = Body{Type: reflect.TypeOf(v), ContentTypes: Encodings()}
+	}
+	return rt.respond(status, &b)
+}
+
+// ReturnsRaw documents a response whose body is one of the content types
+// and isn't described by a Go type.
+func (rt *Route) ReturnsRaw(status int, contentTypes ...string) *Route {
+	return rt.respond(status, &Body{ContentTypes: contentTypes})
+}
+
+// Cache sets the Cache-Control directives of the route's successful GET
+// responses. Those responses get an ETag computed from the body unless the
+// handler sets one, and conditional requests for them are answered with 304.
+func (rt *Route) Cache(directives string) *Route {
+	rt.CacheControl = directives
+	return rt.respond(http.StatusNotModified, &Body{})
+}
+
+// Limit sets the largest request body, in bytes, the route accepts in place
+// of the App's limit. A limit less than zero removes it.
+func (rt *Route) Limit(n int64) *Route {
+	rt.MaxBody = n
+	return rt
+}
+
+// Timeout sets how long the route has to write its response in place of the
+// App's write timeout, such as for a streamed export. A timeout less than
+// zero removes it.
+func (rt *Route) Timeout(d time.Duration) *Route {
+	rt.WriteTimeout = d
+	return rt
+}
+
+// BodyTimeout sets how long the route has to receive its request body in
+// place of the server's read timeout, such as for a large upload. A timeout
+// less than zero removes it.
+func (rt *Route) BodyTimeout(d time.Duration) *Route {
+	rt.ReadTimeout = d
+	return rt
+}
+
+// Fails documents the error statuses the route responds with on top of the
+// ones its middleware describes.
+func (rt *Route) Fails(statuses ...int) *Route {
+	for _, status := range statuses {
+		if _, exists := rt.Responses[status]; !exists {
+			rt.respond(status, nil)
+		}
+	}
+	return rt
+}
+
+// Authenticated marks the route as taking a bearer token, required or
+// optional.
+func (rt *Route) Authenticated(auth string) *Route {
+	rt.Auth = auth
+	if auth == AuthRequired {
+		rt.Fails(http.StatusUnauthorized)
+	}
+	return rt
+}
+
+// Authorized marks the route as limited to users holding one of the roles.
+func (rt *Route) Authorized(roles ...string) *Route {
+	rt.Roles = append(rt.Roles, roles...)
+	return rt.Fails(http.StatusForbidden)
+}
+
+// respond records a response of the route. A nil body stands for the error
+// body of the API.
+func (rt *Route) respond(status int, b *Body) *Route {
+	if rt.Responses == nil {
+		rt.Responses = make(map[int]*Body)
+	}
+	rt.Responses[status] = b
+	return rt
+}
+
+// =============================================================================
+
+// describing is the route being registered while its middleware is wrapped
+// around its handler, guarded by describeMu.
+var (
+	describeMu sync.Mutex
+	describing *Route
+)
+
+// Describe returns middleware that behaves like mw and documents the routes
+// it is applied to through fn, such as marking them as authenticated.
+func Describe(mw Middleware, fn func(rt *Route)) Middleware {
+	return func(handler Handler) Handler {
+		if describing != nil {
+			fn(describing)
+		}
+		return mw(handler)
+	}
+}
+
+// newRoute starts the record of a route, naming it after its handler.
+func newRoute(debug bool, method string, path string, handler Handler) *Route {
+	rt := Route{
+		Method: method,
+		Path:   path,
+		Name:   handlerName(handler),
+		Debug:  debug,
+	}
+
+	// Group the route under the first segment of its path after the version.
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) > 1 && strings.HasPrefix(parts[0], "v") {
+		parts = parts[1:]
+	}
+	if parts[0] != "" && !strings.ContainsAny(parts[0][:1], ":*") {
+		rt.Tags = []string{parts[0]}
+	}
+
+	return &rt
+}
+
+// handlerName turns the name of a handler's function, such as
+// "github.com/x/handlers.userGroup.query-fm", into "userGroup.query".
+func handlerName(handler Handler) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(handler).Pointer())
+	if fn == nil {
+		return ""
+	}
+
+	name := fn.Name()
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	if i := strings.Index(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.TrimSuffix(name, "-fm")
+}
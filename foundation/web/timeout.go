@@ -0,0 +1,88 @@
+package web
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// keyConn is how the connection of a request is stored/retrieved.
+const keyConn ctxKey = 2
+
+// ConnContext stores the connection of a request in its context so routes
+// can be given their own read and write timeouts. Set it as the ConnContext of the
+// http.Server serving the App.
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, keyConn, c)
+}
+
+// WriteTimeout sets how long routes have to write their response unless they
+// set their own timeout. A timeout of zero or less leaves the server's write
+// timeout in place, which must then be at least as long as the longest route
+// timeout.
+func (a *App) WriteTimeout(d time.Duration) {
+	a.timeout = d
+}
+
+// writeDeadline replaces the write deadline the server set on the connection
+// with the one of the route. It needs the connection stored by ConnContext
+// and does nothing without it.
+func (a *App) writeDeadline(rt *Route) Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler Handler) Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			timeout := rt.WriteTimeout
+			if timeout == 0 {
+				timeout = a.timeout
+			}
+
+			if c, ok := ctx.Value(keyConn).(net.Conn); ok {
+				switch {
+				case timeout > 0:
+					c.SetWriteDeadline(time.Now().Add(timeout))
+				case rt.WriteTimeout < 0:
+					c.SetWriteDeadline(time.Time{})
+				}
+			}
+
+			return handler(ctx, w, r)
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// readDeadline replaces the read deadline the server set on the connection
+// with the one of the route, when it has one, so a large body can take
+// longer to arrive than the server allows most requests. It needs the
+// connection stored by ConnContext and does nothing without it.
+func (a *App) readDeadline(rt *Route) Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler Handler) Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			if c, ok := ctx.Value(keyConn).(net.Conn); ok {
+				switch {
+				case rt.ReadTimeout > 0:
+					c.SetReadDeadline(time.Now().Add(rt.ReadTimeout))
+				case rt.ReadTimeout < 0:
+					c.SetReadDeadline(time.Time{})
+				}
+			}
+
+			return handler(ctx, w, r)
+		}
+
+		return h
+	}
+
+	return m
+}
@@ -0,0 +1,72 @@
+package web_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nextwavedevs/drop/foundation/logger"
+	"github.com/nextwavedevs/drop/foundation/web"
+)
+
+// TestBodyTimeout checks a route can take longer to receive its body than
+// the server's read timeout allows.
+func TestBodyTimeout(t *testing.T) {
+	tt := []struct {
+		name    string
+		timeout time.Duration
+		wantErr bool
+	}{
+		{"server timeout", 0, true},
+		{"route timeout", 5 * time.Second, false},
+		{"no timeout", -1, false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			app := web.NewApp(make(chan os.Signal, 1), logger.New(ioutil.Discard, "test", logger.InfoLevel))
+
+			read := make(chan error, 1)
+			app.Handle(http.MethodPost, "/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+				_, err := ioutil.ReadAll(r.Body)
+				read <- err
+				return nil
+			}).BodyTimeout(tc.timeout)
+
+			srv := httptest.NewUnstartedServer(app)
+			srv.Config.ReadTimeout = 100 * time.Millisecond
+			srv.Config.ConnContext = web.ConnContext
+			srv.Start()
+			defer srv.Close()
+
+			// Send the body slower than the server's read timeout allows.
+			pr, pw := io.Pipe()
+			go func() {
+				for i := 0; i < 3; i++ {
+					time.Sleep(100 * time.Millisecond)
+					pw.Write([]byte("chunk\n"))
+				}
+				pw.Close()
+			}()
+
+			resp, err := srv.Client().Post(srv.URL, "text/plain", pr)
+			if err == nil {
+				resp.Body.Close()
+			}
+
+			select {
+			case err := <-read:
+				if (err != nil) != tc.wantErr {
+					t.Fatalf("got read error %v, want error %t", err, tc.wantErr)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("handler never finished reading")
+			}
+		})
+	}
+}
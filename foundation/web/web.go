@@ -3,12 +3,14 @@ package web
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"os"
 	"syscall"
 	"time"
 
 	"github.com/dimfeld/httptreemux/v5"
+	"github.com/nextwavedevs/drop/foundation/logger"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -24,6 +26,10 @@ type Values struct {
 	TraceID    string
 	Now        time.Time
 	StatusCode int
+	Accept     string
+	Route      string
+	User       string
+	ClientIP   string
 }
 
 // A Handler is a type that handles an http request within our own little mini
@@ -44,11 +50,16 @@ type App struct {
 	mux      *httptreemux.ContextMux
 	otmux    http.Handler
 	shutdown chan os.Signal
+	log      *logger.Logger
 	mw       []Middleware
+	routes   []*Route
+	maxBody  int64
+	timeout  time.Duration
+	proxies  []*net.IPNet
 }
 
 // NewApp creates an App value that handle a set of routes for the application.
-func NewApp(shutdown chan os.Signal, mw ...Middleware) *App {
+func NewApp(shutdown chan os.Signal, log *logger.Logger, mw ...Middleware) *App {
 
 	// Create an OpenTelemetry HTTP Handler which wraps our router. This will start
 	// the initial span and annotate it with information about the request/response.
@@ -63,10 +74,18 @@ func NewApp(shutdown chan os.Signal, mw ...Middleware) *App {
 		mux:      mux,
 		otmux:    otelhttp.NewHandler(mux, "request"),
 		shutdown: shutdown,
+		log:      log,
 		mw:       mw,
+		maxBody:  DefaultMaxBody,
 	}
 }
 
+// MaxBody sets the largest request body, in bytes, routes accept unless
+// they set their own limit. A limit of zero or less removes it.
+func (a *App) MaxBody(n int64) {
+	a.maxBody = n
+}
+
 // SignalShutdown is used to gracefully shutdown the app when an integrity
 // issue is identified.
 func (a *App) SignalShutdown() {
@@ -82,35 +101,64 @@ func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 // HandleDebug sets a handler function for a given HTTP method and path pair
-// to the default http package server mux. /debug is added to the path.
-func (a *App) HandleDebug(method string, path string, handler Handler, mw ...Middleware) {
-	a.handle(true, method, path, handler, mw...)
+// to the default http package server mux. /debug is added to the path. The
+// returned Route can be used to document it.
+func (a *App) HandleDebug(method string, path string, handler Handler, mw ...Middleware) *Route {
+	return a.handle(true, method, path, handler, mw...)
 }
 
 // Handle sets a handler function for a given HTTP method and path pair
-// to the application server mux.
-func (a *App) Handle(method string, path string, handler Handler, mw ...Middleware) {
-	a.handle(false, method, path, handler, mw...)
+// to the application server mux. The returned Route can be used to document
+// it.
+func (a *App) Handle(method string, path string, handler Handler, mw ...Middleware) *Route {
+	return a.handle(false, method, path, handler, mw...)
+}
+
+// Routes returns the routes registered so far in the order they were added.
+func (a *App) Routes() []*Route {
+	return a.routes
 }
 
 // handle performs the real work of applying boilerplate and framework code
 // for a handler.
-func (a *App) handle(debug bool, method string, path string, handler Handler, mw ...Middleware) {
+func (a *App) handle(debug bool, method string, path string, handler Handler, mw ...Middleware) *Route {
+	rt := newRoute(debug, method, path, handler)
 	if debug {
+		rt.Path = "/debug" + path
+
 		// Track all the handlers that are being registered so we don't have
 		// the same handlers registered twice to this singleton.
 		if _, exists := registered[method+path]; exists {
-			return
+			return rt
 		}
 		registered[method+path] = true
 	}
+	a.routes = append(a.routes, rt)
+
+	// Let the middleware describe the route as it is wrapped around it.
+	describeMu.Lock()
+	describing = rt
 
 	// First wrap handler specific middleware around this handler.
 	handler = wrapMiddleware(mw, handler)
 
+	// Answer conditional requests once the route's own middleware is done.
+	handler = conditional(rt)(handler)
+
+	// Limit the request body before anything reads it.
+	handler = a.limitBody(rt)(handler)
+
+	// Bound the time the route has to read its request and write its
+	// response.
+	handler = a.readDeadline(rt)(handler)
+	handler = a.writeDeadline(rt)(handler)
+
 	// Add the application's general middleware to the handler chain.
 	handler = wrapMiddleware(a.mw, handler)
 
+	describing = nil
+	describeMu.Unlock()
+
 	// The function to execute for each request.
 	h := func(w http.ResponseWriter, r *http.Request) {
 
@@ -122,13 +170,17 @@ func (a *App) handle(debug bool, method string, path string, handler Handler, mw
 		// Set the context with the required values to
 		// process the request.
 		v := Values{
-			TraceID: span.SpanContext().TraceID().String(),
-			Now:     time.Now(),
+			TraceID:  span.SpanContext().TraceID().String(),
+			Now:      time.Now(),
+			Accept:   r.Header.Get("Accept"),
+			Route:    rt.Path,
+			ClientIP: a.clientIP(r),
 		}
 		ctx = context.WithValue(ctx, KeyValues, &v)
 
 		// Call the wrapped handler functions.
 		if err := handler(ctx, w, r); err != nil {
+			a.log.WithContext(ctx).Error("shutdown requested", "route", rt.Path, "error", err)
 			a.SignalShutdown()
 			return
 		}
@@ -145,7 +197,8 @@ func (a *App) handle(debug bool, method string, path string, handler Handler, mw
 			}
 		}
 		http.DefaultServeMux.HandleFunc("/debug"+path, f)
-		return
+		return rt
 	}
 	a.mux.Handle(method, path, h)
+	return rt
 }
\ No newline at end of file